@@ -0,0 +1,136 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WikiStats is the overview of the wiki on the dashboard.
+type WikiStats struct {
+	Pages   int
+	Bytes   int64
+	Commits int
+	Git     bool // Whether the history could be read from git
+	Largest []*PageSize
+}
+
+// PageSize is a page file with its size.
+type PageSize struct {
+	Page  string
+	File  string
+	Bytes int64
+}
+
+// dashboardEntries limits the largest pages, top authors and recent changes
+// on the dashboard.
+const dashboardEntries = 10
+
+// wikiStats sums up the pages of the wiki and counts its commits. Without
+// git, only the pages are counted.
+func wikiStats() *WikiStats {
+	stats := &WikiStats{}
+	pages, _ := listPages("")
+	for _, file := range pages {
+		info, err := os.Stat(path.Join(directory, file))
+		if err != nil {
+			continue
+		}
+		stats.Pages++
+		stats.Bytes += info.Size()
+		stats.Largest = append(stats.Largest, &PageSize{Page: pageURL(file), File: file, Bytes: info.Size()})
+	}
+	sort.SliceStable(stats.Largest, func(i, j int) bool { return stats.Largest[i].Bytes > stats.Largest[j].Bytes })
+	if len(stats.Largest) > dashboardEntries {
+		stats.Largest = stats.Largest[:dashboardEntries]
+	}
+	if _, ok := store.(gitStore); ok {
+		if buf, err := gitRun(exec.Command("git", "rev-list", "--count", "HEAD")); err == nil {
+			stats.Commits, err = strconv.Atoi(strings.TrimSpace(buf.String()))
+			stats.Git = err == nil
+		}
+	}
+	return stats
+}
+
+// adminHandler shows the dashboard of the wiki to administrators.
+func adminHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	s := currentSettings()
+	node := &Node{
+		Path:     r.URL.Path,
+		Title:    s.Title,
+		Basepath: strings.TrimSuffix(basepath, "/"),
+		Template: "admin.tpl",
+		System:   true,
+		Stats:    wikiStats(),
+	}
+	if node.Stats.Git {
+		if node.Authors = cachedAuthors(); len(node.Authors) > dashboardEntries {
+			node.Authors = node.Authors[:dashboardEntries]
+		}
+		node.Changes = gitChanges(dashboardEntries, "")
+	}
+	node.Dirs = listDirectories(r.URL.Path)
+	renderTemplate(w, node)
+}
+
+// pruneHandler squashes the repository history down to the revisions given by
+// the keep parameter, or -max-revisions. GET shows the form doing so.
+func pruneHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	if !allowPrune {
+		http.Error(w, "Pruning is disabled, confirm with -allow-prune", http.StatusForbidden)
+		return
+	}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		s := currentSettings()
+		node := &Node{
+			Path:      r.URL.Path,
+			Title:     s.Title,
+			Basepath:  strings.TrimSuffix(basepath, "/"),
+			Template:  "prune.tpl",
+			System:    true,
+			CSRF:      csrfToken(r),
+			PruneKeep: maxRevisions,
+		}
+		node.Dirs = listDirectories(r.URL.Path)
+		renderTemplate(w, node)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !checkCSRF(w, r) {
+		return
+	}
+
+	keep := maxRevisions
+	if value := r.PostFormValue("keep"); value != "" {
+		var err error
+		if keep, err = strconv.Atoi(value); err != nil || keep < 1 {
+			http.Error(w, "Invalid number of revisions to keep", http.StatusBadRequest)
+			return
+		}
+	}
+	if keep < 1 {
+		http.Error(w, "Number of revisions to keep is missing", http.StatusBadRequest)
+		return
+	}
+	fmt.Fprintf(w, "Pruned %d revisions\n", GitPrune(keep))
+}
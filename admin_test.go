@@ -0,0 +1,181 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// asAdmin enables the administration with Basic credentials until the end of
+// the test, returning a function sending them along with a request.
+func asAdmin(t *testing.T) func(*http.Request) *http.Request {
+	oldUser, oldPassword := adminUser, adminPassword
+	adminUser, adminPassword = "admin", "secret"
+	t.Cleanup(func() { adminUser, adminPassword = oldUser, oldPassword })
+	return func(r *http.Request) *http.Request {
+		r.SetBasicAuth("admin", "secret")
+		return r
+	}
+}
+
+// editToken returns the form token of the editor of a page.
+func editToken(t *testing.T, r func(*http.Request) *http.Request, page string) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	wikiHandler(w, r(httptest.NewRequest("GET", page+"?edit=1", nil)))
+	m := regexp.MustCompile(`(?s)class="edit-form">.*?name="csrf" value="([0-9a-f]+)"`).FindStringSubmatch(w.Body.String())
+	if w.Code != http.StatusOK || m == nil {
+		t.Fatalf("GET %s?edit=1: status %d without a form token", page, w.Code)
+	}
+	return m[1]
+}
+
+func TestPruneNeedsFormToken(t *testing.T) {
+	newTestWiki(t, map[string]string{"a.md": "a\n"})
+	for _, content := range []string{"b\n", "c\n", "d\n"} {
+		if err := store.Write("a.md", []byte(content), "tester", "Update"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	authorize := asAdmin(t)
+	defer func(old bool) { allowPrune = old }(allowPrune)
+	allowPrune = true
+
+	w := httptest.NewRecorder()
+	pruneHandler(w, authorize(httptest.NewRequest("GET", "/_prune", nil)))
+	m := regexp.MustCompile(`name="csrf" value="([0-9a-f]+)"`).FindStringSubmatch(w.Body.String())
+	if w.Code != http.StatusOK || m == nil {
+		t.Fatalf("GET /_prune: status %d without a form token", w.Code)
+	}
+
+	post := func(form url.Values) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/_prune", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		pruneHandler(w, authorize(r))
+		return w
+	}
+	if w := post(url.Values{"keep": {"1"}}); w.Code != http.StatusForbidden {
+		t.Errorf("POST without a token: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+	wrong := "0" + m[1][1:]
+	if wrong == m[1] {
+		wrong = "1" + m[1][1:]
+	}
+	if w := post(url.Values{"keep": {"1"}, "csrf": {wrong}}); w.Code != http.StatusForbidden {
+		t.Errorf("POST with a wrong token: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if gitRevisions() != 4 {
+		t.Fatalf("history pruned without a token, %d revisions left", gitRevisions())
+	}
+	if w := post(url.Values{"keep": {"2"}, "csrf": {m[1]}}); w.Code != http.StatusOK {
+		t.Errorf("POST with the token: status %d, want %d", w.Code, http.StatusOK)
+	}
+	if got := gitRevisions(); got != 2 {
+		t.Errorf("%d revisions left after pruning, want 2", got)
+	}
+}
+
+func TestPruneSlack(t *testing.T) {
+	tests := []struct{ limit, slack int }{
+		{1, 10},
+		{100, 10},
+		{150, 15},
+		{1000, 100},
+	}
+	for _, test := range tests {
+		if got := pruneSlack(test.limit); got != test.slack {
+			t.Errorf("pruneSlack(%d) = %d, want %d", test.limit, got, test.slack)
+		}
+	}
+}
+
+func TestCommitsPruneOnlyBeyondSlack(t *testing.T) {
+	newTestWiki(t, map[string]string{"a.md": "0\n"})
+	defer func(old int) { maxRevisions = old }(maxRevisions)
+	maxRevisions = 2
+
+	for i := 1; i <= 1+pruneSlack(2); i++ {
+		content := strings.Repeat("x", i) + "\n"
+		if err := store.Write("a.md", []byte(content), "tester", "Update"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := gitRevisions(), 2+pruneSlack(2); got != want {
+		t.Fatalf("%d revisions within the slack, want %d", got, want)
+	}
+	if err := store.Write("a.md", []byte("last\n"), "tester", "Update"); err != nil {
+		t.Fatal(err)
+	}
+	if got := gitRevisions(); got != 2 {
+		t.Errorf("%d revisions beyond the slack, want 2", got)
+	}
+}
+
+func TestSettingsNeedFormToken(t *testing.T) {
+	authorize := asAdmin(t)
+	before := currentSettings()
+
+	form := url.Values{"title": {"Changed"}, "loglimit": {"5"}}
+	r := httptest.NewRequest("POST", "/_settings", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	settingsHandler(w, authorize(r))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("POST without a token: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if currentSettings() != before {
+		t.Errorf("settings changed without a token")
+	}
+}
+
+func TestProtectedPagesNeedFormToken(t *testing.T) {
+	dir := newTestWiki(t, map[string]string{"a.md": "---\nprotected: true\n---\na\n"})
+	authorize := asAdmin(t)
+	token := editToken(t, authorize, "/a")
+
+	w := httptest.NewRecorder()
+	wikiHandler(w, authorize(httptest.NewRequest("GET", "/a?edit=1&askdelete=1", nil)))
+	forms := regexp.MustCompile(`(?s)<form method="POST".*?</form>`).FindAllString(w.Body.String(), -1)
+	if len(forms) != 2 {
+		t.Errorf("editor of a protected page has %d forms, want the editor and deleting", len(forms))
+	}
+	for _, form := range forms {
+		if !strings.Contains(form, `name="csrf" value="`+token+`"`) {
+			t.Errorf("form of a protected page without the token:\n%s", form)
+		}
+	}
+
+	wrong := "0" + token[1:]
+	if wrong == token {
+		wrong = "1" + token[1:]
+	}
+	tests := []url.Values{
+		{"content": {"changed\n"}, "author": {"tester"}, "msg": {"Update"}},
+		{"delete": {"1"}, "author": {"tester"}},
+		{"revert": {"HEAD"}, "author": {"tester"}},
+		{"publish": {"1"}, "author": {"tester"}},
+		{"content": {"changed\n"}, "author": {"tester"}, "msg": {"Update"}, "csrf": {wrong}},
+	}
+	for _, form := range tests {
+		if w := postForm(t, authorize, "/a", form); w.Code != http.StatusForbidden {
+			t.Errorf("POST %v as administrator without the token: status %d, want %d", form, w.Code, http.StatusForbidden)
+		}
+	}
+	if bytes, _ := os.ReadFile(dir + "/a.md"); string(bytes) != "---\nprotected: true\n---\na\n" || len(store.History("a.md", 10)) != 1 {
+		t.Errorf("protected page changed without the token: %q", bytes)
+	}
+
+	form := url.Values{"content": {"---\nprotected: true\n---\nchanged\n"}, "author": {"tester"}, "msg": {"Update"}, "csrf": {token}}
+	if w := postForm(t, authorize, "/a", form); w.Code != http.StatusOK {
+		t.Errorf("POST as administrator with the token: status %d", w.Code)
+	}
+}
@@ -0,0 +1,48 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"path"
+	"strings"
+)
+
+// buildAliases maps the aliases of the pages, listed in their front matter
+// as "aliases: [faq, help/questions]", to the page URLs. Aliases claimed by
+// another page, or which are pages of their own, are logged and skipped.
+func buildAliases() map[string]string {
+	aliases := make(map[string]string)
+	owners := make(map[string]string)
+	pages, _ := listPages("")
+	existing := make(map[string]bool)
+	for _, file := range pages {
+		existing["/"+strings.TrimSuffix(file, path.Ext(file))] = true
+	}
+	for _, file := range pages {
+		bytes, err := ioutil.ReadFile(path.Join(directory, file))
+		if err != nil {
+			log.Printf("Cant read file %q, error: %v", file, err)
+			continue
+		}
+		meta, _ := parseFrontMatter(bytes)
+		for _, alias := range metaList(mergeSidecar(meta, file)["aliases"]) {
+			alias = "/" + strings.Trim(alias, "/")
+			if alias == "/" {
+				continue
+			}
+			if existing[alias] {
+				log.Printf("Alias %q of %q is a page of its own", alias, file)
+			} else if owner, ok := owners[alias]; ok && owner != file {
+				log.Printf("Alias %q of %q is already taken by %q", alias, file, owner)
+			} else {
+				owners[alias] = file
+				aliases[alias] = pageURL(file)
+			}
+		}
+	}
+	return aliases
+}
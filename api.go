@@ -0,0 +1,173 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// writeJSON writes a value as a JSON response.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Could not encode JSON: %v", err)
+	}
+}
+
+// historyHandler lists the revisions of a page.
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+	page := strings.TrimPrefix(r.URL.Path, "/api/history")
+	if page == "" || strings.HasSuffix(page, "/") {
+		page += "index"
+	}
+	node := &Node{File: resolveFile(page[1:])}
+	if _, err := os.Stat(path.Join(directory, node.File)); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	limit := currentSettings().LogLimit
+	if value := r.FormValue("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+	writeJSON(w, node.history(limit).Log)
+}
+
+// adminMetaKeys are the metadata keys deciding who may see and change a page,
+// which only administrators may change through the API.
+var adminMetaKeys = []string{"protected", "publish", "aliases", "noindex"}
+
+// metaHandler reads and writes the metadata file of a page. A POST replaces
+// it with the JSON object in the request body, checked like saving the page.
+func metaHandler(w http.ResponseWriter, r *http.Request) {
+	page := strings.TrimPrefix(r.URL.Path, "/api/meta")
+	if page == "" || strings.HasSuffix(page, "/") {
+		page += "index"
+	}
+	file := resolveFile(page[1:])
+	if _, err := os.Stat(path.Join(directory, file)); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		meta := readSidecar(file)
+		if meta == nil {
+			meta = make(map[string]string)
+		}
+		writeJSON(w, meta)
+		return
+	}
+
+	if currentSettings().ReadOnly {
+		http.Error(w, "The wiki is read only", http.StatusForbidden)
+		return
+	}
+	// Other sites can only send JSON after a CORS preflight, which is never
+	// answered
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		http.Error(w, "Metadata must be sent as application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+	if isReserved(page) {
+		http.Error(w, "This path is reserved", http.StatusBadRequest)
+		return
+	}
+	if isProtected(page, file) && !requireAdmin(w, r) {
+		return
+	}
+	if submodule := submoduleOf(file); submodule != "" {
+		http.Error(w, fmt.Sprintf("This page belongs to the submodule %q, change it there", submodule), http.StatusForbidden)
+		return
+	}
+	var values map[string]interface{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&values); err != nil {
+		http.Error(w, "Metadata must be a JSON object", http.StatusBadRequest)
+		return
+	}
+	bytes, err := json.MarshalIndent(values, "", "\t")
+	if err != nil {
+		http.Error(w, "Metadata must be a JSON object", http.StatusBadRequest)
+		return
+	}
+	if !isAdmin(r) {
+		old, _ := readSidecarValues(file)
+		for _, key := range adminMetaKeys {
+			if fmt.Sprint(old[key]) != fmt.Sprint(values[key]) {
+				http.Error(w, fmt.Sprintf("Only administrators can change %q", key), http.StatusForbidden)
+				return
+			}
+		}
+	}
+	author := commitAuthor(r)
+	if author == "" {
+		http.Error(w, "Changes need an author", http.StatusBadRequest)
+		return
+	}
+	// The submitter is not told which pattern matched
+	if line := blockedLine(string(bytes)); line > 0 {
+		log.Printf("Rejected metadata of %q by %q, matching line %d of the blocklist", file, author, line)
+		http.Error(w, "This change is not allowed", http.StatusForbidden)
+		return
+	}
+	msg := fmt.Sprintf("Update metadata of %s", strings.TrimPrefix(page, "/"))
+	if err := store.Write(sidecarFile(file), append(bytes, '\n'), author, msg); err != nil {
+		log.Printf("Cant write file %q, error: %v", sidecarFile(file), err)
+		http.Error(w, "Could not write the metadata", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, readSidecar(file))
+}
+
+// pageJSON is the structured representation of a page.
+type pageJSON struct {
+	Path     string            `json:"path"`
+	Revision string            `json:"revision,omitempty"`
+	Meta     map[string]string `json:"meta,omitempty"`
+	Source   string            `json:"source"`
+	HTML     string            `json:"html"`
+	Log      []*Log            `json:"log"`
+}
+
+// writePage writes a page in a representation other than the wiki layout.
+func writePage(w http.ResponseWriter, node *Node, format string) {
+	switch format {
+	case formatMarkdown:
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.Write(node.Bytes)
+	case formatJSON:
+		source := string(node.Bytes)
+		node.ToMarkdown()
+		writeJSON(w, pageJSON{
+			Path:     node.Path,
+			Revision: node.Revision,
+			Meta:     node.Meta,
+			Source:   source,
+			HTML:     string(node.Markdown),
+			Log:      node.Log,
+		})
+	case formatPDF:
+		node.ToMarkdown()
+		node.Title = node.Meta["title"]
+		writePDF(w, &Book{
+			Title:    currentSettings().Title,
+			Lang:     language,
+			Basepath: strings.TrimSuffix(basepath, "/"),
+			Path:     node.Path,
+			Sections: []*Node{node},
+		})
+	}
+}
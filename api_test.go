@@ -0,0 +1,99 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// postMeta posts metadata of a page to the API as JSON.
+func postMeta(r func(*http.Request) *http.Request, page, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/api/meta"+page+"?author=tester", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if r != nil {
+		req = r(req)
+	}
+	w := httptest.NewRecorder()
+	metaHandler(w, req)
+	return w
+}
+
+func TestMetaAPI(t *testing.T) {
+	newTestWiki(t, map[string]string{"a.md": "# A\n"})
+
+	w := postMeta(nil, "/a", `{"owner": "Jane", "tags": ["howto"]}`)
+	if w.Code != http.StatusOK || readSidecar("a.md")["tags"] != "[howto]" {
+		t.Errorf("POST of metadata answered %d %q", w.Code, w.Body)
+	}
+
+	// Other sites can post forms and plain text without a preflight
+	for _, contentType := range []string{"text/plain", "application/x-www-form-urlencoded", ""} {
+		r := httptest.NewRequest("POST", "/api/meta/a?author=tester", strings.NewReader(`{"owner": "Mallory"}`))
+		r.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		metaHandler(w, r)
+		if w.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("POST of metadata as %q answered %d, want 415", contentType, w.Code)
+		}
+	}
+	if got := readSidecar("a.md")["owner"]; got != "Jane" {
+		t.Errorf("owner = %q after rejected posts, want Jane", got)
+	}
+}
+
+func TestMetaAPIGuards(t *testing.T) {
+	dir := newTestWiki(t, map[string]string{
+		"a.md":              "# A\n",
+		"b.md":              "# B\n",
+		"b" + sidecarSuffix: `{"noindex": true, "owner": "Jane"}`,
+		"secret.md":         "---\nprotected: true\n---\n# Secret\n",
+		"static/s.md":       "# Static\n",
+	})
+	reserving(t, "/static/")
+	blocking(t, "casino")
+	withSubmodule(t, dir)
+
+	tests := []struct {
+		name   string
+		page   string
+		body   string
+		status int
+	}{
+		{"protecting", "/a", `{"protected": true}`, http.StatusForbidden},
+		{"unpublishing", "/a", `{"publish": "2999-01-01"}`, http.StatusForbidden},
+		{"taking aliases", "/a", `{"aliases": ["/b"]}`, http.StatusForbidden},
+		{"dropping noindex", "/b", `{"owner": "Mallory"}`, http.StatusForbidden},
+		{"changing noindex", "/b", `{"noindex": false, "owner": "Jane"}`, http.StatusForbidden},
+		{"keeping noindex", "/b", `{"noindex": true, "owner": "Mallory"}`, http.StatusOK},
+		{"protected page", "/secret", `{"owner": "Mallory"}`, http.StatusForbidden},
+		{"reserved page", "/static/s", `{"owner": "Mallory"}`, http.StatusBadRequest},
+		{"submodule page", "/lib/page", `{"owner": "Mallory"}`, http.StatusForbidden},
+		{"blocked content", "/a", `{"owner": "casino"}`, http.StatusForbidden},
+		{"missing page", "/missing", `{"owner": "Mallory"}`, http.StatusNotFound},
+	}
+	for _, test := range tests {
+		if w := postMeta(nil, test.page, test.body); w.Code != test.status {
+			t.Errorf("%s: POST %s answered %d, want %d", test.name, test.page, w.Code, test.status)
+		}
+	}
+	for _, file := range []string{"a", "secret", "static/s", "lib/page", "missing"} {
+		if _, err := os.Stat(filepath.Join(dir, file+sidecarSuffix)); err == nil {
+			t.Errorf("%s%s written", file, sidecarSuffix)
+		}
+	}
+
+	admin := asAdmin(t)
+	if w := postMeta(admin, "/a", `{"protected": true, "aliases": ["/c"]}`); w.Code != http.StatusOK {
+		t.Errorf("administrator POST of protected answered %d %q", w.Code, w.Body)
+	}
+	if !isProtected("/a", "a.md") {
+		t.Error("administrator could not protect a page through the API")
+	}
+}
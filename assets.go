@@ -0,0 +1,59 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"sync"
+)
+
+// assetHashes holds the content hashes of the static files by name, computed
+// once per run.
+var assetHashes = struct {
+	sync.Mutex
+	hashes map[string]string
+}{hashes: make(map[string]string)}
+
+// assetHash returns the content hash of a static file, empty if it can not
+// be read.
+func assetHash(name string) string {
+	assetHashes.Lock()
+	defer assetHashes.Unlock()
+	hash, ok := assetHashes.hashes[name]
+	if !ok {
+		if bytes, err := ioutil.ReadFile(path.Join("static", path.Clean("/"+name))); err == nil {
+			sum := sha256.Sum256(bytes)
+			hash = hex.EncodeToString(sum[:])[:12]
+		}
+		assetHashes.hashes[name] = hash
+	}
+	return hash
+}
+
+// asset returns the URL of a static file below the base path, versioned by
+// its content hash so that clients pick up changes, see -static-cache.
+func asset(name string) string {
+	url := "/static/" + name
+	if hash := assetHash(name); staticCache > 0 && hash != "" {
+		url += "?v=" + hash
+	}
+	return url
+}
+
+// withAssetCache lets clients cache static files requested with their
+// current hash for -static-cache seconds, as any change gives a new URL.
+func withAssetCache(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if v := r.URL.Query().Get("v"); staticCache > 0 && v != "" && v == assetHash(r.URL.Path) {
+			w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", staticCache))
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
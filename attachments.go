@@ -0,0 +1,65 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// isAttachment reports whether a file of the wiki is served as is rather than
+// as a page, such as an image next to the page showing it. Hidden files and
+// drafts are never served.
+func isAttachment(file string) bool {
+	ext := path.Ext(file)
+	if ext == "" || ext == draftSuffix {
+		return false
+	}
+	for _, pageExt := range extensions {
+		if ext == pageExt {
+			return false
+		}
+	}
+	for _, part := range strings.Split(file, "/") {
+		if strings.HasPrefix(part, ".") {
+			return false
+		}
+	}
+	return true
+}
+
+// serveAttachment writes the attachment at the request path, at the revision
+// given by the query or the latest one. Reports false when there is none, so
+// the path is handled as a page.
+func serveAttachment(w http.ResponseWriter, r *http.Request) bool {
+	file := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+	revision := r.FormValue("revision")
+	if !isAttachment(file) || (revision != "" && !revisionHash.MatchString(revision)) {
+		return false
+	}
+	content := store.Read(file, revision)
+	if len(content) == 0 {
+		return false
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Attachments can not be changed", http.StatusMethodNotAllowed)
+		return true
+	}
+	if dataTables && r.Method == http.MethodGet && !parseBool(r.FormValue("raw")) &&
+		serveDataTable(w, r, file, revision, content) {
+		return true
+	}
+	if revision == "" && defaultCache > 0 {
+		w.Header().Set("Cache-Control", "max-age="+strconv.Itoa(defaultCache))
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, path.Base(file), time.Time{}, bytes.NewReader(content))
+	return true
+}
@@ -0,0 +1,120 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// proxyUser returns the user authenticated by a trusted proxy in the
+// -auth-header, empty without one. The header is ignored from anyone else.
+func proxyUser(r *http.Request) string {
+	if authHeader == "" {
+		return ""
+	}
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peer = r.RemoteAddr
+	}
+	if !isTrustedProxy(peer) {
+		return ""
+	}
+	return strings.TrimSpace(r.Header.Get(authHeader))
+}
+
+// adminEnabled reports whether anyone can authenticate as the administrator.
+func adminEnabled() bool {
+	return adminPassword != "" || authHeader != ""
+}
+
+// isAdmin checks the request for the administrator credentials, or for the
+// -admin-user signed in at the proxy with -auth-header.
+func isAdmin(r *http.Request) bool {
+	if user := proxyUser(r); user != "" {
+		return user == adminUser
+	}
+	if adminPassword == "" {
+		return false
+	}
+	user, password, ok := r.BasicAuth()
+	return ok &&
+		subtle.ConstantTimeCompare([]byte(user), []byte(adminUser)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(password), []byte(adminPassword)) == 1
+}
+
+// requireAdmin asks for the administrator credentials when missing, and
+// returns whether the request may continue.
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if !adminEnabled() {
+		http.Error(w, "Administration is disabled", http.StatusForbidden)
+		return false
+	}
+	switch {
+	case isAdmin(r):
+		return true
+	case proxyUser(r) != "":
+		http.Error(w, "Administrators only", http.StatusForbidden)
+	case adminPassword == "":
+		// Signing in is up to the proxy
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	default:
+		w.Header().Set("WWW-Authenticate", `Basic realm="go-pages"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	}
+	return false
+}
+
+// withSignedIn rejects changes without a user signed in at the proxy, with
+// -auth-header.
+func withSignedIn(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if authHeader != "" && proxyUser(r) == "" {
+				http.Error(w, "Changes need a signed in user", http.StatusUnauthorized)
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// commitAuthor returns the author of the changes of a request: the user
+// signed in at the proxy with -auth-header, the administrator when
+// authenticated as one, otherwise the author form value, the author cookie
+// unless -no-author-cookie and finally -default-author. Empty if there is
+// none.
+func commitAuthor(r *http.Request) string {
+	if user := proxyUser(r); user != "" {
+		return user
+	}
+	if isAdmin(r) {
+		return adminUser
+	}
+	if author := strings.TrimSpace(r.FormValue("author")); author != "" {
+		return author
+	}
+	if cookie, err := r.Cookie("author"); err == nil && !noAuthorCookie && strings.TrimSpace(cookie.Value) != "" {
+		return strings.TrimSpace(cookie.Value)
+	}
+	return defaultAuthor
+}
+
+// rememberAuthor keeps the author given for a change in the author cookie,
+// unless it is already there or -no-author-cookie.
+func rememberAuthor(w http.ResponseWriter, r *http.Request) {
+	author := strings.TrimSpace(r.FormValue("author"))
+	if noAuthorCookie || author == "" || proxyUser(r) != "" {
+		return
+	}
+	if cookie, err := r.Cookie("author"); err == nil && cookie.Value == author {
+		return
+	}
+	setCookie(w, "author", author)
+}
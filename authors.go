@@ -0,0 +1,224 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Author is a committer of the wiki.
+type Author struct {
+	Name  string
+	Email string
+	Edits int
+}
+
+// shortlogLine matches the "count<tab>Name <email>" lines of git shortlog -sne.
+var shortlogLine = regexp.MustCompile(`^\s*(\d+)\t(.*?)\s*<([^>]*)>$`)
+
+// gitAuthors returns the committers of the wiki with their number of commits,
+// most active first.
+func gitAuthors() []*Author {
+	authors := make([]*Author, 0)
+	scanner := bufio.NewScanner(gitCmd(exec.Command("git", "shortlog", "-sne", "HEAD")))
+	for scanner.Scan() {
+		m := shortlogLine.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		edits, _ := strconv.Atoi(m[1])
+		authors = append(authors, &Author{Name: m[2], Email: m[3], Edits: edits})
+	}
+	return authors
+}
+
+// gitChanges returns up to limit of the latest commits of the wiki, linking
+// each to the page it changed. With an author, only the commits whose author
+// name or email contains it, ignoring case, are returned.
+func gitChanges(limit int, author string) []*Log {
+	return gitChangesDated(limit, author, logDate())
+}
+
+// gitChangesDated is gitChanges with the times in a git --date format.
+func gitChangesDated(limit int, author, date string) []*Log {
+	args := []string{"log", "--name-only", "--pretty=format:%x01%h%x00%ad%x00%an%x00%s",
+		date, "-n", strconv.Itoa(limit)}
+	if author != "" {
+		args = append(args, "--regexp-ignore-case", "--fixed-strings", "--author="+author)
+	}
+	args = append(args, "--", ".", excludeDrafts)
+	changes := make([]*Log, 0)
+	for _, entry := range bytes.Split(gitCmd(exec.Command("git", args...)).Bytes(), []byte("\x01")) {
+		lines := strings.Split(strings.TrimSpace(string(entry)), "\n")
+		change := parseLog([]byte(lines[0]))
+		if change == nil {
+			continue
+		}
+		for _, file := range lines[1:] {
+			for _, ext := range extensions {
+				if path.Ext(file) == ext && change.Page == "" {
+					change.Page = pageURL(file)
+				}
+			}
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// PageChange is a page added, modified or deleted since a tag, commit or
+// date, with the commits changing it.
+type PageChange struct {
+	Page    string
+	File    string
+	Status  string // added, modified or deleted
+	Commits []*Log
+}
+
+// sinceLayouts are the accepted date formats of /_changes?since=, dates
+// without a zone are in -timezone.
+var sinceLayouts = []string{"2006-01-02", "2006-01-02 15:04", "2006-01-02T15:04", time.RFC3339}
+
+// sinceRange returns the git log arguments for the commits since a tag,
+// commit or date, or false if it is neither.
+func sinceRange(since string) ([]string, bool) {
+	if since == "" || strings.HasPrefix(since, "-") {
+		return nil, false
+	}
+	if _, err := gitRun(exec.Command("git", "rev-parse", "--verify", "--quiet", since+"^{commit}")); err == nil {
+		return []string{since + "..HEAD"}, true
+	}
+	for _, layout := range sinceLayouts {
+		if t, err := time.ParseInLocation(layout, since, localZone()); err == nil {
+			return []string{"--since=" + t.Format(time.RFC3339), "HEAD"}, true
+		}
+	}
+	return nil, false
+}
+
+// isPageFile reports whether a file has a page extension.
+func isPageFile(file string) bool {
+	for _, ext := range extensions {
+		if path.Ext(file) == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// gitPageChanges returns the pages changed by the commits of a range, newest
+// change first.
+func gitPageChanges(commits []string) []*PageChange {
+	args := append([]string{"log", "--name-status", "--pretty=format:%x01%h%x00%ad%x00%an%x00%s", logDate()}, commits...)
+	args = append(args, "--", ".", excludeDrafts)
+	var changes []*PageChange
+	byFile := make(map[string]*PageChange)
+	for _, entry := range bytes.Split(gitCmd(exec.Command("git", args...)).Bytes(), []byte("\x01")) {
+		lines := strings.Split(strings.TrimSpace(string(entry)), "\n")
+		commit := parseLog([]byte(lines[0]))
+		if commit == nil {
+			continue
+		}
+		for _, line := range lines[1:] {
+			fields := strings.Split(line, "\t")
+			if len(fields) < 2 {
+				continue
+			}
+			// Renames and copies list the old and the new file
+			files := [][2]string{{fields[0][:1], fields[1]}}
+			if len(fields) == 3 && fields[0][0] == 'R' {
+				files = [][2]string{{"D", fields[1]}, {"A", fields[2]}}
+			} else if len(fields) == 3 && fields[0][0] == 'C' {
+				files = [][2]string{{"A", fields[2]}}
+			}
+			for _, f := range files {
+				if !isPageFile(f[1]) {
+					continue
+				}
+				change, ok := byFile[f[1]]
+				if !ok {
+					// The newest commit decides about deleted pages
+					change = &PageChange{Page: pageURL(f[1]), File: f[1], Status: "modified"}
+					if f[0] == "D" {
+						change.Status = "deleted"
+					}
+					byFile[f[1]] = change
+					changes = append(changes, change)
+				}
+				// and the oldest one about added ones
+				if f[0] == "A" && change.Status != "deleted" {
+					change.Status = "added"
+				} else if change.Status == "added" {
+					change.Status = "modified"
+				}
+				change.Commits = append(change.Commits, commit)
+			}
+		}
+	}
+	return changes
+}
+
+// changesHandler lists the pages changed since the tag, commit or date of
+// the since parameter, for summing up the changes of a release.
+func changesHandler(w http.ResponseWriter, r *http.Request) {
+	s := currentSettings()
+	node := &Node{
+		Path:     r.URL.Path,
+		Title:    s.Title,
+		Basepath: strings.TrimSuffix(basepath, "/"),
+		Template: "changes.tpl",
+		System:   true,
+		Since:    strings.TrimSpace(r.FormValue("since")),
+	}
+	commits, ok := sinceRange(node.Since)
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unknown tag, commit or date %q", node.Since), http.StatusBadRequest)
+		return
+	}
+	node.PageChanges = gitPageChanges(commits)
+	node.Dirs = listDirectories(r.URL.Path)
+	renderTemplate(w, node)
+}
+
+// authorsHandler lists the committers of the wiki.
+func authorsHandler(w http.ResponseWriter, r *http.Request) {
+	s := currentSettings()
+	node := &Node{
+		Path:     r.URL.Path,
+		Title:    s.Title,
+		Basepath: strings.TrimSuffix(basepath, "/"),
+		Template: "authors.tpl",
+		System:   true,
+		Authors:  cachedAuthors(),
+	}
+	node.Dirs = listDirectories(r.URL.Path)
+	renderTemplate(w, node)
+}
+
+// recentHandler lists the latest changes of the wiki, of a single author with
+// the author parameter.
+func recentHandler(w http.ResponseWriter, r *http.Request) {
+	s := currentSettings()
+	node := &Node{
+		Path:     r.URL.Path,
+		Title:    s.Title,
+		Basepath: strings.TrimSuffix(basepath, "/"),
+		Template: "changes.tpl",
+		System:   true,
+	}
+	node.ChangesBy = strings.TrimSpace(r.FormValue("author"))
+	node.Changes = gitChanges(s.LogLimit, node.ChangesBy)
+	node.Dirs = listDirectories(r.URL.Path)
+	renderTemplate(w, node)
+}
@@ -0,0 +1,119 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// wikiLink matches [[page]] and [[page|label]] links.
+var wikiLink = regexp.MustCompile(`\[\[([^\]|]+)(?:\|[^\]]*)?\]\]`)
+
+// buildBacklinks scans all pages for links to other pages of the wiki, and
+// returns the linking page files by the path of the page they link to.
+func buildBacklinks() map[string][]string {
+	backlinks := make(map[string][]string)
+	pages, _ := listPages("")
+	for _, file := range pages {
+		bytes, err := ioutil.ReadFile(path.Join(directory, file))
+		if err != nil {
+			log.Printf("Cant read file %q, error: %v", file, err)
+			continue
+		}
+		targets := make(map[string]bool)
+		for _, link := range pageLinks(bytes) {
+			if target, ok := linkTarget(file, link); ok {
+				targets[target] = true
+			}
+		}
+		for target := range targets {
+			backlinks[target] = append(backlinks[target], file)
+		}
+	}
+	for _, files := range backlinks {
+		sort.Strings(files)
+	}
+	return backlinks
+}
+
+// pageLinks returns the destinations of the markdown links and wikilinks of
+// a page.
+func pageLinks(source []byte) []string {
+	_, source = parseFrontMatter(source)
+	var links []string
+	doc := md.Parser().Parse(text.NewReader(source))
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if link, ok := node.(*ast.Link); ok && entering {
+			links = append(links, string(link.Destination))
+		}
+		return ast.WalkContinue, nil
+	})
+	for _, m := range wikiLink.FindAllSubmatch(source, -1) {
+		links = append(links, "/"+strings.TrimSpace(string(m[1])))
+	}
+	return links
+}
+
+// linkTarget resolves a link of a page file to the path of the page it links
+// to, such as /docs/index. Links leaving the wiki are not resolved.
+func linkTarget(file, link string) (string, bool) {
+	u, err := url.Parse(link)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return "", false
+	}
+	target := u.Path
+	if !strings.HasPrefix(target, "/") {
+		target = path.Join("/", path.Dir(file), target)
+	} else if prefix := strings.TrimSuffix(basepath, "/"); prefix != "" {
+		if target = strings.TrimPrefix(target, prefix); target == u.Path {
+			return "", false
+		}
+	}
+	target = path.Clean(target)
+	if target == "/" || strings.HasSuffix(u.Path, "/") {
+		target = indexPage(strings.TrimSuffix(target, "/") + "/")
+	}
+	for _, ext := range extensions {
+		target = strings.TrimSuffix(target, ext)
+	}
+	if isReserved(target) {
+		return "", false
+	}
+	return target, true
+}
+
+// backlinksHandler lists the pages linking to a page.
+func backlinksHandler(w http.ResponseWriter, r *http.Request) {
+	page := strings.TrimPrefix(r.URL.Path, "/_backlinks")
+	if page == "" || strings.HasSuffix(page, "/") {
+		page = indexPage("/" + strings.TrimPrefix(page, "/"))
+	}
+	s := currentSettings()
+	node := &Node{
+		Path:     page,
+		Title:    s.Title,
+		Basepath: strings.TrimSuffix(basepath, "/"),
+		Template: "backlinks.tpl",
+		System:   true,
+	}
+	for _, file := range cachedBacklinks()[page] {
+		node.Backlinks = append(node.Backlinks, &Directory{
+			Path: pageURL(file),
+			Name: strings.TrimSuffix(file, path.Ext(file)),
+		})
+	}
+	node.Dirs = listDirectories(page)
+	renderTemplate(w, node)
+}
@@ -0,0 +1,64 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// isBareRepository reports whether the data directory is a bare git repository.
+func isBareRepository() bool {
+	return strings.TrimSpace(gitCmd(exec.Command("git", "rev-parse", "--is-bare-repository")).String()) == "true"
+}
+
+// openBareRepository checks out the branch of the bare repository in the data
+// directory into a worktree of its own and returns the worktree path. Pages
+// are then read from and written to the worktree, with every commit landing
+// directly in the bare repository. The worktree is recreated on every start.
+func openBareRepository() (string, error) {
+	bare, err := filepath.Abs(directory)
+	if err != nil {
+		return "", err
+	}
+	worktree := filepath.Join(os.TempDir(), fmt.Sprintf("go-pages-%x", sha1.Sum([]byte(bare))))
+
+	// Drop the worktree of a previous run, it may be behind the branch
+	gitCmd(exec.Command("git", "worktree", "remove", "--force", worktree))
+	if err := os.RemoveAll(worktree); err != nil {
+		return "", err
+	}
+	gitCmd(exec.Command("git", "worktree", "prune"))
+
+	branch, err := gitRun(exec.Command("git", "symbolic-ref", "--short", "HEAD"))
+	if err != nil {
+		return "", err
+	}
+
+	// An empty repository has nothing to check out yet, start it with an
+	// empty commit
+	if _, err := gitRun(exec.Command("git", "rev-parse", "--verify", "--quiet", "HEAD")); err != nil {
+		tree, err := gitRun(exec.Command("git", "mktree"))
+		if err != nil {
+			return "", err
+		}
+		commit, err := gitRun(exec.Command("git", "commit-tree", strings.TrimSpace(tree.String()), "-m", "Initial commit"))
+		if err != nil {
+			return "", err
+		}
+		if _, err := gitRun(exec.Command("git", "update-ref", "HEAD", strings.TrimSpace(commit.String()))); err != nil {
+			return "", err
+		}
+	}
+
+	if _, err := gitRun(exec.Command("git", "worktree", "add", "--quiet", worktree, strings.TrimSpace(branch.String()))); err != nil {
+		return "", err
+	}
+	return worktree, nil
+}
@@ -0,0 +1,57 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// blockPattern is a pattern of the -blocklist file, with its line number
+// for the log.
+type blockPattern struct {
+	line    int
+	pattern *regexp.Regexp
+}
+
+// loadBlocklist reads a blocklist file of one regular expression per line,
+// skipping blank lines and comments starting with #. Patterns match whole
+// words regardless of case, so "spam" matches "SPAM!" but not "spammer".
+func loadBlocklist(file string) ([]blockPattern, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var patterns []blockPattern
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		// \b only knows ASCII letters, so word boundaries are spelled out
+		pattern, err := regexp.Compile(`(?i)(?:^|[^\pL\pN_])(?:` + entry + `)(?:[^\pL\pN_]|$)`)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		patterns = append(patterns, blockPattern{line: line, pattern: pattern})
+	}
+	return patterns, scanner.Err()
+}
+
+// blockedLine returns the line of the first -blocklist pattern the content
+// matches, or 0 if none does.
+func blockedLine(content string) int {
+	for _, p := range blocklist {
+		if p.pattern.MatchString(content) {
+			return p.line
+		}
+	}
+	return 0
+}
@@ -0,0 +1,80 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// blocking rejects changes matching the patterns of a blocklist file until
+// the end of the test.
+func blocking(t *testing.T, content string) {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "blocklist.txt")
+	writeTestFile(t, file, content)
+	patterns, err := loadBlocklist(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := blocklist
+	blocklist = patterns
+	t.Cleanup(func() { blocklist = old })
+}
+
+func TestBlockedLine(t *testing.T) {
+	blocking(t, "# Spam words\n\nspam\ncheap (pills|watches)\n  casino  \nstraße\n")
+	tests := []struct {
+		content string
+		line    int
+	}{
+		{"A normal page about gardening.", 0},
+		{"Buy spam now", 3},
+		{"SPAM!", 3},
+		{"(spam)", 3},
+		{"spam", 3},
+		{"a spammer", 0},
+		{"antispam", 0},
+		{"spam_filter", 0},
+		{"Very cheap pills here", 4},
+		{"cheap\twatches", 0},
+		{"cheap pillsbury", 0},
+		{"Online Casino.", 5},
+		{"casinos", 0},
+		{"Große STRASSE", 0},
+		{"Die Straße.", 6},
+		{"Straßenbahn", 0},
+		{"spam and casino", 3},
+	}
+	for _, test := range tests {
+		if got := blockedLine(test.content); got != test.line {
+			t.Errorf("blockedLine(%q) = %d, want %d", test.content, got, test.line)
+		}
+	}
+}
+
+func TestInvalidBlocklist(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "blocklist.txt")
+	writeTestFile(t, file, "fine\n(unclosed\n")
+	if _, err := loadBlocklist(file); err == nil || err.Error()[:7] != "line 2:" {
+		t.Errorf("loadBlocklist with an invalid pattern = %v, want an error at line 2", err)
+	}
+}
+
+func TestBlockedChangeRejected(t *testing.T) {
+	dir := newTestWiki(t, map[string]string{"a.md": "old\n"})
+	blocking(t, "spam\n")
+	if w := postPage(t, nil, "/a", "Buy SPAM today\n"); w.Code != http.StatusForbidden {
+		t.Errorf("saving a blocked change answered %d, want 403", w.Code)
+	}
+	if bytes, _ := os.ReadFile(filepath.Join(dir, "a.md")); string(bytes) != "old\n" {
+		t.Errorf("a.md is %q after a blocked change", bytes)
+	}
+	if w := postPage(t, nil, "/a", "Nothing to see, spammers\n"); w.Code == http.StatusForbidden {
+		t.Error("saving a change without blocked words answered 403")
+	}
+}
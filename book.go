@@ -0,0 +1,158 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os/exec"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Book holds the pages of a directory combined into a single document.
+type Book struct {
+	Title    string
+	Lang     string
+	Basepath string
+	Path     string
+	Sections []*Node
+	More     []string // Directories too deep to be included
+
+	PrintCSS template.CSS // Inlined for PDF exports, which can not fetch it
+}
+
+// sectionTitle returns the front matter title of a node, or its file name.
+func sectionTitle(node *Node) string {
+	if title := node.Meta["title"]; title != "" {
+		return title
+	}
+	return strings.TrimSuffix(node.File, path.Ext(node.File))
+}
+
+// sortSections orders nodes by their front matter order, followed by the
+// ones without an order by file name.
+func sortSections(sections []*Node) {
+	sort.SliceStable(sections, func(i, j int) bool {
+		a, errA := strconv.Atoi(sections[i].Meta["order"])
+		b, errB := strconv.Atoi(sections[j].Meta["order"])
+		switch {
+		case errA == nil && errB == nil && a != b:
+			return a < b
+		case errA == nil && errB != nil:
+			return true
+		case errA != nil && errB == nil:
+			return false
+		}
+		return sections[i].File < sections[j].File
+	})
+}
+
+func bookHandler(w http.ResponseWriter, r *http.Request) {
+	dir := strings.Trim(strings.TrimPrefix(r.URL.Path, "/_book"), "/")
+	book := &Book{
+		Title:    currentSettings().Title,
+		Lang:     language,
+		Basepath: strings.TrimSuffix(basepath, "/"),
+		Path:     "/" + dir,
+	}
+	pages, more := listPages(dir)
+	book.More = more
+	for _, file := range pages {
+		bytes, err := ioutil.ReadFile(path.Join(directory, file))
+		if err != nil {
+			log.Printf("Cant read file %q, error: %v", file, err)
+			continue
+		}
+		if isUnpublished(file, bytes) && !isAdmin(r) {
+			continue
+		}
+		node := &Node{File: file, Bytes: bytes}
+		node.ToMarkdown()
+		node.Title = sectionTitle(node)
+		book.Sections = append(book.Sections, node)
+	}
+	if len(book.Sections) == 0 && len(book.More) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	sortSections(book.Sections)
+
+	if r.FormValue("format") == "pdf" {
+		writePDF(w, book)
+		return
+	}
+
+	// Executing the base template would prevent cloning it later on
+	t, err := baseTemplate.Clone()
+	if err != nil {
+		log.Fatalln("Could not clone baseTemplate:", err)
+	}
+	if err := t.ExecuteTemplate(w, "book.tpl", book); err != nil {
+		log.Printf("Could not execute template: %v", err)
+	}
+}
+
+// pdfWriter sends the PDF headers along with the first output of the
+// -pdf-command, so that a command failing early still gets an error page.
+type pdfWriter struct {
+	w       http.ResponseWriter
+	written bool
+}
+
+func (p *pdfWriter) Write(b []byte) (int, error) {
+	if !p.written {
+		p.w.Header().Set("Content-Type", "application/pdf")
+		p.written = true
+	}
+	return p.w.Write(b)
+}
+
+// writePDF renders a book to HTML with the print styles inlined, and streams
+// it converted by the -pdf-command.
+func writePDF(w http.ResponseWriter, book *Book) {
+	args := strings.Fields(pdfCommand)
+	if len(args) == 0 {
+		http.Error(w, "PDF export is not configured", http.StatusNotImplemented)
+		return
+	}
+	if css, err := ioutil.ReadFile("static/css/print.css"); err == nil {
+		book.PrintCSS = template.CSS(css)
+	}
+
+	// Executing the base template would prevent cloning it later on
+	t, err := baseTemplate.Clone()
+	if err != nil {
+		log.Fatalln("Could not clone baseTemplate:", err)
+	}
+	var html, errBuf bytes.Buffer
+	if err := t.ExecuteTemplate(&html, "book.tpl", book); err != nil {
+		log.Printf("Could not execute template: %v", err)
+		http.Error(w, "Could not render page", http.StatusInternalServerError)
+		return
+	}
+	out := &pdfWriter{w: w}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = &html
+	cmd.Stdout = out
+	cmd.Stderr = &errBuf
+	err = cmd.Run()
+	switch {
+	case errors.Is(err, exec.ErrNotFound):
+		log.Printf("Error: PDF command %q is not installed", args[0])
+		http.Error(w, "PDF export is not available", http.StatusServiceUnavailable)
+	case err != nil:
+		log.Printf("Error: command %q failed (%v) with: %s", pdfCommand, err, errBuf.String())
+		if !out.written {
+			http.Error(w, "Could not convert to PDF", http.StatusInternalServerError)
+		}
+	}
+}
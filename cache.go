@@ -0,0 +1,247 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// pageCache holds the directory walks of listPages until the next commit, or
+// until they are older than cacheTTL.
+var pageCache = struct {
+	sync.Mutex
+	pages   map[string]pageListing
+	expires time.Time
+}{}
+
+// pageListing is a directory walk of listPages.
+type pageListing struct {
+	pages []string
+	more  []string // Directories below -max-depth, which were not walked
+}
+
+// cachedPages returns the cached pages of a directory.
+func cachedPages(dir string) (pageListing, bool) {
+	pageCache.Lock()
+	defer pageCache.Unlock()
+	if time.Now().After(pageCache.expires) {
+		pageCache.pages = nil
+		cacheMetric("pages", false)
+		return pageListing{}, false
+	}
+	pages, ok := pageCache.pages[dir]
+	cacheMetric("pages", ok)
+	return pages, ok
+}
+
+// cachePages stores the pages of a directory.
+func cachePages(dir string, pages pageListing) {
+	pageCache.Lock()
+	defer pageCache.Unlock()
+	if pageCache.pages == nil {
+		pageCache.pages = make(map[string]pageListing)
+		pageCache.expires = time.Now().Add(cacheTTL)
+	}
+	pageCache.pages[dir] = pages
+}
+
+// fileCache holds the files known to git, see gitFiles.
+var fileCache = struct {
+	sync.Mutex
+	files   map[string]bool
+	expires time.Time
+}{}
+
+// cachedGitFiles returns the files known to git, querying git only once until
+// the next commit or cacheTTL. Returns nil when git could not list them.
+func cachedGitFiles() map[string]bool {
+	fileCache.Lock()
+	defer fileCache.Unlock()
+	hit := fileCache.files != nil && time.Now().Before(fileCache.expires)
+	cacheMetric("files", hit)
+	if !hit {
+		fileCache.files = gitFiles()
+		fileCache.expires = time.Now().Add(cacheTTL)
+	}
+	return fileCache.files
+}
+
+// backlinkCache holds the backlinks of buildBacklinks, see pageCache.
+var backlinkCache = struct {
+	sync.Mutex
+	links   map[string][]string
+	expires time.Time
+}{}
+
+// cachedBacklinks returns the linking page files by the page they link to,
+// scanning the pages only once until the next commit or cacheTTL.
+func cachedBacklinks() map[string][]string {
+	backlinkCache.Lock()
+	defer backlinkCache.Unlock()
+	hit := backlinkCache.links != nil && time.Now().Before(backlinkCache.expires)
+	cacheMetric("backlinks", hit)
+	if !hit {
+		backlinkCache.links = buildBacklinks()
+		backlinkCache.expires = time.Now().Add(cacheTTL)
+	}
+	return backlinkCache.links
+}
+
+// aliasCache holds the page aliases of buildAliases, see pageCache.
+var aliasCache = struct {
+	sync.Mutex
+	aliases map[string]string
+	expires time.Time
+}{}
+
+// cachedAliases returns the page URLs by alias, scanning the pages only once
+// until the next commit or cacheTTL.
+func cachedAliases() map[string]string {
+	aliasCache.Lock()
+	defer aliasCache.Unlock()
+	hit := aliasCache.aliases != nil && time.Now().Before(aliasCache.expires)
+	cacheMetric("aliases", hit)
+	if !hit {
+		aliasCache.aliases = buildAliases()
+		aliasCache.expires = time.Now().Add(cacheTTL)
+	}
+	return aliasCache.aliases
+}
+
+// authorCache holds the committers of gitAuthors, see pageCache.
+var authorCache = struct {
+	sync.Mutex
+	authors []*Author
+	expires time.Time
+}{}
+
+// cachedAuthors returns the committers of the wiki, querying git only once
+// until the next commit or cacheTTL.
+func cachedAuthors() []*Author {
+	authorCache.Lock()
+	defer authorCache.Unlock()
+	hit := authorCache.authors != nil && time.Now().Before(authorCache.expires)
+	cacheMetric("authors", hit)
+	if !hit {
+		authorCache.authors = gitAuthors()
+		authorCache.expires = time.Now().Add(cacheTTL)
+	}
+	return authorCache.authors
+}
+
+// submoduleCache holds the submodule paths of gitSubmodules, see pageCache.
+var submoduleCache = struct {
+	sync.Mutex
+	submodules []string
+	expires    time.Time
+}{}
+
+// cachedSubmodules returns the submodule paths of the wiki repository,
+// querying git only once until the next commit or cacheTTL.
+func cachedSubmodules() []string {
+	submoduleCache.Lock()
+	defer submoduleCache.Unlock()
+	hit := submoduleCache.expires.After(time.Now())
+	cacheMetric("submodules", hit)
+	if !hit {
+		submoduleCache.submodules = gitSubmodules()
+		submoduleCache.expires = time.Now().Add(cacheTTL)
+	}
+	return submoduleCache.submodules
+}
+
+// layoutCache holds the parsed layouts of parseLayouts by directory, see
+// pageCache.
+var layoutCache = struct {
+	sync.Mutex
+	layouts map[string]parsedLayouts
+	expires time.Time
+}{}
+
+// cachedLayouts returns the parsed layouts of the pages of a directory,
+// reading them only once until the next commit or cacheTTL.
+func cachedLayouts(dir string) parsedLayouts {
+	layoutCache.Lock()
+	defer layoutCache.Unlock()
+	if layoutCache.layouts == nil || time.Now().After(layoutCache.expires) {
+		layoutCache.layouts = make(map[string]parsedLayouts)
+		layoutCache.expires = time.Now().Add(cacheTTL)
+	}
+	layouts, hit := layoutCache.layouts[dir]
+	cacheMetric("layouts", hit)
+	if !hit {
+		layouts = parseLayouts(dir)
+		layoutCache.layouts[dir] = layouts
+	}
+	return layouts
+}
+
+// summaryCache holds the summaries of page files by file name, each valid
+// until the file is modified.
+var summaryCache = struct {
+	sync.Mutex
+	summaries map[string]pageSummary
+}{summaries: make(map[string]pageSummary)}
+
+// cachedSummary returns the summary of a page file, reading the file only
+// when it changed since.
+func cachedSummary(file string) (pageSummary, bool) {
+	info, err := os.Stat(path.Join(directory, file))
+	if err != nil {
+		return pageSummary{}, false
+	}
+	summaryCache.Lock()
+	summary, hit := summaryCache.summaries[file]
+	hit = hit && summary.modTime.Equal(info.ModTime())
+	summaryCache.Unlock()
+	cacheMetric("summaries", hit)
+	if hit {
+		return summary, true
+	}
+	summary, ok := summaryFile(file)
+	if !ok {
+		return summary, false
+	}
+	summary.modTime = info.ModTime()
+	summaryCache.Lock()
+	summaryCache.summaries[file] = summary
+	summaryCache.Unlock()
+	return summary, true
+}
+
+// invalidateCaches drops everything derived from the wiki content, it is
+// called whenever the content changes.
+func invalidateCaches() {
+	pageCache.Lock()
+	pageCache.pages = nil
+	pageCache.Unlock()
+
+	fileCache.Lock()
+	fileCache.files = nil
+	fileCache.Unlock()
+
+	backlinkCache.Lock()
+	backlinkCache.links = nil
+	backlinkCache.Unlock()
+
+	aliasCache.Lock()
+	aliasCache.aliases = nil
+	aliasCache.Unlock()
+
+	authorCache.Lock()
+	authorCache.authors = nil
+	authorCache.Unlock()
+
+	submoduleCache.Lock()
+	submoduleCache.expires = time.Time{}
+	submoduleCache.Unlock()
+
+	layoutCache.Lock()
+	layoutCache.layouts = nil
+	layoutCache.Unlock()
+}
@@ -0,0 +1,52 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// bigTree returns the files of a wiki with thousands of directories.
+func bigTree() map[string]string {
+	files := make(map[string]string)
+	for i := 0; i < 50; i++ {
+		for j := 0; j < 40; j++ {
+			files[fmt.Sprintf("d%d/e%d/page.md", i, j)] = "# Page\n"
+		}
+	}
+	return files
+}
+
+func TestPageCacheDroppedOnCommit(t *testing.T) {
+	newTestWiki(t, map[string]string{"a.md": "a\n"})
+	if pages, _ := listPages(""); len(pages) != 1 {
+		t.Fatalf("listPages = %v, want a.md only", pages)
+	}
+	if err := store.Write("b.md", []byte("b\n"), "tester", "Create"); err != nil {
+		t.Fatal(err)
+	}
+	if pages, _ := listPages(""); len(pages) != 2 {
+		t.Errorf("listPages after a commit = %v, want a.md and b.md", pages)
+	}
+}
+
+func BenchmarkListPages(b *testing.B) {
+	newTestWiki(b, bigTree())
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			invalidateCaches()
+			listPages("")
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		invalidateCaches()
+		listPages("")
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			listPages("")
+		}
+	})
+}
@@ -0,0 +1,47 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+)
+
+// csrfSecret signs the form tokens of a run, so that restarting the wiki
+// invalidates them.
+var csrfSecret = func() []byte {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Fatalf("WARNING: could not create the form token secret: %v", err)
+	}
+	return secret
+}()
+
+// csrfToken returns the form token of the administrator of a request. Browsers
+// send Basic credentials along with requests of any other site, the token in
+// the form proves that the form came from the wiki.
+func csrfToken(r *http.Request) string {
+	user := proxyUser(r)
+	if user == "" {
+		user = adminUser
+	}
+	mac := hmac.New(sha256.New, csrfSecret)
+	mac.Write([]byte("csrf\x00" + user))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// checkCSRF answers a 403 unless the csrf form value of a request is its form
+// token, see csrfToken.
+func checkCSRF(w http.ResponseWriter, r *http.Request) bool {
+	if hmac.Equal([]byte(r.PostFormValue("csrf")), []byte(csrfToken(r))) {
+		return true
+	}
+	http.Error(w, "The form has expired, reload the page and try again", http.StatusForbidden)
+	return false
+}
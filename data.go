@@ -0,0 +1,63 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// dataDelimiter returns the field delimiter of a data file, see
+// -data-tables.
+func dataDelimiter(file string) (rune, bool) {
+	switch strings.ToLower(path.Ext(file)) {
+	case ".csv":
+		return csvDelimiter, true
+	case ".tsv":
+		return '\t', true
+	}
+	return 0, false
+}
+
+// serveDataTable renders a CSV or TSV attachment as a table, its first
+// record being the header. Reports false when it can not be parsed, so it is
+// served as is.
+func serveDataTable(w http.ResponseWriter, r *http.Request, file, revision string, content []byte) bool {
+	delimiter, ok := dataDelimiter(file)
+	if !ok {
+		return false
+	}
+	reader := csv.NewReader(bytes.NewReader(stripBOM(content)))
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		log.Printf("Cant parse data file %q, error: %v", file, err)
+		return false
+	}
+	s := currentSettings()
+	node := &Node{
+		File:     file,
+		Path:     r.URL.Path,
+		Title:    s.Title,
+		Basepath: strings.TrimSuffix(basepath, "/"),
+		Revision: revision,
+		Template: "data.tpl",
+		System:   true,
+	}
+	if len(records) > 0 {
+		node.DataHeader, node.DataRows = records[0], records[1:]
+	}
+	node.Dirs = listDirectories(r.URL.Path)
+	if revision == "" {
+		setCacheControl(w, node)
+	}
+	renderTemplate(w, node)
+	return true
+}
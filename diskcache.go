@@ -0,0 +1,190 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yuin/goldmark/parser"
+)
+
+// diskCache tracks the size of the renderings in -disk-cache-dir.
+var diskCache = struct {
+	sync.Mutex
+	size    int64
+	pruning bool
+}{}
+
+// renderVersion changes with the rendering of markdown, so that renderings of
+// older versions are not served.
+const renderVersion = 2
+
+// renderKey identifies the rendering of markdown, which only depends on the
+// source, the heading offset and the flags. Changed pages get new keys, so
+// writes never leave stale renderings behind.
+func renderKey(source []byte, offset int) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d %q %d\n", renderVersion, os.Args[1:], offset)
+	h.Write(source)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// renderFile returns the file of a cached rendering.
+func renderFile(key string) string {
+	return filepath.Join(diskCacheDir, key[:2], key+".html.gz")
+}
+
+// renderCached renders markdown through the disk cache, returning the HTML
+// and its gzip variant.
+func renderCached(source []byte, offset int) ([]byte, []byte) {
+	key := renderKey(source, offset)
+	file := renderFile(key)
+	if gz, err := ioutil.ReadFile(file); err == nil {
+		if html, err := gunzip(gz); err == nil {
+			cacheMetric("disk", true)
+			// Recently used renderings are pruned last
+			now := time.Now()
+			os.Chtimes(file, now, now)
+			return html, gz
+		}
+	}
+	cacheMetric("disk", false)
+	var buf bytes.Buffer
+	if err := md.Convert(source, &buf, parser.WithContext(newParserContext(offset))); err != nil {
+		panic(err)
+	}
+	html := buf.Bytes()
+	gz := gzipBytes(html)
+	if err := writeRendered(file, gz); err != nil {
+		log.Printf("Cant cache rendering %q, error: %v", file, err)
+	}
+	return html, gz
+}
+
+// writeRendered writes a rendering in one go, so that readers never see a
+// partial one, pruning the cache once it outgrows -disk-cache-bytes.
+func writeRendered(file string, gz []byte) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(file), ".render-")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(gz)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), file)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	diskCache.Lock()
+	diskCache.size += int64(len(gz))
+	prune := diskCacheBytes > 0 && diskCache.size > diskCacheBytes && !diskCache.pruning
+	diskCache.pruning = diskCache.pruning || prune
+	diskCache.Unlock()
+	if prune {
+		go pruneDiskCache()
+	}
+	return nil
+}
+
+// loadDiskCache creates -disk-cache-dir, or sums up the renderings kept in
+// it by an earlier run.
+func loadDiskCache() error {
+	if err := os.MkdirAll(diskCacheDir, 0755); err != nil {
+		return err
+	}
+	return filepath.Walk(diskCacheDir, func(file string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			diskCache.size += info.Size()
+		}
+		return err
+	})
+}
+
+// pruneDiskCache removes the least recently used renderings until the cache
+// is down to 90% of -disk-cache-bytes.
+func pruneDiskCache() {
+	type rendering struct {
+		file string
+		size int64
+		used time.Time
+	}
+	var renderings []rendering
+	var size int64
+	filepath.Walk(diskCacheDir, func(file string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && strings.HasSuffix(file, ".html.gz") {
+			renderings = append(renderings, rendering{file, info.Size(), info.ModTime()})
+			size += info.Size()
+		}
+		return nil
+	})
+	sort.Slice(renderings, func(i, j int) bool { return renderings[i].used.Before(renderings[j].used) })
+	removed := 0
+	for _, r := range renderings {
+		if size <= diskCacheBytes*9/10 {
+			break
+		}
+		if err := os.Remove(r.file); err == nil {
+			size -= r.size
+			removed++
+		}
+	}
+	log.Printf("Pruned %d renderings from the disk cache", removed)
+
+	diskCache.Lock()
+	diskCache.size = size
+	diskCache.pruning = false
+	diskCache.Unlock()
+}
+
+// gzipBytes compresses content with gzip.
+func gzipBytes(content []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(content)
+	w.Close()
+	return buf.Bytes()
+}
+
+// gunzip decompresses gzip content.
+func gunzip(gz []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(gz))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// acceptsGzip reports whether the client takes gzip encoded responses.
+func acceptsGzip(r *http.Request) bool {
+	for _, entry := range parseList(r.Header.Get("Accept-Encoding")) {
+		parts := strings.Split(entry, ";")
+		if strings.TrimSpace(parts[0]) == "gzip" {
+			return len(parts) == 1 || strings.ReplaceAll(strings.TrimSpace(parts[1]), " ", "") != "q=0"
+		}
+	}
+	return false
+}
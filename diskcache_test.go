@@ -0,0 +1,149 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yuin/goldmark/parser"
+)
+
+// usingDiskCache renders through a new disk cache until the end of the test.
+func usingDiskCache(t testing.TB, limit int64) string {
+	t.Helper()
+	oldDir, oldBytes := diskCacheDir, diskCacheBytes
+	diskCacheDir, diskCacheBytes = t.TempDir(), limit
+	diskCache.size = 0
+	if err := loadDiskCache(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { diskCacheDir, diskCacheBytes = oldDir, oldBytes })
+	return diskCacheDir
+}
+
+// renderings returns the files of the disk cache.
+func renderings(t testing.TB, dir string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*", "*.html.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// bigPage returns the markdown of a long page.
+func bigPage() []byte {
+	var b strings.Builder
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&b, "## Section %d\n\nSome *text* with a [link](page%d) and `code`.\n\n- a\n- b\n\n", i, i)
+	}
+	return []byte(b.String())
+}
+
+func TestDiskCacheInvalidatedOnWrite(t *testing.T) {
+	newTestWiki(t, map[string]string{"a.md": "# Old\n"})
+	dir := usingDiskCache(t, 0)
+
+	get := func() string {
+		w := httptest.NewRecorder()
+		wikiHandler(w, httptest.NewRequest("GET", "/a", nil))
+		return w.Body.String()
+	}
+	if !strings.Contains(get(), `<h1 id="old">`) {
+		t.Fatal("the page is not rendered")
+	}
+	if files := renderings(t, dir); len(files) != 1 {
+		t.Fatalf("%d renderings cached, want 1", len(files))
+	}
+	get()
+	if files := renderings(t, dir); len(files) != 1 {
+		t.Errorf("%d renderings cached after a hit, want 1", len(files))
+	}
+
+	if err := store.Write("a.md", []byte("# New\n"), "tester", "Update"); err != nil {
+		t.Fatal(err)
+	}
+	if body := get(); !strings.Contains(body, `<h1 id="new">`) || strings.Contains(body, `<h1 id="old">`) {
+		t.Error("the cached rendering is served after a change")
+	}
+}
+
+func TestDiskCacheHit(t *testing.T) {
+	usingDiskCache(t, 0)
+	source := bigPage()
+	html, gz := renderCached(source, 0)
+	cached, cachedGz := renderCached(source, 0)
+	if !bytes.Equal(html, cached) || !bytes.Equal(gz, cachedGz) {
+		t.Error("the cached rendering differs")
+	}
+	var buf bytes.Buffer
+	if err := md.Convert(source, &buf, parser.WithContext(newParserContext(0))); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(html, buf.Bytes()) {
+		t.Error("the cached rendering differs from rendering the page")
+	}
+	if unzipped, err := gunzip(gz); err != nil || !bytes.Equal(unzipped, html) {
+		t.Errorf("the gzip variant does not hold the rendering: %v", err)
+	}
+	if offset, _ := renderCached(source, 1); bytes.Equal(offset, html) {
+		t.Error("a heading offset got the rendering without it")
+	}
+}
+
+func TestDiskCachePrune(t *testing.T) {
+	dir := usingDiskCache(t, 4096)
+	var first string
+	for i := 0; i < 50; i++ {
+		renderCached([]byte(fmt.Sprintf("# Page %d\n\n%s\n", i, strings.Repeat("word ", 100+i))), 0)
+		if i == 0 {
+			first = renderings(t, dir)[0]
+			// Pruning goes by the time of the last use
+			old := time.Now().Add(-time.Hour)
+			os.Chtimes(first, old, old)
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		diskCache.Lock()
+		size, pruning := diskCache.size, diskCache.pruning
+		diskCache.Unlock()
+		if !pruning && size <= 4096 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the disk cache holds %d bytes, beyond -disk-cache-bytes", size)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := os.Stat(first); !os.IsNotExist(err) {
+		t.Error("the least recently used rendering was kept")
+	}
+}
+
+func BenchmarkRender(b *testing.B) {
+	source := bigPage()
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var buf bytes.Buffer
+			md.Convert(source, &buf, parser.WithContext(newParserContext(0)))
+		}
+	})
+	b.Run("disk", func(b *testing.B) {
+		usingDiskCache(b, 0)
+		renderCached(source, 0)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			renderCached(source, 0)
+		}
+	})
+}
@@ -0,0 +1,45 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+)
+
+// draftSuffix marks the unpublished draft of a page, committed next to it.
+// Drafts do not have a page extension, so they are never listed as pages.
+const draftSuffix = ".draft"
+
+// excludeDrafts is the git pathspec leaving the drafts out of the changes and
+// histories of the wiki until they are published.
+const excludeDrafts = ":(exclude)*" + draftSuffix
+
+// draftNode returns the node holding the draft of a page.
+func (node *Node) draftNode() *Node {
+	return &Node{File: node.File + draftSuffix}
+}
+
+// readDraft returns the draft of a page, if there is one.
+func (node *Node) readDraft() ([]byte, bool) {
+	bytes, err := ioutil.ReadFile(path.Join(directory, node.draftNode().File))
+	return bytes, err == nil
+}
+
+// saveDraft writes and commits the draft of a page, leaving the page as is.
+func (node *Node) saveDraft(content []byte, msg, author string) error {
+	defer node.span("Write")()
+	return store.Write(node.draftNode().File, content, author, "Draft: "+msg)
+}
+
+// publishDraft replaces the page with its draft in a single commit.
+func (node *Node) publishDraft(author string) error {
+	content, ok := node.readDraft()
+	if !ok {
+		return fmt.Errorf("no draft of %q", node.File)
+	}
+	return node.write(content, author, fmt.Sprintf("Publish %s", node.File), node.draftNode().File)
+}
@@ -0,0 +1,46 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDraftsStayOutOfChanges(t *testing.T) {
+	newTestWiki(t, map[string]string{"a.md": "live\n"})
+	node := &Node{File: "a.md"}
+	if err := node.saveDraft([]byte("secret plans\n"), "Unpublished idea", "tester"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, change := range gitChanges(10, "") {
+		if strings.Contains(change.Message, "Unpublished idea") {
+			t.Errorf("the draft commit %q is listed in the latest changes", change.Message)
+		}
+	}
+	for _, change := range gitPageChanges([]string{"HEAD"}) {
+		for _, commit := range change.Commits {
+			if strings.Contains(commit.Message, "Unpublished idea") {
+				t.Errorf("the draft commit %q is listed in the changes of %s", commit.Message, change.File)
+			}
+		}
+	}
+	for _, commit := range store.History("a.md", 10) {
+		if strings.Contains(commit.Message, "Unpublished idea") {
+			t.Errorf("the draft commit %q is listed in the page history", commit.Message)
+		}
+	}
+
+	if err := node.publishDraft("tester"); err != nil {
+		t.Fatal(err)
+	}
+	if changes := gitChanges(1, ""); len(changes) != 1 || changes[0].Message != "Publish a.md" || changes[0].Page == "" {
+		t.Errorf("latest changes after publishing = %+v, want the publishing commit of the page", changes)
+	}
+	if history := store.History("a.md", 1); len(history) != 1 || history[0].Message != "Publish a.md" {
+		t.Errorf("page history after publishing = %+v, want the publishing commit", history)
+	}
+}
@@ -0,0 +1,38 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// utf8BOM is the byte order mark some editors put at the start of files.
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// stripBOM drops a leading byte order mark, which would otherwise render as
+// a stray character at the top of the page.
+func stripBOM(content []byte) []byte {
+	return bytes.TrimPrefix(content, utf8BOM)
+}
+
+// normalizeContent checks the encoding of saved content as configured by
+// -encoding-check: reject fails on invalid UTF-8, replace swaps invalid bytes
+// for U+FFFD and off keeps content as is. Other than off, it strips a BOM.
+func normalizeContent(content string) (string, error) {
+	if encodingCheck == "off" {
+		return content, nil
+	}
+	content = strings.TrimPrefix(content, string(utf8BOM))
+	if utf8.ValidString(content) {
+		return content, nil
+	}
+	if encodingCheck == "replace" {
+		return strings.ToValidUTF8(content, "\uFFFD"), nil
+	}
+	return "", errors.New("invalid UTF-8")
+}
@@ -0,0 +1,84 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeContent(t *testing.T) {
+	defer func(old string) { encodingCheck = old }(encodingCheck)
+	tests := []struct {
+		check   string
+		content string
+		want    string
+		invalid bool
+	}{
+		{"reject", "plain", "plain", false},
+		{"reject", "\xef\xbb\xbf# Title", "# Title", false},
+		{"reject", "\xef\xbb\xbf\xef\xbb\xbfTwice", "\xef\xbb\xbfTwice", false},
+		{"reject", "mid \xef\xbb\xbf text", "mid \xef\xbb\xbf text", false},
+		{"reject", "Gr\xfc\xdfe", "", true},
+		{"reject", "\xef\xbb\xbfcut \xe2\x82", "", true},
+		{"reject", "overlong \xc0\xaf", "", true},
+		{"replace", "Gr\xfc\xdfe", "Gr�e", false},
+		{"replace", "\xef\xbb\xbfok \xff", "ok �", false},
+		{"off", "\xef\xbb\xbfGr\xfc\xdfe", "\xef\xbb\xbfGr\xfc\xdfe", false},
+	}
+	for _, test := range tests {
+		encodingCheck = test.check
+		got, err := normalizeContent(test.content)
+		if (err != nil) != test.invalid || got != test.want {
+			t.Errorf("normalizeContent(%q) with %s = %q, %v, want %q", test.content, test.check, got, err, test.want)
+		}
+	}
+}
+
+func TestBOMNotRendered(t *testing.T) {
+	newTestWiki(t, map[string]string{"a.md": "\xef\xbb\xbf---\ntitle: Front matter\n---\n# Heading\n"})
+	w := httptest.NewRecorder()
+	wikiHandler(w, httptest.NewRequest("GET", "/a", nil))
+	body := w.Body.String()
+	if strings.Contains(body, "\xef\xbb\xbf") || strings.Contains(body, "title: Front matter") {
+		t.Errorf("the BOM broke rendering the page:\n%s", body)
+	}
+	if !strings.Contains(body, `<h1 id="heading">`) {
+		t.Error("the page heading is not rendered")
+	}
+}
+
+func TestInvalidUTF8Rejected(t *testing.T) {
+	dir := newTestWiki(t, map[string]string{"a.md": "old\n"})
+	defer func(old string) { encodingCheck = old }(encodingCheck)
+	encodingCheck = "reject"
+
+	if w := postPage(t, nil, "/a", "Gr\xfc\xdfe\n"); w.Code != http.StatusBadRequest {
+		t.Errorf("saving invalid UTF-8 answered %d, want 400", w.Code)
+	}
+	if bytes, _ := os.ReadFile(filepath.Join(dir, "a.md")); string(bytes) != "old\n" {
+		t.Errorf("a.md is %q after saving invalid UTF-8", bytes)
+	}
+
+	postPage(t, nil, "/a", "\xef\xbb\xbfnew\n")
+	if bytes, _ := os.ReadFile(filepath.Join(dir, "a.md")); strings.HasPrefix(string(bytes), "\xef\xbb\xbf") {
+		t.Errorf("a.md is %q, the BOM was saved", bytes)
+	}
+}
+
+func TestBOMPages(t *testing.T) {
+	node := &Node{File: "a.md", Bytes: []byte("\xef\xbb\xbf---\ndescription: x\n---\nSome *text*\n")}
+	if got := node.PlainText(); got != "Some text" {
+		t.Errorf("PlainText of a page with a BOM = %q", got)
+	}
+	toggled, ok := toggleTask([]byte("\xef\xbb\xbf- [ ] task\n"), 0)
+	if !ok || string(toggled) != "\xef\xbb\xbf- [x] task\n" {
+		t.Errorf("toggleTask of a page with a BOM = %q, %v", toggled, ok)
+	}
+}
@@ -0,0 +1,133 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// requestIDKey is the context key of the request ID.
+type requestIDKey struct{}
+
+// requestIDHeader carries the request ID in requests and responses.
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID matches the request IDs accepted from trusted proxies.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// withRequestID gives every request a short ID, in its context and the
+// response headers, so that errors shown to users can be found in the logs.
+// Trusted proxies can pass on their own IDs.
+func withRequestID(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		peer, _, _ := net.SplitHostPort(r.RemoteAddr)
+		if !validRequestID.MatchString(id) || !(isTrustedProxy(peer) || fromMainProcess(r)) {
+			id = newRequestID()
+		}
+		r.Header.Set(requestIDHeader, id)
+		w.Header().Set(requestIDHeader, id)
+		handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// newRequestID returns a random request ID of 8 hex digits.
+func newRequestID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// requestID returns the ID of a request, empty outside of withRequestID.
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// errorWriter holds back the plain text errors of http.Error, to show them
+// as an error page instead.
+type errorWriter struct {
+	http.ResponseWriter
+	status  int
+	message bytes.Buffer
+}
+
+func (w *errorWriter) WriteHeader(status int) {
+	if status >= 400 && w.status == 0 && strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		w.status = status
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *errorWriter) Write(b []byte) (int, error) {
+	if w.status != 0 {
+		return w.message.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// withErrorPages shows errors to browsers as a page of the wiki layout with
+// the request ID. The wiki pages _404 and _500 and alike replace the default
+// text of their status. Errors from 500 on are logged with the request ID.
+func withErrorPages(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") || !strings.Contains(r.Header.Get("Accept"), "text/html") {
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			handler.ServeHTTP(sw, r)
+			if sw.status >= 500 {
+				log.Printf("Error %d serving %s %s [%s]", sw.status, r.Method, r.URL.RequestURI(), requestID(r))
+			}
+			return
+		}
+		ew := &errorWriter{ResponseWriter: w}
+		handler.ServeHTTP(ew, r)
+		if ew.status == 0 {
+			return
+		}
+		message := strings.TrimSpace(ew.message.String())
+		if ew.status >= 500 {
+			log.Printf("Error %d serving %s %s [%s]: %s", ew.status, r.Method, r.URL.RequestURI(), requestID(r), message)
+		}
+		renderError(w, r, ew.status, message)
+	})
+}
+
+// renderError writes the error page of a status.
+func renderError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	s := currentSettings()
+	node := &Node{
+		Path:      r.URL.Path,
+		Title:     s.Title,
+		Basepath:  strings.TrimSuffix(basepath, "/"),
+		Template:  "error.tpl",
+		System:    true,
+		Status:    status,
+		Message:   message,
+		RequestID: requestID(r),
+	}
+	for _, file := range []string{fmt.Sprintf("_%d.md", status), fmt.Sprintf("_%d.md", status/100*100)} {
+		if node.Bytes = store.Read(file, ""); len(node.Bytes) > 0 {
+			node.File = file
+			node.ToMarkdown()
+			break
+		}
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Del("X-Content-Type-Options")
+	w.WriteHeader(status)
+	renderTemplate(w, node)
+}
@@ -0,0 +1,125 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+)
+
+// GitVersions returns every revision of the node, newest first, with the
+// full hash and the commit time in RFC 3339 format.
+func (node *Node) GitVersions() []*Log {
+	options, rel := gitPath(node.File)
+	buf := gitCmd(exec.Command("git", append(options, "log", "--format=%H%x00%cI", "--", rel)...))
+	var versions []*Log
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if fields := strings.SplitN(line, "\x00", 2); len(fields) == 2 {
+			versions = append(versions, &Log{Hash: fields[0], Time: fields[1]})
+		}
+	}
+	return versions
+}
+
+func exportHandler(w http.ResponseWriter, r *http.Request) {
+	page := strings.Trim(strings.TrimPrefix(r.URL.Path, "/_export"), "/")
+	format := r.FormValue("format")
+	switch {
+	case page == "" && format == "bundle":
+		exportBundle(w, r)
+	case page != "" && (format == "zip" || format == ""):
+		exportPage(w, r, page)
+	default:
+		http.Error(w, "Unknown export format", http.StatusBadRequest)
+	}
+}
+
+// exportPage streams a zip archive holding every version of a page. Only
+// administrators get drafts and the versions before their publish date.
+func exportPage(w http.ResponseWriter, r *http.Request, page string) {
+	node := &Node{File: resolveFile(page)}
+	admin := isAdmin(r)
+	if strings.HasSuffix(node.File, draftSuffix) && !admin {
+		http.NotFound(w, r)
+		return
+	}
+	if bytes, err := ioutil.ReadFile(path.Join(directory, node.File)); err == nil && isUnpublished(node.File, bytes) && !admin {
+		http.NotFound(w, r)
+		return
+	}
+	versions := node.GitVersions()
+	if len(versions) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	name := path.Base(page)
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".zip"))
+	archive := zip.NewWriter(w)
+	for _, version := range versions {
+		// Deleting a page is a revision without content
+		node.Revision = version.Hash
+		if len(node.Show().Bytes) == 0 || (isUnpublished(node.File, node.Bytes) && !admin) {
+			continue
+		}
+		modified, _ := time.Parse(time.RFC3339, version.Time)
+		header := &zip.FileHeader{
+			Name:     fmt.Sprintf("%s/%s-%s%s", name, modified.UTC().Format("20060102T150405Z"), node.Revision[:7], path.Ext(node.File)),
+			Method:   zip.Deflate,
+			Modified: modified,
+		}
+		file, err := archive.CreateHeader(header)
+		if err != nil {
+			log.Printf("Could not export %q: %v", node.File, err)
+			return
+		}
+		file.Write(node.Bytes)
+	}
+	if err := archive.Close(); err != nil {
+		log.Printf("Could not export %q: %v", node.File, err)
+	}
+}
+
+// exportBundle serves a git bundle of the whole repository to
+// administrators, as it holds the drafts and deleted pages too.
+func exportBundle(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	file, err := ioutil.TempFile("", "go-pages-*.bundle")
+	if err != nil {
+		log.Printf("Could not create bundle: %v", err)
+		http.Error(w, "Could not create bundle", http.StatusInternalServerError)
+		return
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+
+	if _, err := gitRun(exec.Command("git", "bundle", "create", file.Name(), "--all")); err != nil {
+		log.Printf("Could not create bundle: %v", err)
+		http.Error(w, "Could not create bundle", http.StatusInternalServerError)
+		return
+	}
+	bundle, err := os.Open(file.Name())
+	if err != nil {
+		log.Printf("Could not read bundle: %v", err)
+		http.Error(w, "Could not create bundle", http.StatusInternalServerError)
+		return
+	}
+	defer bundle.Close()
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="wiki.bundle"`)
+	io.Copy(w, bundle)
+}
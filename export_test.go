@@ -0,0 +1,94 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// exported returns the contents of the versions in a zip export of a page.
+func exported(t *testing.T, w *httptest.ResponseRecorder) []string {
+	t.Helper()
+	archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("export is not a zip archive: %v", err)
+	}
+	var versions []string
+	for _, file := range archive.File {
+		f, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(f)
+		f.Close()
+		versions = append(versions, string(content))
+	}
+	return versions
+}
+
+func TestExportBundleAdminsOnly(t *testing.T) {
+	newTestWiki(t, map[string]string{"a.md": "a\n"})
+	w := httptest.NewRecorder()
+	exportHandler(w, httptest.NewRequest("GET", "/_export?format=bundle", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("bundle without administration answered %d, want 403", w.Code)
+	}
+
+	admin := asAdmin(t)
+	w = httptest.NewRecorder()
+	exportHandler(w, httptest.NewRequest("GET", "/_export?format=bundle", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous bundle answered %d, want 401", w.Code)
+	}
+	w = httptest.NewRecorder()
+	exportHandler(w, admin(httptest.NewRequest("GET", "/_export?format=bundle", nil)))
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Body.String(), "# v2 git bundle") {
+		t.Errorf("administrator bundle answered %d %.20q", w.Code, w.Body)
+	}
+}
+
+func TestExportPageUnpublished(t *testing.T) {
+	newTestWiki(t, map[string]string{
+		"a.md":       "published\n",
+		"a.md.draft": "draft\n",
+		"later.md":   "---\npublish: 2999-01-01\n---\nembargoed\n",
+	})
+	if err := store.Write("a.md", []byte("---\npublish: 2999-01-01\n---\nembargoed update\n"), "tester", "Update"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Write("a.md", []byte("published again\n"), "tester", "Update"); err != nil {
+		t.Fatal(err)
+	}
+	admin := asAdmin(t)
+
+	export := func(page string, r func(*http.Request) *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		exportHandler(w, r(httptest.NewRequest("GET", "/_export/"+page, nil)))
+		return w
+	}
+	anonymous := func(r *http.Request) *http.Request { return r }
+
+	w := export("a", anonymous)
+	if got := strings.Join(exported(t, w), ""); got != "published again\npublished\n" {
+		t.Errorf("anonymous export of a = %q, want the published versions", got)
+	}
+	if got := len(exported(t, export("a", admin))); got != 3 {
+		t.Errorf("administrator export of a has %d versions, want 3", got)
+	}
+	for _, page := range []string{"later", "a.md.draft"} {
+		if w := export(page, anonymous); w.Code != http.StatusNotFound {
+			t.Errorf("anonymous export of %s answered %d, want 404", page, w.Code)
+		}
+	}
+	if w := export("later", admin); w.Code != http.StatusOK {
+		t.Errorf("administrator export of later answered %d", w.Code)
+	}
+}
@@ -0,0 +1,75 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// jsonFeed is a JSON Feed 1.1 of the latest changes, see jsonfeed.org.
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+// jsonFeedItem is a single change in a jsonFeed.
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url,omitempty"`
+	Title         string           `json:"title"`
+	ContentText   string           `json:"content_text"`
+	DatePublished string           `json:"date_published"`
+	Authors       []jsonFeedAuthor `json:"authors"`
+}
+
+// jsonFeedAuthor is the author of a jsonFeedItem.
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+// feedHandler serves the latest changes of the wiki as a JSON Feed, which
+// like the sitemap needs -base-url for its absolute links.
+func feedHandler(w http.ResponseWriter, r *http.Request) {
+	if baseURL == "" {
+		http.NotFound(w, r)
+		return
+	}
+	s := currentSettings()
+	home := baseURL + strings.TrimSuffix(basepath, "/")
+	feed := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       s.Title,
+		HomePageURL: home + "/",
+		FeedURL:     home + "/feed.json",
+		Items:       []jsonFeedItem{},
+	}
+	for _, change := range gitChangesDated(s.LogLimit, "", "--date=iso-strict") {
+		item := jsonFeedItem{
+			ID:            change.Hash,
+			Title:         change.Message,
+			ContentText:   change.Message,
+			DatePublished: change.Time,
+			Authors:       []jsonFeedAuthor{{Name: change.Author}},
+		}
+		if change.Page != "" {
+			item.URL = baseURL + change.Page
+			item.Title = strings.Trim(strings.TrimPrefix(change.Page, strings.TrimSuffix(basepath, "/")), "/")
+			if item.Title == "" {
+				item.Title = homeLabel
+			}
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	w.Header().Set("Content-Type", "application/feed+json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(feed); err != nil {
+		log.Printf("Could not encode JSON: %v", err)
+	}
+}
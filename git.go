@@ -9,85 +9,349 @@ import (
 	"bytes"
 	"fmt"
 	"log"
+	"net/mail"
+	"os"
 	"os/exec"
-	"regexp"
+	"path"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
-var gitLogLimitString string
+// gitStore keeps the wiki in a git repository, with a commit for every change.
+type gitStore struct{}
 
-func init() {
-	gitLogLimitString = strconv.Itoa(RevisionLogLimit)
+// Read returns a file at a revision, or as staged without one.
+func (gitStore) Read(file, revision string) []byte {
+	if strings.HasPrefix(revision, "-") {
+		// Never pass on options to git
+		return nil
+	}
+	options, rel := gitPath(file)
+	return gitCmd(exec.Command("git", append(options, "show", revision+":"+rel)...)).Bytes()
 }
 
-// GitAdd node
-func (node *Node) GitAdd() *Node {
-	gitCmd(exec.Command("git", "add", node.File))
-	return node
+// Write commits a file, together with removing the drop files.
+func (gitStore) Write(file string, content []byte, author, msg string, drop ...string) error {
+	if err := errSubmodule(file); err != nil {
+		return err
+	}
+	stage := func() error {
+		if err := writeFile(content, path.Join(directory, file)); err != nil {
+			return err
+		}
+		for _, dropped := range drop {
+			gitRm(dropped)
+		}
+		gitCmd(exec.Command("git", "add", file))
+		return nil
+	}
+	if squashIdle > 0 {
+		return gitCommitLater(append([]string{file}, drop...), msg, author, stage)
+	}
+	return gitCommit(append([]string{file}, drop...), msg, author, stage)
 }
 
-// GitCommit node message.
-func (node *Node) GitCommit(msg string, author string) *Node {
-	if author != "" {
-		gitCmd(exec.Command("git", "commit", "-m", msg,
-			fmt.Sprintf("--author='%s <system@go-pages>'", author)))
-	} else {
-		gitCmd(exec.Command("git", "commit", "-m", msg))
+// Remove commits the removal of a file.
+func (gitStore) Remove(file, author, msg string) error {
+	if err := errSubmodule(file); err != nil {
+		return err
 	}
-	return node
+	stage := func() error {
+		gitRm(file)
+		return nil
+	}
+	if squashIdle > 0 {
+		return gitCommitLater([]string{file}, msg, author, stage)
+	}
+	return gitCommit([]string{file}, msg, author, stage)
 }
 
-// GitShow fetches the node revision.
-func (node *Node) GitShow() *Node {
-	buf := gitCmd(exec.Command("git", "show", node.Revision+":"+node.File))
-	node.Bytes = buf.Bytes()
-	return node
+// gitRm stages the removal of a file. Files with changes pending for
+// -squash-idle are removed regardless, which git refuses otherwise.
+func gitRm(file string) {
+	args := []string{"rm", "-q"}
+	if squashIdle > 0 {
+		args = append(args, "-f")
+	}
+	gitCmd(exec.Command("git", append(args, "--", file)...))
 }
 
-// GitLog fetches the node log.
-func (node *Node) GitLog() *Node {
-	buf := gitCmd(exec.Command(
-		"git", "log", "--pretty=format:%h %ad %s", "--date=relative",
-		"-n", gitLogLimitString, "--", node.File))
+// History returns the latest limit commits of a file, those of the submodule
+// for the files of a submodule.
+func (gitStore) History(file string, limit int) []*Log {
+	options, rel := gitPath(file)
+	buf := gitCmd(exec.Command("git", append(options,
+		"log", "--pretty=format:%h%x00%ad%x00%an%x00%s", logDate(),
+		"-n", strconv.Itoa(limit), "--", rel, excludeDrafts)...))
 	var err error
 	b := bufio.NewReader(buf)
 	var bytes []byte
-	node.Log = make([]*Log, 0)
+	var logs []*Log
 	for err == nil {
 		bytes, err = b.ReadSlice('\n')
-		logLine := parseLog(bytes)
-		if logLine == nil {
+		if logLine := parseLog(bytes); logLine != nil {
+			logs = append(logs, logLine)
+		}
+	}
+	return logs
+}
+
+// gitMutex serialises staging and commits with history rewrites, as the
+// index is shared by all commits.
+var gitMutex sync.Mutex
+
+// gitCommit stages the changes of files and commits them, after any changes
+// pending with -squash-idle so that they are not swept into this commit.
+func gitCommit(files []string, msg string, author string, stage func() error) error {
+	gitMutex.Lock()
+	defer gitMutex.Unlock()
+	commitPending()
+	if err := stage(); err != nil {
+		return err
+	}
+	if err := commitStaged(files, msg, author); err != nil {
+		// Never leave the rejected change behind for the next commit to pick
+		// up, or for anything reading the files to show
+		discardChanges(files)
+		return err
+	}
+	return nil
+}
+
+// discardChanges drops the uncommitted changes of files from the index and
+// the working tree, restoring them as committed and removing new ones.
+func discardChanges(files []string) {
+	gitCmd(exec.Command("git", append([]string{"reset", "-q", "--"}, files...)...))
+	for _, file := range files {
+		if _, err := gitRun(exec.Command("git", "cat-file", "-e", "HEAD:"+file)); err == nil {
+			gitCmd(exec.Command("git", "checkout", "-q", "HEAD", "--", file))
+		} else if err := os.Remove(path.Join(directory, file)); err != nil && !os.IsNotExist(err) {
+			log.Printf("Cant remove %q, error: %v", file, err)
+		}
+	}
+	invalidateCaches()
+}
+
+// commitStaged commits the staged changes of files, the caller holding
+// gitMutex. The changes stay staged if the commit fails.
+func commitStaged(files []string, msg string, author string) error {
+	// Nothing staged, for example when saving an unchanged page
+	if _, err := gitRun(exec.Command("git", "diff", "--cached", "--quiet")); err == nil {
+		return nil
+	}
+
+	args := []string{"commit", "-m", msg}
+	if len(files) == 1 && amendable(files[0], author) {
+		args = append(args, "--amend")
+	}
+	if address, err := mail.ParseAddress(author); err == nil && address.Name != "" {
+		// Authors with an email, such as the git identity
+		args = append(args, fmt.Sprintf("--author=%s <%s>", address.Name, address.Address))
+	} else if author != "" {
+		args = append(args, fmt.Sprintf("--author='%s <system@go-pages>'", author))
+	}
+	if signCommits {
+		args = append(args, "--gpg-sign"+signingKeyArg())
+	}
+	cmd := exec.Command("git", args...)
+	if timezone != nil {
+		now := time.Now().In(timezone).Format(time.RFC3339)
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_DATE="+now, "GIT_COMMITTER_DATE="+now)
+	}
+	if _, err := gitRun(cmd); err != nil {
+		log.Printf("Error: could not commit %q: %v", files, err)
+		return err
+	}
+	invalidateCaches()
+	runPostCommitHook(files, author)
+	if maxRevisions > 0 && gitRevisions() > maxRevisions+pruneSlack(maxRevisions) {
+		if pruned := gitPrune(maxRevisions); pruned > 0 {
+			log.Printf("Pruned %d revisions from history", pruned)
+		}
+	}
+	return nil
+}
+
+// pruneSlack is how far the history may grow beyond -max-revisions before it
+// is pruned, a tenth of it and at least 10, so that commits only rewrite the
+// history once in a while rather than each time.
+func pruneSlack(limit int) int {
+	if slack := limit / 10; slack > 10 {
+		return slack
+	}
+	return 10
+}
+
+// gitRevisions returns the number of revisions of the history, 0 if git fails.
+func gitRevisions() int {
+	count, _ := strconv.Atoi(strings.TrimSpace(gitCmd(exec.Command("git", "rev-list", "--count", "--first-parent", "HEAD")).String()))
+	return count
+}
+
+// gitIdentity returns the user.name and user.email of the repository, as in
+// "Jane Doe <jane@example.com>", or just the name if there is no email. Empty
+// when git has no identity configured.
+func gitIdentity() string {
+	name, _ := gitRun(exec.Command("git", "config", "user.name"))
+	email, _ := gitRun(exec.Command("git", "config", "user.email"))
+	identity := strings.TrimSpace(name.String())
+	if identity != "" && strings.TrimSpace(email.String()) != "" {
+		identity += " <" + strings.TrimSpace(email.String()) + ">"
+	}
+	return identity
+}
+
+// amendable reports whether the latest commit was made by author to file
+// alone within the amend window, so that a new change can be folded into it.
+func amendable(file, author string) bool {
+	if amendWindow <= 0 {
+		return false
+	}
+	info := strings.SplitN(strings.TrimSpace(gitCmd(exec.Command("git", "log", "-1",
+		"--format=%an%x00%ct")).String()), "\x00", 2)
+	if len(info) != 2 {
+		return false
+	}
+	if author == "" {
+		// Anonymous edits are committed as the repository's own identity
+		author = strings.TrimSpace(gitCmd(exec.Command("git", "config", "user.name")).String())
+	}
+	if address, err := mail.ParseAddress(author); err == nil && address.Name != "" {
+		author = address.Name
+	}
+	if info[0] != author {
+		return false
+	}
+	when, err := strconv.ParseInt(info[1], 10, 64)
+	if err != nil || time.Since(time.Unix(when, 0)) > time.Duration(amendWindow)*time.Second {
+		return false
+	}
+	files := strings.Fields(gitCmd(exec.Command("git", "diff-tree", "--root", "--no-commit-id",
+		"--name-only", "-r", "HEAD")).String())
+	return len(files) == 1 && files[0] == file
+}
+
+// GitPrune squashes all but the latest limit revisions of the repository.
+func GitPrune(limit int) int {
+	gitMutex.Lock()
+	defer gitMutex.Unlock()
+	return gitPrune(limit)
+}
+
+// gitPrune rewrites the history so that only the latest limit commits remain,
+// with the oldest of them holding the tree of all earlier ones. Returns the
+// number of dropped commits.
+func gitPrune(limit int) int {
+	commits := strings.Fields(gitCmd(exec.Command("git", "rev-list", "--first-parent", "HEAD")).String())
+	if limit < 1 || len(commits) <= limit {
+		return 0
+	}
+
+	// Recreate the kept commits, oldest first, on top of a new root
+	parent := ""
+	for i := limit - 1; i >= 0; i-- {
+		info := strings.SplitN(gitCmd(exec.Command("git", "log", "-1",
+			"--format=%an%x00%ae%x00%aI%x00%cn%x00%ce%x00%cI%x00%B", commits[i])).String(), "\x00", 7)
+		if len(info) != 7 {
+			log.Printf("Error: could not read commit %s, history not pruned", commits[i])
+			return 0
+		}
+		args := []string{"commit-tree", commits[i] + "^{tree}", "-m", info[6]}
+		if parent != "" {
+			args = append(args, "-p", parent)
+		}
+		cmd := exec.Command("git", args...)
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME="+info[0], "GIT_AUTHOR_EMAIL="+info[1], "GIT_AUTHOR_DATE="+info[2],
+			"GIT_COMMITTER_NAME="+info[3], "GIT_COMMITTER_EMAIL="+info[4], "GIT_COMMITTER_DATE="+info[5])
+		parent = strings.TrimSpace(gitCmd(cmd).String())
+		if parent == "" {
+			log.Printf("Error: could not recreate commit %s, history not pruned", commits[i])
+			return 0
+		}
+	}
+	gitCmd(exec.Command("git", "update-ref", "HEAD", parent, commits[0]))
+
+	// Drop the old objects for good
+	gitCmd(exec.Command("git", "reflog", "expire", "--expire=now", "--all"))
+	gitCmd(exec.Command("git", "gc", "--prune=now", "--quiet"))
+	return len(commits) - limit
+}
+
+// withCoauthors appends Co-authored-by trailers to a commit message for a
+// comma separated list of "Name <email>" entries, dropping malformed ones.
+func withCoauthors(msg, coauthors string) string {
+	var trailers []string
+	for _, entry := range parseList(coauthors) {
+		address, err := mail.ParseAddress(entry)
+		if err != nil || address.Name == "" {
+			log.Printf("Dropping malformed co-author %q", entry)
 			continue
-		} else if logLine.Hash != node.Revision {
-			logLine.Link = true
 		}
-		node.Log = append(node.Log, logLine)
+		trailers = append(trailers, fmt.Sprintf("Co-authored-by: %s <%s>", address.Name, address.Address))
 	}
-	if node.Revision == "" && len(node.Log) > 0 {
-		node.Revision = node.Log[0].Hash
-		node.Log[0].Link = false
+	if len(trailers) == 0 || msg == "" {
+		return msg
 	}
-	return node
+	return msg + "\n\n" + strings.Join(trailers, "\n")
 }
 
 func parseLog(bytes []byte) *Log {
-	line := string(bytes)
-	re := regexp.MustCompile(`(.{0,7}) (\d+ \w+ ago) (.*)`)
-	matches := re.FindStringSubmatch(line)
-	if len(matches) == 4 {
-		return &Log{Hash: matches[1], Time: matches[2], Message: matches[3]}
+	fields := strings.SplitN(strings.TrimRight(string(bytes), "\n"), "\x00", 4)
+	if len(fields) == 4 {
+		return &Log{Hash: fields[0], Time: logTime(fields[1]), Author: fields[2], Message: fields[3]}
 	}
 	return nil
 }
 
+// logDate is the git date format of log times, relative ones unless they are
+// shown in -timezone.
+func logDate() string {
+	if timezone == nil {
+		return "--date=relative"
+	}
+	return "--date=unix"
+}
+
+// logTime formats a log time of logDate.
+func logTime(date string) string {
+	seconds, err := strconv.ParseInt(date, 10, 64)
+	if timezone == nil || err != nil {
+		return date
+	}
+	return time.Unix(seconds, 0).In(timezone).Format("2006-01-02 15:04 MST")
+}
+
+// gitFiles returns the tracked files and the untracked ones git does not
+// ignore, or nil when git fails or is not used.
+func gitFiles() map[string]bool {
+	if _, ok := store.(gitStore); !ok {
+		return nil
+	}
+	buf, err := gitRun(exec.Command("git", "ls-files", "-z", "--cached", "--others", "--exclude-standard"))
+	if err != nil {
+		log.Printf("Error: could not list files: %v", err)
+		return nil
+	}
+	files := make(map[string]bool)
+	for _, file := range strings.Split(buf.String(), "\x00") {
+		if file != "" {
+			files[file] = true
+		}
+	}
+	submoduleFiles(files)
+	return files
+}
+
 func listDirectories(path string) []*Directory {
 	var s []*Directory
 	dirPath := ""
 	path = strings.TrimRight(path, "/")
 	for i, dir := range strings.Split(path, "/") {
 		if i == 0 {
-			s = append(s, &Directory{Path: "/", Name: "root"})
+			s = append(s, &Directory{Path: "/", Name: homeLabel})
 		} else {
 			dirPath += "/" + dir
 			s = append(s, &Directory{Path: dirPath, Name: dir})
@@ -96,32 +360,52 @@ func listDirectories(path string) []*Directory {
 	if len(s) > 0 {
 		s[len(s)-1].Active = true
 	}
-	return s
-}
 
-// GitRevert soft resets to the node's specific revision.
-func (node *Node) GitRevert() *Node {
-	log.Printf("Reverts %v to revision %s", node, node.Revision)
-	gitCmd(exec.Command("git", "checkout", node.Revision, "--", node.File))
-	return node
+	// Collapse the directories between the root and the deepest -max-depth
+	// ones, linking to the innermost collapsed one
+	if maxDepth > 0 && len(s) > maxDepth+2 {
+		cut := len(s) - maxDepth
+		more := &Directory{Path: s[cut-1].Path, Name: "…"}
+		s = append([]*Directory{s[0], more}, s[cut:]...)
+	}
+	return s
 }
 
-// GitRemove file
-func (node *Node) GitRemove() *Node {
-	gitCmd(exec.Command("git", "rm", node.File))
-	return node
+// signingKeyArg returns the --gpg-sign value selecting the signing key.
+func signingKeyArg() string {
+	if signingKey == "" {
+		return ""
+	}
+	return "=" + signingKey
 }
 
 // Run git command, will currently die on all errors
 func gitCmd(cmd *exec.Cmd) *bytes.Buffer {
+	buf, _ := gitRun(cmd)
+	return buf
+}
+
+// gitSlots bounds the git commands running at once to -git-concurrency, nil
+// without limit.
+var gitSlots chan struct{}
+
+// gitRun runs a git command, returning an empty buffer and the error output
+// on failure. With -git-concurrency, it waits for a free slot first.
+func gitRun(cmd *exec.Cmd) (*bytes.Buffer, error) {
+	if gitSlots != nil {
+		gitSlots <- struct{}{}
+		defer func() { <-gitSlots }()
+	}
 	cmd.Dir = fmt.Sprintf("%s/", directory)
 	var outBuf, errBuf bytes.Buffer
 	cmd.Stdout = &outBuf
 	cmd.Stderr = &errBuf
-	if err := cmd.Run(); err != nil {
-		//log.Printf("Error: command %q failed (%v) with: %s",
-		//	strings.Join(cmd.Args, " "), err, errBuf.String())
-		return &bytes.Buffer{}
+	start := time.Now()
+	err := cmd.Run()
+	gitMetric(cmd.Args, time.Since(start))
+	if err != nil {
+		return &bytes.Buffer{}, fmt.Errorf("command %q failed (%v) with: %s",
+			strings.Join(cmd.Args, " "), err, strings.TrimSpace(errBuf.String()))
 	}
-	return &outBuf
+	return &outBuf, nil
 }
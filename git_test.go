@@ -0,0 +1,239 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// failCommits makes every commit of the test wiki fail, as a failing
+// signature would.
+func failCommits(t *testing.T, dir string) {
+	t.Helper()
+	writeTestFile(t, filepath.Join(dir, ".git/hooks/pre-commit"), "#!/bin/sh\nexit 1\n")
+	if err := os.Chmod(filepath.Join(dir, ".git/hooks/pre-commit"), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// gitStatus returns the uncommitted changes of the test wiki.
+func gitStatus(t *testing.T, dir string) string {
+	t.Helper()
+	cmd := exec.Command("git", "status", "--porcelain")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestFailedCommitRestoresFiles(t *testing.T) {
+	dir := newTestWiki(t, map[string]string{"a.md": "old\n", "gone.md": "kept\n"})
+	failCommits(t, dir)
+
+	if err := store.Write("a.md", []byte("rejected\n"), "tester", "Update"); err == nil {
+		t.Fatal("Write succeeded although the commit failed")
+	}
+	if bytes, _ := os.ReadFile(filepath.Join(dir, "a.md")); string(bytes) != "old\n" {
+		t.Errorf("a.md is %q after the failed commit, want the committed content", bytes)
+	}
+
+	if err := store.Write("new.md", []byte("rejected\n"), "tester", "Create"); err == nil {
+		t.Fatal("Write succeeded although the commit failed")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new.md")); !os.IsNotExist(err) {
+		t.Errorf("new.md left behind after the failed commit")
+	}
+
+	if err := store.Remove("gone.md", "tester", "Delete"); err == nil {
+		t.Fatal("Remove succeeded although the commit failed")
+	}
+	if bytes, _ := os.ReadFile(filepath.Join(dir, "gone.md")); string(bytes) != "kept\n" {
+		t.Errorf("gone.md is %q after the failed removal, want it restored", bytes)
+	}
+
+	if status := gitStatus(t, dir); status != "" {
+		t.Errorf("changes left behind after the failed commits:\n%s", status)
+	}
+	if pages, _ := listPages(""); len(pages) != 2 {
+		t.Errorf("listPages = %v, want the committed pages only", pages)
+	}
+}
+
+// commitAt commits a change of a test wiki page at a time in the past.
+func commitAt(t *testing.T, ago time.Duration, file, content, author string) {
+	t.Helper()
+	date := time.Now().Add(-ago).Format(time.RFC3339)
+	for _, name := range []string{"GIT_AUTHOR_DATE", "GIT_COMMITTER_DATE"} {
+		old, ok := os.LookupEnv(name)
+		os.Setenv(name, date)
+		defer func(name string) {
+			if ok {
+				os.Setenv(name, old)
+			} else {
+				os.Unsetenv(name)
+			}
+		}(name)
+	}
+	if err := store.Write(file, []byte(content), author, "Update "+file); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAmendWindow(t *testing.T) {
+	old := amendWindow
+	amendWindow = 60
+	defer func() { amendWindow = old }()
+
+	tests := []struct {
+		name    string
+		ago     time.Duration
+		file    string
+		author  string
+		amended bool
+	}{
+		{"same author within the window", 30 * time.Second, "a.md", "Alice <alice@example.com>", true},
+		{"same plain author within the window", 30 * time.Second, "a.md", "alice", true},
+		{"just within the window", 55 * time.Second, "a.md", "Alice <alice@example.com>", true},
+		{"just outside the window", 65 * time.Second, "a.md", "Alice <alice@example.com>", false},
+		{"long ago", time.Hour, "a.md", "Alice <alice@example.com>", false},
+		{"different author", 0, "a.md", "Bob <bob@example.com>", false},
+		{"different page", 0, "b.md", "Alice <alice@example.com>", false},
+	}
+	for _, test := range tests {
+		newTestWiki(t, map[string]string{"a.md": "a\n", "b.md": "b\n"})
+		author := "Alice <alice@example.com>"
+		if test.author == "alice" {
+			author = "alice"
+		}
+		commitAt(t, test.ago, "a.md", "first\n", author)
+		before := gitRevisions()
+		if err := store.Write(test.file, []byte("second\n"), test.author, "Update "+test.file); err != nil {
+			t.Fatal(err)
+		}
+		if amended := gitRevisions() == before; amended != test.amended {
+			t.Errorf("%s: amended = %v, want %v", test.name, amended, test.amended)
+		}
+	}
+}
+
+func TestAmendWindowOff(t *testing.T) {
+	newTestWiki(t, map[string]string{"a.md": "a\n"})
+	commitAt(t, 0, "a.md", "first\n", "Alice <alice@example.com>")
+	before := gitRevisions()
+	if err := store.Write("a.md", []byte("second\n"), "Alice <alice@example.com>", "Update a.md"); err != nil {
+		t.Fatal(err)
+	}
+	if gitRevisions() == before {
+		t.Error("the previous commit was amended without -amend-window")
+	}
+}
+
+func TestGitConcurrency(t *testing.T) {
+	newTestWiki(t, nil)
+	defer func(old chan struct{}) { gitSlots = old }(gitSlots)
+	gitSlots = make(chan struct{}, 2)
+
+	// Every command notes how many are running alongside it
+	script := filepath.Join(t.TempDir(), "git")
+	running := t.TempDir()
+	writeTestFile(t, script, `#!/bin/sh
+touch "$RUNNING/$$"
+ls "$RUNNING" | wc -l >> "$RUNNING.log"
+sleep 0.1
+rm "$RUNNING/$$"
+`)
+	if err := os.Chmod(script, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cmd := exec.Command(script)
+			cmd.Env = append(os.Environ(), "RUNNING="+running)
+			if _, err := gitRun(cmd); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	notes, err := os.ReadFile(running + ".log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := strings.Fields(string(notes))
+	if len(counts) != 8 {
+		t.Fatalf("%d commands ran, want 8", len(counts))
+	}
+	for _, count := range counts {
+		if n, _ := strconv.Atoi(count); n > 2 {
+			t.Errorf("%d commands ran at once with -git-concurrency 2", n)
+		}
+	}
+	if len(gitSlots) != 0 {
+		t.Errorf("%d slots still taken", len(gitSlots))
+	}
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	dir := newTestWiki(t, map[string]string{"a.md": "a\n"})
+	defer func(old int) { amendWindow = old }(amendWindow)
+	amendWindow = 0
+
+	var wg sync.WaitGroup
+	for i := 0; i < 9; i++ {
+		wg.Add(1)
+		go func(n string) {
+			defer wg.Done()
+			var err error
+			if n == "0" {
+				err = store.Remove("a.md", "author 0", "Remove 0")
+			} else {
+				err = store.Write("page"+n+".md", []byte(n+"\n"), "author "+n, "Write "+n)
+			}
+			if err != nil {
+				t.Errorf("change by author %s: %v", n, err)
+			}
+		}(strconv.Itoa(i))
+	}
+	wg.Wait()
+
+	cmd := exec.Command("git", "log", "-n", "10", "--format=%x00%an%x00%s", "--name-only")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commits := strings.Split(string(out), "\x00")[1:]
+	if len(commits) != 20 {
+		t.Fatalf("%d commits, want the initial one and one by each author:\n%s", len(commits)/2, out)
+	}
+	for i := 0; i+2 < len(commits); i += 2 {
+		author, commit := commits[i], strings.Fields(commits[i+1])
+		n := strings.TrimPrefix(author, "author ")
+		want := []string{"Write", n, "page" + n + ".md"}
+		if n == "0" {
+			want = []string{"Remove", n, "a.md"}
+		}
+		if strings.Join(commit, " ") != strings.Join(want, " ") {
+			t.Errorf("commit by %q = %q, want %q", author, commit, want)
+		}
+	}
+	if status := gitStatus(t, dir); status != "" {
+		t.Errorf("changes left uncommitted:\n%s", status)
+	}
+}
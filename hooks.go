@@ -0,0 +1,43 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// runPostCommitHook runs the -post-commit-hook in the background for a
+// commit of files, with the first file and the revision as arguments. All
+// files are passed in GO_PAGES_FILES, one per line, and the author only in
+// GO_PAGES_AUTHOR, as an author starting with - would pass as an option. The
+// output and exit code are only logged, the change is committed anyway.
+func runPostCommitHook(files []string, author string) {
+	args := strings.Fields(postCommitHook)
+	if len(args) == 0 || len(files) == 0 {
+		return
+	}
+	revision := strings.TrimSpace(gitCmd(exec.Command("git", "rev-parse", "HEAD")).String())
+	go func() {
+		cmd := exec.Command(args[0], append(args[1:], files[0], revision)...)
+		cmd.Dir = directory
+		cmd.Env = append(os.Environ(),
+			"GO_PAGES_FILE="+files[0],
+			"GO_PAGES_FILES="+strings.Join(files, "\n"),
+			"GO_PAGES_AUTHOR="+author,
+			"GO_PAGES_REVISION="+revision)
+		output, err := cmd.CombinedOutput()
+		code := 0
+		if err != nil {
+			code = -1
+			if exit, ok := err.(*exec.ExitError); ok {
+				code = exit.ExitCode()
+			}
+		}
+		log.Printf("Post commit hook for %s exited with %d (%v): %s", revision, code, err, strings.TrimSpace(string(output)))
+	}()
+}
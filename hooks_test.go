@@ -0,0 +1,39 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPostCommitHookAuthor(t *testing.T) {
+	newTestWiki(t, map[string]string{"a.md": "a\n"})
+	hook := filepath.Join(t.TempDir(), "hook.sh")
+	out := hook + ".out"
+	writeTestFile(t, hook, "#!/bin/sh\nprintf '%s\\n' \"$@\" \"author=$GO_PAGES_AUTHOR\" > \"$HOOK_OUT.tmp\"\nmv \"$HOOK_OUT.tmp\" \"$HOOK_OUT\"\n")
+	if err := os.Chmod(hook, 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HOOK_OUT", out)
+	defer func(old string) { postCommitHook = old }(postCommitHook)
+	postCommitHook = hook
+
+	runPostCommitHook([]string{"a.md"}, "--help")
+	var got []byte
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		var err error
+		if got, err = os.ReadFile(out); err == nil {
+			break
+		}
+	}
+	lines := strings.Split(strings.TrimSpace(string(got)), "\n")
+	if len(lines) != 3 || lines[0] != "a.md" || len(lines[1]) != 40 || lines[2] != "author=--help" {
+		t.Errorf("the hook got %q, want the file, the revision and the author in GO_PAGES_AUTHOR", lines)
+	}
+}
@@ -0,0 +1,285 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// tenantEnv marks a wiki started for a host of the host map, which serves
+// its own directory only. It holds the token of the main process.
+const tenantEnv = "GO_PAGES_TENANT"
+
+// tenantHostEnv holds the host name of a host wiki, which labels its metrics
+// and traces.
+const tenantHostEnv = "GO_PAGES_HOST"
+
+// The main process passes on requests to the host wikis with its token, and
+// with the client it got them from, so that host wikis see them as it does.
+const (
+	tenantTokenHeader = "X-Go-Pages-Tenant"
+	tenantPeerHeader  = "X-Go-Pages-Peer"
+)
+
+// tenantKey marks the requests a host wiki got from its main process.
+type tenantKey struct{}
+
+// tenantListenerFD is the file descriptor of the listener a host wiki gets
+// from the main process, the first after the standard ones.
+const tenantListenerFD = 3
+
+// hostPipe is written to by nobody but kept open by the main process only,
+// the host wikis read it as their standard input and stop once it closes
+// along with the main process.
+var hostPipe *os.File
+
+// hostRestartDelay is how long a host wiki that stopped waits to be
+// restarted, doubled after every quick stop so that a broken one does not
+// spin, up to hostRestartMaxDelay.
+var (
+	hostRestartDelay    = time.Second
+	hostRestartMaxDelay = time.Minute
+)
+
+// stopHosts is closed once the main process shuts down, so that host wikis
+// are no longer restarted.
+var stopHosts = make(chan struct{})
+
+// hostConfig is the wiki of a host in the host map file, for example:
+//
+//	{"docs.example.com": {"dir": "/srv/docs", "title": "Docs"}}
+type hostConfig struct {
+	Dir            string `json:"dir"`
+	Title          string `json:"title"`
+	SettingsFile   string `json:"settingsFile"`
+	PostCommitHook string `json:"postCommitHook"`
+}
+
+// loadHostMap reads a host map file, with the host names in lower case.
+func loadHostMap(file string) (map[string]hostConfig, error) {
+	bytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var hosts map[string]hostConfig
+	if err := json.Unmarshal(bytes, &hosts); err != nil {
+		return nil, err
+	}
+	lower := make(map[string]hostConfig)
+	for host, config := range hosts {
+		if config.Dir == "" {
+			return nil, fmt.Errorf("host %q has no dir", host)
+		}
+		if _, err := os.Stat(config.Dir); err != nil {
+			return nil, fmt.Errorf("directory of host %q: %v", host, err)
+		}
+		lower[strings.ToLower(host)] = config
+	}
+	return lower, nil
+}
+
+// startHosts runs a wiki of its own for every host of the host map, with the
+// same flags besides those of hostArgs, serving a free local port. The port
+// is bound here and handed on as an open listener, so that nothing else can
+// take it in between, and kept for restarting the wiki whenever it stops.
+// Returns the proxies to them by host name.
+func startHosts(hosts map[string]hostConfig, proxies string) (map[string]http.Handler, error) {
+	handlers := make(map[string]http.Handler)
+	token := randomHex(16)
+	stdin, pipe, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	hostPipe = pipe
+	for host, config := range hosts {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+		local := listener.Addr().String()
+		file, err := listener.(*net.TCPListener).File()
+		listener.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		args := hostArgs(os.Args[1:], host, config, local, proxies)
+		start := func() (*exec.Cmd, error) {
+			cmd := exec.Command(os.Args[0], args...)
+			cmd.Env = append(os.Environ(), tenantEnv+"="+token, tenantHostEnv+"="+host)
+			cmd.Stdin = stdin
+			cmd.Stdout = os.Stdout
+			cmd.Stderr = os.Stderr
+			cmd.ExtraFiles = []*os.File{file}
+			return cmd, cmd.Start()
+		}
+		cmd, err := start()
+		if err != nil {
+			return nil, err
+		}
+		go superviseHost(host, cmd, start)
+
+		log.Printf("Serving host %q from %q", host, config.Dir)
+		handlers[host] = hostProxy(&url.URL{Scheme: "http", Host: local}, token)
+	}
+	return handlers, nil
+}
+
+// superviseHost restarts the wiki of a host whenever it stops, until
+// stopHosts is closed. Requests for the host wait in the backlog of its
+// listener meanwhile.
+func superviseHost(host string, cmd *exec.Cmd, start func() (*exec.Cmd, error)) {
+	delay := hostRestartDelay
+	for {
+		started := time.Now()
+		err := cmd.Wait()
+		select {
+		case <-stopHosts:
+			return
+		default:
+		}
+		if time.Since(started) > hostRestartMaxDelay {
+			delay = hostRestartDelay
+		}
+		log.Printf("Error: the wiki of host %q stopped: %v, restarting it in %v", host, err, delay)
+		select {
+		case <-stopHosts:
+			return
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > hostRestartMaxDelay {
+			delay = hostRestartMaxDelay
+		}
+		for {
+			if cmd, err = start(); err == nil {
+				break
+			}
+			log.Printf("Error: could not restart the wiki of host %q: %v", host, err)
+			select {
+			case <-stopHosts:
+				return
+			case <-time.After(delay):
+			}
+		}
+	}
+}
+
+// hostProxy passes requests on to the wiki of a host. The forwarding and
+// -auth-header headers are only passed on from trusted proxies, others could
+// make them up.
+func hostProxy(target *url.URL, token string) http.Handler {
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	director := proxy.Director
+	proxy.Director = func(r *http.Request) {
+		director(r)
+		peer, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			peer = r.RemoteAddr
+		}
+		if !isTrustedProxy(peer) {
+			// The proxy adds the peer as the only forwarded address
+			r.Header.Del("X-Forwarded-For")
+			r.Header.Del("X-Real-IP")
+			if authHeader != "" {
+				r.Header.Del(authHeader)
+			}
+		}
+		r.Header.Set(tenantTokenHeader, token)
+		r.Header.Set(tenantPeerHeader, r.RemoteAddr)
+	}
+	return proxy
+}
+
+// withTenant only serves the requests passed on by the main process, as
+// coming from the client the main process got them from.
+func withTenant(token string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(tenantTokenHeader)), []byte(token)) != 1 {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		r.RemoteAddr = r.Header.Get(tenantPeerHeader)
+		r.Header.Del(tenantTokenHeader)
+		r.Header.Del(tenantPeerHeader)
+		handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tenantKey{}, true)))
+	})
+}
+
+// fromMainProcess reports whether a host wiki got a request from its main
+// process, which already checked its request ID.
+func fromMainProcess(r *http.Request) bool {
+	tenant, _ := r.Context().Value(tenantKey{}).(bool)
+	return tenant
+}
+
+// hostArgs returns the arguments of the wiki of a host, its own directory,
+// title, settings file, post-commit hook and disk cache directory added to
+// the flags of the main process.
+func hostArgs(flags []string, host string, config hostConfig, local, proxies string) []string {
+	title := config.Title
+	if title == "" {
+		title = host
+	}
+	cache := ""
+	if diskCacheDir != "" {
+		cache = filepath.Join(diskCacheDir, url.PathEscape(host))
+	}
+	// Later flags take precedence. The flags are copied, as appending to them
+	// could otherwise write the arguments of one host into those of another.
+	args := append([]string(nil), flags...)
+	return append(args, "-dir", config.Dir, "-title", title, "-address", local,
+		"-settings-file", config.SettingsFile, "-post-commit-hook", config.PostCommitHook,
+		"-disk-cache-dir", cache, "-trusted-proxies", proxies)
+}
+
+// tenantListener returns the listener a host wiki got from the main process.
+func tenantListener() (net.Listener, error) {
+	file := os.NewFile(tenantListenerFD, "listener")
+	defer file.Close()
+	return net.FileListener(file)
+}
+
+// watchMainProcess stops a host wiki when its main process is gone.
+func watchMainProcess() {
+	io.Copy(ioutil.Discard, os.Stdin)
+	log.Printf("Main process stopped")
+	flushPending()
+	os.Exit(0)
+}
+
+// withHosts passes the requests for the hosts of the host map on to their
+// wikis. Other hosts are served by handler, or get a 404 with -unknown-host-404.
+func withHosts(hosts map[string]http.Handler, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if proxy, ok := hosts[strings.ToLower(host)]; ok {
+			proxy.ServeHTTP(w, r)
+			return
+		}
+		if unknownHost404 {
+			http.NotFound(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,227 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serving answers every request with a name.
+func serving(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, name)
+	})
+}
+
+func TestWithHosts(t *testing.T) {
+	defer func(old bool) { unknownHost404 = old }(unknownHost404)
+	hosts := map[string]http.Handler{"docs.example.com": serving("docs"), "team.example.com": serving("team")}
+	handler := withHosts(hosts, serving("default"))
+
+	tests := []struct {
+		host     string
+		notFound bool
+		want     string
+	}{
+		{"docs.example.com", false, "docs"},
+		{"team.example.com", false, "team"},
+		{"Docs.Example.COM", false, "docs"},
+		{"docs.example.com:8080", false, "docs"},
+		{"other.example.com", false, "default"},
+		{"example.com", false, "default"},
+		{"docs.example.com.evil", false, "default"},
+		{"127.0.0.1:8080", false, "default"},
+		{"[::1]:8080", false, "default"},
+		{"other.example.com", true, ""},
+		{"docs.example.com", true, "docs"},
+	}
+	for _, test := range tests {
+		unknownHost404 = test.notFound
+		r := httptest.NewRequest("GET", "/page", nil)
+		r.Host = test.host
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if test.want == "" {
+			if w.Code != http.StatusNotFound {
+				t.Errorf("Host %q with -unknown-host-404 answered %d, want 404", test.host, w.Code)
+			}
+		} else if w.Body.String() != test.want {
+			t.Errorf("Host %q served by %q, want %q", test.host, w.Body, test.want)
+		}
+	}
+}
+
+func TestHostArgs(t *testing.T) {
+	// Spare capacity is where appending to shared flags goes wrong
+	flags := make([]string, 2, 20)
+	copy(flags, []string{"-emoji", "-title=Main"})
+
+	docs := hostArgs(flags, "docs.example.com", hostConfig{Dir: "/srv/docs", Title: "Docs", PostCommitHook: "/srv/docs-hook"}, "127.0.0.1:4001", "")
+	defer func(old string) { diskCacheDir = old }(diskCacheDir)
+	diskCacheDir = "/var/cache/go-pages"
+	team := hostArgs(flags, "team.example.com", hostConfig{Dir: "/srv/team"}, "127.0.0.1:4002", "10.0.0.0/8")
+
+	want := "-emoji -title=Main -dir /srv/docs -title Docs -address 127.0.0.1:4001 -settings-file  -post-commit-hook /srv/docs-hook -disk-cache-dir  -trusted-proxies "
+	if got := strings.Join(docs, " "); got != want {
+		t.Errorf("arguments of docs.example.com = %q, want %q", got, want)
+	}
+	want = "-emoji -title=Main -dir /srv/team -title team.example.com -address 127.0.0.1:4002 -settings-file  -post-commit-hook  -disk-cache-dir /var/cache/go-pages/team.example.com -trusted-proxies 10.0.0.0/8"
+	if got := strings.Join(team, " "); got != want {
+		t.Errorf("arguments of team.example.com = %q, want %q", got, want)
+	}
+	if len(flags) != 2 || flags[:cap(flags)][2] != "" {
+		t.Errorf("the flags of the main process were changed: %q", flags[:cap(flags)])
+	}
+}
+
+func TestLoadHostMap(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "hosts.json")
+	writeTestFile(t, file, `{"Docs.Example.COM": {"dir": "`+dir+`", "title": "Docs"}}`)
+	hosts, err := loadHostMap(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config, ok := hosts["docs.example.com"]; !ok || config.Title != "Docs" {
+		t.Errorf("loadHostMap = %+v, want the host in lower case", hosts)
+	}
+
+	for _, content := range []string{
+		`{"docs.example.com": {"title": "No dir"}}`,
+		`{"docs.example.com": {"dir": "` + filepath.Join(dir, "missing") + `"}}`,
+		`not json`,
+	} {
+		writeTestFile(t, file, content)
+		if _, err := loadHostMap(file); err == nil {
+			t.Errorf("loadHostMap(%s) succeeded", content)
+		}
+	}
+	os.Remove(file)
+	if _, err := loadHostMap(file); err == nil {
+		t.Error("loadHostMap of a missing file succeeded")
+	}
+}
+
+func TestHostProxyHeaders(t *testing.T) {
+	trusting(t, "10.0.0.0/8")
+	defer func(old string) { authHeader = old }(authHeader)
+	authHeader = "X-Forwarded-User"
+
+	// The wiki of the host, with the middleware of a host wiki
+	var got *http.Request
+	var gotID string
+	tenant := httptest.NewServer(withTenant("token", withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, gotID = r, requestID(r)
+	}))))
+	defer tenant.Close()
+	target, _ := url.Parse(tenant.URL)
+	proxy := withRequestID(hostProxy(target, "token"))
+
+	tests := []struct {
+		peer      string
+		user      string
+		client    string
+		forwarded bool
+	}{
+		{"203.0.113.7:4000", "", "203.0.113.7", false},
+		{"10.0.0.1:4000", "alice", "198.51.100.1", true},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/page", nil)
+		r.RemoteAddr = test.peer
+		r.Header.Set("X-Forwarded-For", "198.51.100.1")
+		r.Header.Set("X-Real-IP", "198.51.100.2")
+		r.Header.Set("X-Forwarded-User", "alice")
+		r.Header.Set("X-Request-ID", "made-up")
+		r.Header.Set(tenantTokenHeader, "guessed")
+		r.Header.Set(tenantPeerHeader, "10.0.0.9:1")
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, r)
+		if w.Code != http.StatusOK || got == nil {
+			t.Fatalf("peer %s: the host wiki answered %d", test.peer, w.Code)
+		}
+
+		if ip := clientIP(got); ip != test.client {
+			t.Errorf("peer %s: the host wiki sees client %q, want %q", test.peer, ip, test.client)
+		}
+		if user := proxyUser(got); user != test.user {
+			t.Errorf("peer %s: the host wiki sees user %q, want %q", test.peer, user, test.user)
+		}
+		if id := w.Header().Get("X-Request-ID"); (id == "made-up") != test.forwarded || gotID != id {
+			t.Errorf("peer %s: request ID %q in the host wiki, answered %q", test.peer, gotID, id)
+		}
+		if got.Header.Get(tenantTokenHeader) != "" || got.Header.Get(tenantPeerHeader) != "" {
+			t.Errorf("peer %s: the host wiki got the headers of the main process", test.peer)
+		}
+		got = nil
+	}
+}
+
+func TestTenantOnlyServesMainProcess(t *testing.T) {
+	handler := withTenant("token", serving("page"))
+	for _, token := range []string{"", "guessed", "tokentoken"} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set(tenantTokenHeader, token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("token %q answered %d, want 403", token, w.Code)
+		}
+	}
+}
+
+func TestSuperviseHost(t *testing.T) {
+	defer func(delay, max time.Duration, stop chan struct{}) {
+		hostRestartDelay, hostRestartMaxDelay, stopHosts = delay, max, stop
+	}(hostRestartDelay, hostRestartMaxDelay, stopHosts)
+	hostRestartDelay, hostRestartMaxDelay, stopHosts = time.Millisecond, 4*time.Millisecond, make(chan struct{})
+
+	starts := make(chan int, 10)
+	n := 0
+	start := func() (*exec.Cmd, error) {
+		n++
+		starts <- n
+		if n == 2 {
+			return nil, errors.New("no such file")
+		}
+		cmd := exec.Command("sh", "-c", "exit 1")
+		return cmd, cmd.Start()
+	}
+	cmd, _ := start()
+	<-starts
+	done := make(chan struct{})
+	go func() {
+		superviseHost("docs.example.com", cmd, start)
+		close(done)
+	}()
+
+	// Stopping, failing to start and stopping again
+	for want := 2; want <= 4; want++ {
+		select {
+		case got := <-starts:
+			if got != want {
+				t.Fatalf("start %d, want %d", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("the host wiki was not started %d times", want)
+		}
+	}
+	close(stopHosts)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the host wiki is still restarted after shutting down")
+	}
+}
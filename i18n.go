@@ -0,0 +1,59 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+)
+
+// defaultLanguage is used for messages missing in the active language.
+const defaultLanguage = "en"
+
+//go:embed lang/*.json
+var languageFiles embed.FS
+
+// messages holds the user interface strings of the active language, and of
+// the default language as a fallback.
+var messages, defaultMessages map[string]string
+
+// readLanguage reads the message bundle of a language.
+func readLanguage(lang string) (map[string]string, error) {
+	bytes, err := languageFiles.ReadFile("lang/" + lang + ".json")
+	if err != nil {
+		return nil, fmt.Errorf("unknown language %q", lang)
+	}
+	var bundle map[string]string
+	if err := json.Unmarshal(bytes, &bundle); err != nil {
+		return nil, err
+	}
+	return bundle, nil
+}
+
+// loadLanguage makes a language the active one.
+func loadLanguage(lang string) error {
+	var err error
+	if defaultMessages, err = readLanguage(defaultLanguage); err != nil {
+		return err
+	}
+	messages, err = readLanguage(lang)
+	return err
+}
+
+// T translates a message key to the active language, formatting it with the
+// arguments if any. Unknown keys are returned as is.
+func T(key string, args ...interface{}) string {
+	message, ok := messages[key]
+	if !ok {
+		if message, ok = defaultMessages[key]; !ok {
+			return key
+		}
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(message, args...)
+	}
+	return message
+}
@@ -0,0 +1,123 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// heading matches the first level heading of a markdown page.
+var heading = regexp.MustCompile(`(?m)^#[ \t]+(.+?)[ \t#]*$`)
+
+// summaryLength is the maximum length of a page summary in a listing.
+const summaryLength = 200
+
+// pageSummary is the title and first paragraph of a page file, extracted
+// from the file as it was at modTime.
+type pageSummary struct {
+	modTime     time.Time
+	title       string
+	summary     string
+	unpublished bool
+	noindex     bool
+}
+
+// summarize extracts the title of a page, its front matter title or else its
+// first level heading, and its first paragraph besides the title.
+func summarize(file string, bytes []byte) pageSummary {
+	node := &Node{File: file, Bytes: bytes}
+	meta, source := parseFrontMatter(bytes)
+	s := pageSummary{title: meta["title"], unpublished: isUnpublished(file, bytes), noindex: isNoIndex(mergeSidecar(meta, file))}
+	if m := heading.FindSubmatch(source); s.title == "" && m != nil && path.Ext(file) == ".md" {
+		s.title = string(m[1])
+	}
+	for _, paragraph := range strings.Split(node.PlainText(), "\n\n") {
+		if paragraph = strings.TrimSpace(paragraph); paragraph != "" && paragraph != s.title {
+			s.summary = snippet(paragraph, summaryLength)
+			break
+		}
+	}
+	return s
+}
+
+// serveIndex lists the pages and subdirectories of a directory without an
+// index page, with -index-summaries. Returns false for other requests.
+func serveIndex(w http.ResponseWriter, r *http.Request) bool {
+	if !indexSummaries || r.Method != http.MethodGet || !strings.HasSuffix(r.URL.Path, "/") ||
+		parseBool(r.FormValue("edit")) || r.FormValue("revision") != "" {
+		return false
+	}
+	for _, name := range indexNames {
+		if _, err := os.Stat(path.Join(directory, resolveFile(strings.TrimPrefix(r.URL.Path+name, "/")))); err == nil {
+			return false
+		}
+	}
+	dir := strings.Trim(r.URL.Path, "/")
+	if info, err := os.Stat(path.Join(directory, dir)); err != nil || !info.IsDir() {
+		return false
+	}
+
+	s := currentSettings()
+	node := &Node{
+		Path:     r.URL.Path,
+		Title:    s.Title,
+		Basepath: strings.TrimSuffix(basepath, "/"),
+		Template: "index.tpl",
+		ReadOnly: s.ReadOnly,
+		System:   true,
+	}
+	prefix := dir + "/"
+	if dir == "" {
+		prefix = ""
+	}
+	pages, more := listPages(dir)
+	subdirs := make(map[string]bool)
+	for _, file := range append(pages, more...) {
+		rest := strings.TrimPrefix(file, prefix)
+		if i := strings.Index(rest, "/"); i >= 0 {
+			subdirs[rest[:i]] = true
+			continue
+		}
+		summary, ok := cachedSummary(file)
+		if !ok || (summary.unpublished && !isAdmin(r)) {
+			continue
+		}
+		node.Pages = append(node.Pages, &Directory{
+			Path:    pageURL(file),
+			Name:    strings.TrimSuffix(rest, path.Ext(rest)),
+			Heading: summary.title,
+			Summary: summary.summary,
+		})
+	}
+	for subdir := range subdirs {
+		node.Subdirs = append(node.Subdirs, &Directory{
+			Path: node.Basepath + "/" + prefix + subdir + "/",
+			Name: subdir,
+		})
+	}
+	sort.Slice(node.Subdirs, func(i, j int) bool { return node.Subdirs[i].Name < node.Subdirs[j].Name })
+	sort.Slice(node.Pages, func(i, j int) bool { return node.Pages[i].Name < node.Pages[j].Name })
+	node.Dirs = listDirectories(r.URL.Path)
+	renderTemplate(w, node)
+	return true
+}
+
+// summaryFile reads a page file for its summary, see cachedSummary.
+func summaryFile(file string) (pageSummary, bool) {
+	bytes, err := ioutil.ReadFile(path.Join(directory, file))
+	if err != nil {
+		log.Printf("Cant read file %q, error: %v", file, err)
+		return pageSummary{}, false
+	}
+	return summarize(file, bytes), true
+}
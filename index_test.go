@@ -0,0 +1,60 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIndexNames(t *testing.T) {
+	newTestWiki(t, map[string]string{
+		"index.md":       "# Root index\n",
+		"README.md":      "# Root readme\n",
+		"docs/README.md": "# Docs readme\n",
+		"docs/home.md":   "# Docs home\n",
+		"notes/home.md":  "# Notes home\n",
+		"empty/page.md":  "# Page\n",
+	})
+	defer func(old []string) { indexNames = old }(indexNames)
+	indexNames = []string{"index", "README", "home"}
+
+	tests := []struct {
+		dir    string
+		page   string
+		header string
+	}{
+		{"/", "/index", "Root index"},
+		{"/docs/", "/docs/README", "Docs readme"},
+		{"/notes/", "/notes/home", "Notes home"},
+		{"/empty/", "/empty/index", ""},
+	}
+	for _, test := range tests {
+		if got := indexPage(test.dir); got != test.page {
+			t.Errorf("indexPage(%q) = %q, want %q", test.dir, got, test.page)
+		}
+		if test.header == "" {
+			continue
+		}
+		w := httptest.NewRecorder()
+		wikiHandler(w, httptest.NewRequest("GET", test.dir, nil))
+		if !strings.Contains(w.Body.String(), test.header) {
+			t.Errorf("%s does not show %q", test.dir, test.header)
+		}
+	}
+
+	// The order of the names decides
+	indexNames = []string{"home", "README", "index"}
+	if got := indexPage("/docs/"); got != "/docs/home" {
+		t.Errorf("indexPage(/docs/) = %q with home first, want /docs/home", got)
+	}
+	if got := pageURL("docs/home.md"); got != "/docs/" {
+		t.Errorf("pageURL(docs/home.md) = %q, want the directory", got)
+	}
+	if got := pageURL("docs/README.md"); got != "/docs/README" {
+		t.Errorf("pageURL(docs/README.md) = %q, want the page itself", got)
+	}
+}
@@ -0,0 +1,133 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"text/template/parse"
+)
+
+// layoutFileName is the layout of a directory, replacing node.tpl for the
+// pages below.
+const layoutFileName = "_layout.tpl"
+
+// parentLayout matches the inclusion of the enclosing layout in a layout.
+var parentLayout = regexp.MustCompile(`\btemplate\s+"parent"`)
+
+// pageLayouts returns the layout files for a page file from the nearest
+// directory up to the root.
+func pageLayouts(file string) []string {
+	var layouts []string
+	for dir := path.Dir(file); ; dir = path.Dir(dir) {
+		layout := path.Join(dir, layoutFileName)
+		if _, err := os.Stat(path.Join(directory, layout)); err == nil {
+			layouts = append(layouts, layout)
+		}
+		if dir == "." || dir == "/" {
+			break
+		}
+	}
+	return layouts
+}
+
+// parsedLayouts are the templates of the layouts of a directory, in the
+// order they are added, or why they could not be parsed.
+type parsedLayouts struct {
+	trees []*parse.Tree
+	err   error
+}
+
+// parseLayouts parses the layouts of the pages of a directory. The nearest
+// layout becomes "node", and {{ template "parent" . }} in a layout renders
+// the next layout up, or node.tpl for the last one. Functions are only
+// looked up once the layouts are executed, along with the wiki templates.
+func parseLayouts(dir string) parsedLayouts {
+	layouts := pageLayouts(path.Join(dir, layoutFileName))
+	var parsed parsedLayouts
+	for i := len(layouts) - 1; i >= 0; i-- {
+		source, err := ioutil.ReadFile(path.Join(directory, layouts[i]))
+		if err != nil {
+			return parsedLayouts{err: err}
+		}
+		parent := "layout-default"
+		if i+1 < len(layouts) {
+			parent = fmt.Sprintf("layout-%d", i+1)
+		}
+		name := "node"
+		if i > 0 {
+			name = fmt.Sprintf("layout-%d", i)
+		}
+		source = parentLayout.ReplaceAll(source, []byte(fmt.Sprintf("template %q", parent)))
+		tree := parse.New(name)
+		tree.Mode = parse.SkipFuncCheck
+		trees := make(map[string]*parse.Tree)
+		if _, err := tree.Parse(string(source), "", "", trees); err != nil {
+			return parsedLayouts{err: fmt.Errorf("%s: %v", layouts[i], err)}
+		}
+		// The layout itself first, then the templates it defines
+		if trees[name] != nil {
+			parsed.trees = append(parsed.trees, trees[name])
+		}
+		for defined, tree := range trees {
+			if defined != name {
+				parsed.trees = append(parsed.trees, tree)
+			}
+		}
+	}
+	return parsed
+}
+
+// layoutTemplate returns a clone of t with "node" replaced by the layouts of
+// a page file, see parseLayouts.
+func layoutTemplate(t *template.Template, file string) (*template.Template, error) {
+	layouts := cachedLayouts(path.Dir(file))
+	if layouts.err != nil || len(layouts.trees) == 0 {
+		return nil, layouts.err
+	}
+	lt, err := t.Clone()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := lt.AddParseTree("layout-default", lt.Lookup("node").Tree); err != nil {
+		return nil, err
+	}
+	for _, tree := range layouts.trees {
+		// Executing a template escapes its trees in place
+		if _, err := lt.AddParseTree(tree.Name, tree.Copy()); err != nil {
+			return nil, err
+		}
+	}
+	return lt, nil
+}
+
+// executeLayout runs execute with the layouts of the node file, falling
+// back to t if they fail so that a broken layout never breaks the page.
+func executeLayout(w io.Writer, t *template.Template, node *Node, execute func(*template.Template, io.Writer) error) error {
+	if node.System || node.File == "" {
+		return execute(t, w)
+	}
+	lt, err := layoutTemplate(t, node.File)
+	if lt == nil {
+		if err != nil {
+			log.Printf("Cant use layout of %q, error: %v", node.File, err)
+		}
+		return execute(t, w)
+	}
+	var buf bytes.Buffer
+	if err := execute(lt, &buf); err != nil {
+		log.Printf("Cant render layout of %q, error: %v", node.File, err)
+		return execute(t, w)
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
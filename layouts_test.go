@@ -0,0 +1,90 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLayouts(t *testing.T) {
+	newTestWiki(t, map[string]string{
+		"top.md":             "# Top page\n",
+		"docs/api/page.md":   "# API page\n",
+		"blog/post.md":       "# Blog post\n",
+		"broken/page.md":     "# Broken page\n",
+		"_layout.tpl":        `<main class="root-layout">{{ template "parent" . }}</main>`,
+		"docs/_layout.tpl":   `<div class="docs-layout" data-path="{{ .Path }}">{{ template "parent" . }}</div>`,
+		"blog/_layout.tpl":   `<article class="blog-layout">{{ .Markdown }}</article>`,
+		"broken/_layout.tpl": `{{ template "parent" . }`,
+	})
+
+	if got := strings.Join(pageLayouts("docs/api/page.md"), " "); got != "docs/_layout.tpl _layout.tpl" {
+		t.Errorf("pageLayouts(docs/api/page.md) = %q, want the nearest first", got)
+	}
+
+	get := func(page string) string {
+		w := httptest.NewRecorder()
+		wikiHandler(w, httptest.NewRequest("GET", page, nil))
+		return w.Body.String()
+	}
+
+	body := get("/docs/api/page")
+	docs, root, content := strings.Index(body, `class="docs-layout"`), strings.Index(body, `class="root-layout"`), strings.Index(body, `id="api-page"`)
+	if docs < 0 || root < docs || content < root {
+		t.Errorf("/docs/api/page is not rendered in the docs layout, within the root layout, within node.tpl:\n%s", body)
+	}
+	if !strings.Contains(body, `data-path="/docs/api/page"`) {
+		t.Error("the docs layout does not get the page node")
+	}
+
+	body = get("/top")
+	if !strings.Contains(body, `class="root-layout"`) || strings.Contains(body, `class="docs-layout"`) || !strings.Contains(body, `id="top-page"`) {
+		t.Errorf("/top is not rendered in the root layout only:\n%s", body)
+	}
+
+	// A layout without the parent replaces the layouts above it
+	body = get("/blog/post")
+	if !strings.Contains(body, `<article class="blog-layout"><h1 id="blog-post">`) || strings.Contains(body, `class="root-layout"`) {
+		t.Errorf("/blog/post is not rendered in the blog layout alone:\n%s", body)
+	}
+
+	// A broken layout falls back to node.tpl
+	body = get("/broken/page")
+	if !strings.Contains(body, `id="broken-page"`) || strings.Contains(body, `class="root-layout"`) {
+		t.Errorf("/broken/page is not rendered without layouts:\n%s", body)
+	}
+}
+
+func TestLayoutsCached(t *testing.T) {
+	dir := newTestWiki(t, map[string]string{
+		"docs/page.md":     "# Page\n",
+		"docs/_layout.tpl": `{{ define "marker" }}<i class="old">{{ T "edit" }}</i>{{ end }}{{ template "marker" }}{{ template "parent" . }}`,
+	})
+	get := func() string {
+		w := httptest.NewRecorder()
+		wikiHandler(w, httptest.NewRequest("GET", "/docs/page", nil))
+		return w.Body.String()
+	}
+	if body := get(); !strings.Contains(body, `<i class="old">`+T("edit")+`</i>`) || !strings.Contains(body, `id="page"`) {
+		t.Fatalf("/docs/page is not rendered in its layout:\n%s", body)
+	}
+
+	writeTestFile(t, filepath.Join(dir, "docs/_layout.tpl"), `<i class="new"></i>{{ template "parent" . }}`)
+	if body := get(); !strings.Contains(body, `class="old"`) {
+		t.Error("the layout was read again before the caches were dropped")
+	}
+	invalidateCaches()
+	if body := get(); !strings.Contains(body, `class="new"`) || strings.Contains(body, `class="old"`) {
+		t.Errorf("the changed layout is not used once the caches were dropped:\n%s", body)
+	}
+	// Saving drops the caches too
+	writeTestFile(t, filepath.Join(dir, "docs/_layout.tpl"), `<i class="saved"></i>{{ template "parent" . }}`)
+	if w := postPage(t, nil, "/docs/page", "# Page\n\nChanged\n"); !strings.Contains(w.Body.String(), `class="saved"`) {
+		t.Errorf("the changed layout is not used after saving:\n%s", w.Body)
+	}
+}
@@ -0,0 +1,121 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// lintLineLength is the longest line outside of code blocks not reported.
+const lintLineLength = 120
+
+// lintIssue is a problem found in a page, on a line starting at 1.
+type lintIssue struct {
+	Line    int    `json:"line"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// lintPage checks the markdown of a page file for unbalanced code fences,
+// overly long lines, skipped heading levels and links to missing pages.
+func lintPage(file string, content []byte) []lintIssue {
+	issues := make([]lintIssue, 0)
+	_, source := parseFrontMatter(content)
+	offset := bytes.Count(content[:len(content)-len(source)], []byte("\n"))
+	lineOf := func(pos int) int {
+		return offset + bytes.Count(source[:pos], []byte("\n")) + 1
+	}
+
+	// Fences and line lengths, line by line
+	fence, fenceLine := "", 0
+	for i, line := range strings.Split(string(source), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if fence == "" && (strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")) {
+			fence, fenceLine = trimmed[:3], offset+i+1
+			continue
+		}
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				fence = ""
+			}
+			continue
+		}
+		if n := utf8.RuneCountInString(line); n > lintLineLength {
+			issues = append(issues, lintIssue{offset + i + 1, "line-length",
+				fmt.Sprintf("Line is %d characters long, more than %d", n, lintLineLength)})
+		}
+	}
+	if fence != "" {
+		issues = append(issues, lintIssue{fenceLine, "unclosed-fence", "Code fence is never closed"})
+	}
+
+	// Headings and links, from the parsed page
+	level := 0
+	doc := md.Parser().Parse(text.NewReader(source))
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := node.(type) {
+		case *ast.Heading:
+			if level > 0 && n.Level > level+1 && n.Lines().Len() > 0 {
+				issues = append(issues, lintIssue{lineOf(n.Lines().At(0).Start), "heading-skip",
+					fmt.Sprintf("Heading level %d follows level %d", n.Level, level)})
+			}
+			level = n.Level
+		case *ast.Link:
+			target, ok := linkTarget(file, string(n.Destination))
+			if !ok || pageExists(target) {
+				return ast.WalkContinue, nil
+			}
+			line := 0
+			if t, ok := n.FirstChild().(*ast.Text); ok {
+				line = lineOf(t.Segment.Start)
+			}
+			issues = append(issues, lintIssue{line, "broken-link",
+				fmt.Sprintf("Link to %s, which does not exist", target)})
+		}
+		return ast.WalkContinue, nil
+	})
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Line < issues[j].Line })
+	return issues
+}
+
+// pageExists reports whether a page path such as /docs/index has a file, or
+// is a file itself such as an image.
+func pageExists(page string) bool {
+	if _, err := os.Stat(path.Join(directory, page)); err == nil {
+		return true
+	}
+	_, err := os.Stat(path.Join(directory, resolveFile(strings.TrimPrefix(page, "/"))))
+	return err == nil
+}
+
+// validateHandler lints the posted content of a page for the editor.
+func validateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	page := r.PostFormValue("page")
+	if page == "" || strings.HasSuffix(page, "/") {
+		page = indexPage("/" + strings.TrimPrefix(page, "/"))
+	}
+	file := resolveFile(strings.TrimPrefix(page, "/"))
+	writeJSON(w, struct {
+		Issues []lintIssue `json:"issues"`
+	}{lintPage(file, []byte(r.PostFormValue("content")))})
+}
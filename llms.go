@@ -0,0 +1,101 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+)
+
+// llmsPage is a page listed in llms.txt.
+type llmsPage struct {
+	file    string
+	title   string
+	summary string
+	url     string
+}
+
+// llmsPages returns the published pages for llms.txt by directory, with the
+// pages of the root directory first. Pages with "noindex: true" are left out
+// like in the sitemap.
+func llmsPages() (dirs []string, pages map[string][]llmsPage) {
+	pages = make(map[string][]llmsPage)
+	files, _ := listPages("")
+	for _, file := range files {
+		summary, ok := cachedSummary(file)
+		if !ok || summary.unpublished || summary.noindex {
+			continue
+		}
+		page := llmsPage{file: file, title: summary.title, summary: summary.summary, url: baseURL + pageURL(file)}
+		if page.title == "" {
+			page.title = strings.TrimSuffix(path.Base(file), path.Ext(file))
+		}
+		dir := path.Dir(file)
+		if _, ok := pages[dir]; !ok {
+			dirs = append(dirs, dir)
+		}
+		pages[dir] = append(pages[dir], page)
+	}
+	sort.SliceStable(dirs, func(i, j int) bool {
+		return dirs[i] == "." || (dirs[j] != "." && dirs[i] < dirs[j])
+	})
+	return dirs, pages
+}
+
+// llmsHandler lists the pages in the llms.txt format: the wiki title, then
+// a section per directory linking its pages with their summaries.
+func llmsHandler(w http.ResponseWriter, r *http.Request) {
+	s := currentSettings()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "# %s\n", s.Title)
+	if baseURL != "" {
+		fmt.Fprintf(w, "\n> The pages of %s%s, also as a single file at %s%s/llms-full.txt\n",
+			baseURL, strings.TrimSuffix(basepath, "/"), baseURL, strings.TrimSuffix(basepath, "/"))
+	}
+	dirs, pages := llmsPages()
+	for _, dir := range dirs {
+		name := dir
+		if dir == "." {
+			name = homeLabel
+		}
+		fmt.Fprintf(w, "\n## %s\n\n", name)
+		for _, page := range pages[dir] {
+			fmt.Fprintf(w, "- [%s](%s)", page.title, page.url)
+			if page.summary != "" {
+				fmt.Fprintf(w, ": %s", page.summary)
+			}
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+// llmsFullHandler serves the content of all pages as a single markdown
+// file, each page headed by its title and URL.
+func llmsFullHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "# %s\n", currentSettings().Title)
+	dirs, pages := llmsPages()
+	for _, dir := range dirs {
+		for _, page := range pages[dir] {
+			bytes, err := ioutil.ReadFile(path.Join(directory, page.file))
+			if err != nil {
+				log.Printf("Cant read file %q, error: %v", page.file, err)
+				continue
+			}
+			node := &Node{File: page.file, Bytes: stripBOM(bytes)}
+			content := node.PlainText()
+			if path.Ext(page.file) == ".md" {
+				_, source := parseFrontMatter(node.Bytes)
+				content = strings.TrimSpace(string(source))
+			}
+			fmt.Fprintf(w, "\n---\n\n# %s\n\nURL: %s\n\n%s\n", page.title, page.url, content)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// editLock is the advisory lock of a page editor, see -edit-lock. It only
+// warns other editors and never blocks saving.
+type editLock struct {
+	token   string
+	author  string
+	since   time.Time
+	expires time.Time
+}
+
+// editLocks holds the locks by page file.
+var editLocks = struct {
+	sync.Mutex
+	locks map[string]*editLock
+}{locks: make(map[string]*editLock)}
+
+// lockPage acquires the lock of a file for author, or refreshes it when token
+// holds it. Returns the lock and whether it is held by the caller, otherwise
+// it is the lock of another editor.
+func lockPage(file, token, author string) (editLock, bool) {
+	editLocks.Lock()
+	defer editLocks.Unlock()
+	now := time.Now()
+	for f, lock := range editLocks.locks {
+		if now.After(lock.expires) {
+			delete(editLocks.locks, f)
+		}
+	}
+	lock, ok := editLocks.locks[file]
+	if ok && lock.token != token {
+		return *lock, false
+	}
+	if !ok {
+		lock = &editLock{token: randomHex(8), author: author, since: now}
+		editLocks.locks[file] = lock
+	}
+	lock.expires = now.Add(editLockTTL)
+	return *lock, true
+}
+
+// isLocked reports whether token holds the lock of a file.
+func isLocked(file, token string) bool {
+	editLocks.Lock()
+	defer editLocks.Unlock()
+	lock, ok := editLocks.locks[file]
+	return ok && token != "" && lock.token == token && time.Now().Before(lock.expires)
+}
+
+// unlockPage releases the lock of a file, if token holds it.
+func unlockPage(file, token string) {
+	editLocks.Lock()
+	defer editLocks.Unlock()
+	if lock, ok := editLocks.locks[file]; ok && lock.token == token {
+		delete(editLocks.locks, file)
+	}
+}
+
+// lockNode sets the lock state of the editor of a node, acquiring the lock
+// when it is free.
+func lockNode(node *Node, token string) {
+	lock, held := lockPage(node.File, token, node.Author)
+	node.LockRefresh = int(editLockTTL/time.Millisecond) / 3
+	if held {
+		node.LockToken = lock.token
+	} else {
+		node.LockedBy = lock.author
+		node.LockedSince = int(time.Since(lock.since) / time.Minute)
+	}
+}
+
+// lockHandler acquires, refreshes or with release=1 releases the edit lock of
+// the posted page for the token, answering with the lock state. Only those
+// who may edit the page lock it, and only existing pages, as new pages are
+// locked by opening their editor.
+func lockHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	page := "/" + strings.TrimPrefix(r.PostFormValue("page"), "/")
+	if strings.HasSuffix(page, "/") {
+		page = indexPage(page)
+	}
+	node := &Node{File: resolveFile(strings.TrimPrefix(page, "/")), Author: commitAuthor(r)}
+	token := r.PostFormValue("token")
+	if currentSettings().ReadOnly {
+		http.Error(w, "The wiki is read only", http.StatusForbidden)
+		return
+	}
+	if isReserved(page) {
+		http.Error(w, "This path is reserved", http.StatusBadRequest)
+		return
+	}
+	if isProtected(page, node.File) && (!requireAdmin(w, r) || !checkCSRF(w, r)) {
+		return
+	}
+	if submodule := submoduleOf(node.File); submodule != "" {
+		http.Error(w, fmt.Sprintf("This page belongs to the submodule %q, change it there", submodule), http.StatusForbidden)
+		return
+	}
+	if _, err := os.Stat(path.Join(directory, node.File)); err != nil && !isLocked(node.File, token) {
+		http.NotFound(w, r)
+		return
+	}
+	if parseBool(r.PostFormValue("release")) {
+		unlockPage(node.File, token)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	lockNode(node, token)
+	writeJSON(w, struct {
+		Token   string `json:"token,omitempty"`
+		Editor  string `json:"editor,omitempty"`
+		Minutes int    `json:"minutes"`
+	}{node.LockToken, node.LockedBy, node.LockedSince})
+}
@@ -0,0 +1,67 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// postLock posts to the edit lock handler.
+func postLock(r func(*http.Request) *http.Request, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/_lock", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if r != nil {
+		req = r(req)
+	}
+	w := httptest.NewRecorder()
+	lockHandler(w, req)
+	return w
+}
+
+func TestLockHandler(t *testing.T) {
+	newTestWiki(t, map[string]string{
+		"a.md":         "a\n",
+		"protected.md": "---\nprotected: true\n---\nsecret\n",
+	})
+	authorize := asAdmin(t)
+	defer func(old time.Duration) { editLockTTL = old }(editLockTTL)
+	editLockTTL = time.Minute
+	t.Cleanup(func() {
+		editLocks.Lock()
+		editLocks.locks = make(map[string]*editLock)
+		editLocks.Unlock()
+	})
+	held, _ := lockPage("new.md", "", "tester")
+
+	tests := []struct {
+		r    func(*http.Request) *http.Request
+		form url.Values
+		code int
+	}{
+		{nil, url.Values{"page": {"/a"}}, http.StatusOK},
+		{nil, url.Values{"page": {"/missing"}}, http.StatusNotFound},
+		{nil, url.Values{"page": {"/new"}}, http.StatusNotFound},
+		{nil, url.Values{"page": {"/new"}, "token": {held.token}}, http.StatusOK},
+		{nil, url.Values{"page": {"/protected"}}, http.StatusUnauthorized},
+		{authorize, url.Values{"page": {"/protected"}}, http.StatusForbidden},
+		{authorize, url.Values{"page": {"/protected"}, "csrf": {editToken(t, authorize, "/protected")}}, http.StatusOK},
+	}
+	for _, test := range tests {
+		if w := postLock(test.r, test.form); w.Code != test.code {
+			t.Errorf("locking %v answered %d, want %d: %s", test.form, w.Code, test.code, w.Body)
+		}
+	}
+
+	defer func(old Settings) { settings = old }(settings)
+	settings.ReadOnly = true
+	if w := postLock(nil, url.Values{"page": {"/a"}}); w.Code != http.StatusForbidden {
+		t.Errorf("locking a page of a read only wiki answered %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
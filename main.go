@@ -5,21 +5,243 @@ GNU GPLv3 - see LICENSE
 package main
 
 import (
+	"context"
 	"flag"
+	"html/template"
+	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/exec"
+	"strings"
+	"time"
 )
 
-// RevisionLogLimit limits the maximum amount of revisions shown for a page
-const RevisionLogLimit = 5
-
 var (
 	// default values, can be overriden by flags
 	directory = "files"
 	address   = ":8080"
 	title     = "gopages"
 	basepath  = "/"
+	homeLabel = "Home"
+
+	// baseURL is the public address of the wiki, without the base path
+	baseURL = ""
+
+	// robotsFile replaces the default robots.txt
+	robotsFile = ""
+
+	// llmsTxt serves the pages for language model tools at /llms.txt
+	llmsTxt = false
+
+	// logLimit limits the maximum amount of revisions shown for a page
+	logLimit = 5
+
+	// settingsFile stores the settings changed while running
+	settingsFile = "settings.json"
+
+	// adminUser and adminPassword protect the administration pages, which
+	// are disabled without a password
+	adminUser     = "admin"
+	adminPassword = ""
+
+	// extensions lists the recognised page file extensions, in resolution order
+	extensions = []string{".md"}
+
+	// pageSuffixes are stripped from requested paths, the extensions and .html
+	pageSuffixes = []string{".md", ".html"}
+
+	// defaultAuthor commits changes without any other author, empty for the
+	// git identity of the repository, or else to reject them
+	defaultAuthor = ""
+
+	// noAuthorCookie never remembers authors in a cookie
+	noAuthorCookie = false
+
+	// store keeps the pages and their history, see -storage
+	store Store = gitStore{}
+
+	// signCommits signs every commit, optionally with signingKey
+	signCommits = false
+	signingKey  = ""
+
+	// trustedProxies may set the forwarding headers with the client address
+	trustedProxies []*net.IPNet
+	accessLog      = false
+
+	// authHeader is the header in which trusted proxies pass the user they
+	// authenticated, empty to not trust any
+	authHeader = ""
+
+	// protectedPages can only be changed by administrators, entries ending
+	// with a slash protect all pages below them
+	protectedPages []string
+
+	// maxRevisions limits the history kept in the repository, 0 keeps all
+	maxRevisions = 0
+	allowPrune   = false
+
+	// amendWindow is the time in seconds within which further changes of
+	// the same author to the same page amend the previous commit
+	amendWindow = 0
+
+	// squashIdle defers commits until their author has been idle that long,
+	// squashing the changes in between into one commit
+	squashIdle = time.Duration(0)
+
+	// Server timeouts, protecting against clients holding connections open
+	readHeaderTimeout = 10 * time.Second
+	readTimeout       = 30 * time.Second
+	writeTimeout      = 60 * time.Second
+	idleTimeout       = 120 * time.Second
+
+	// defaultCache is the time in seconds clients may cache page views
+	defaultCache = 0
+
+	// staticCache is the time in seconds clients may cache static files of
+	// the asset URLs, 0 leaves them unversioned
+	staticCache = 365 * 24 * 60 * 60
+
+	// cacheTTL limits how long content derived caches are kept, to pick up
+	// changes made outside of the wiki
+	cacheTTL = time.Minute
+
+	// searchMaxResults and searchTimeout stop a search early, 0 without limit
+	searchMaxResults = 50
+	searchTimeout    = 2 * time.Second
+
+	// watchChanges drops those caches as soon as files change outside of the
+	// wiki, once no further changes came for watchDelay
+	watchChanges = false
+	watchDelay   = 500 * time.Millisecond
+
+	// maxDepth limits how deep directory listings go, 0 without limit
+	maxDepth = 0
+
+	// indexNames are the pages of a directory, the first existing one is shown
+	indexNames = []string{"index"}
+
+	// enableMetrics serves /metrics, to administrators only with metricsAuth
+	enableMetrics = false
+	metricsAuth   = false
+
+	// enableTracing exports spans of the requests to the OTEL_* configured collector
+	enableTracing = false
+
+	// headingOffset shifts the heading levels of pages down
+	headingOffset = 0
+
+	// sectionBytes splits larger pages at their top-level headings, 0 never
+	sectionBytes = 0
+
+	// autolinkRules turn references such as #123 into links
+	autolinkRules []autolinkRule
+
+	// rewriteRules map request paths to page files, the first match wins
+	rewriteRules []rewriteRule
+
+	// useEmoji replaces :shortcode: emoji in pages
+	useEmoji = false
+
+	// dataTables renders CSV and TSV files as tables, with csvDelimiter
+	// separating the fields of CSV files
+	dataTables   = false
+	csvDelimiter = ','
+
+	// slugRedirects redirects missing pages to pages differing only in case
+	// or separators
+	slugRedirects = false
+
+	// indexSummaries lists the pages of directories without an index page,
+	// with their titles and first paragraphs
+	indexSummaries = false
+
+	// shortcuts maps keys to navigation actions, nil without shortcuts
+	shortcuts map[string]string
+
+	// smartypants replaces straight quotes, dashes and ellipses with their
+	// typographic forms
+	smartypants = false
+
+	// useCodeCopy adds a copy button to code blocks
+	useCodeCopy = false
+
+	// editableTasks allows toggling task list items without the editor
+	editableTasks = false
+
+	// maxPageBytes limits the size of saved pages, 0 without limit
+	maxPageBytes = 1 << 20
+
+	// diskCacheDir keeps the rendered markdown across restarts, limited to
+	// diskCacheBytes, empty without disk cache
+	diskCacheDir   = ""
+	diskCacheBytes = int64(256 << 20)
+
+	// maxBodyBytes limits the size of request bodies, 0 without limit
+	maxBodyBytes = int64(10 << 20)
+
+	// editLockTTL is how long an editor holds the advisory lock of a page
+	// without refreshing it, 0 without locks
+	editLockTTL = time.Duration(0)
+
+	// encodingCheck handles saved content that is not UTF-8: reject, replace or off
+	encodingCheck = "reject"
+
+	// favicon and touchIcon are the icons of the wiki
+	favicon   = "static/favicon.png"
+	touchIcon = "static/apple-touch-icon.png"
+
+	// newPageTemplate pre-fills the editor for new pages
+	newPageTemplate = ""
+
+	// pdfCommand converts HTML on stdin to PDF on stdout, for example "wkhtmltopdf - -"
+	pdfCommand = ""
+
+	// postCommitHook runs after every commit of a change, see runPostCommitHook
+	postCommitHook = ""
+
+	// hostMap is a JSON file serving other hosts from directories of their own
+	hostMap        = ""
+	unknownHost404 = false
+
+	// timezone shows and records times in a zone other than the server's,
+	// nil keeps relative times
+	timezone *time.Location
+
+	// extraCSS is a stylesheet linked on every page
+	extraCSS = ""
+
+	// inlineHTML is the inline HTML allowed in pages, nil omits all of it
+	inlineHTML *htmlPolicy
+
+	// stripComments leaves the HTML comments of pages out of the rendering
+	stripComments = false
+
+	// blocklist are the patterns rejecting changes of page content
+	blocklist []blockPattern
+
+	// inlineHistory is the number of revisions listed below a page, 0 lists none
+	inlineHistory = 0
+
+	// recentPages is the number of recently viewed pages kept in a cookie
+	recentPages = 5
+	noTracking  = false
+
+	// language of the user interface, see the lang directory
+	language = defaultLanguage
+
+	// Suggested change messages, {page} is replaced by the page name
+	msgEdit   = "Edit {page}"
+	msgCreate = "Create {page}"
+
+	// repoURL links every page to its file in the hosted content repository
+	repoURL    = ""
+	repoBranch = "main"
+
+	// extraHead and extraFooter hold trusted operator provided HTML
+	extraHead   template.HTML
+	extraFooter template.HTML
 )
 
 func main() {
@@ -28,6 +250,91 @@ func main() {
 	flagAddress := flag.String("address", address, "address for the webserver to bind to, example: 0.0.0.0:8000")
 	flagTitle := flag.String("title", title, "title to display")
 	flagBasepath := flag.String("basepath", basepath, "base path, for web application proxy pass")
+	flagBaseURL := flag.String("base-url", baseURL, "public address of the wiki without the base path, example: https://wiki.example.com")
+	flagLLMsTxt := flag.Bool("llms-txt", llmsTxt, "list the pages at /llms.txt and serve all of them as one file at /llms-full.txt")
+	flagRobotsFile := flag.String("robots-file", robotsFile, "file served as robots.txt instead of the default rules")
+	flagHomeLabel := flag.String("home-label", homeLabel, "label of the root page in the navigation")
+	flagLogLimit := flag.Int("log-limit", logLimit, "maximum amount of revisions shown for a page")
+	flagReadOnly := flag.Bool("read-only", false, "reject all changes to the wiki")
+	flagMaintenance := flag.Bool("maintenance", false, "show a maintenance page to everyone but administrators")
+	flagSettingsFile := flag.String("settings-file", settingsFile, "file storing settings changed while running, empty to not store them")
+	flagAdminUser := flag.String("admin-user", adminUser, "user name for the administration pages")
+	flagAdminPassword := flag.String("admin-password", adminPassword, "password for the administration pages, empty disables them")
+	flagStorage := flag.String("storage", "git", "storage of the pages: git, or fs for plain files without history")
+	flagDefaultAuthor := flag.String("default-author", defaultAuthor, "author of changes made without a name, defaults to the git user.name and user.email of the repository, which are otherwise asked for")
+	flagNoAuthorCookie := flag.Bool("no-author-cookie", noAuthorCookie, "never remember the author of changes in a cookie")
+	flagSign := flag.Bool("sign", signCommits, "sign commits, changes are rejected when signing fails")
+	flagSigningKey := flag.String("signing-key", signingKey, "key id used to sign commits, default is the git user.signingkey")
+	flagAuthHeader := flag.String("auth-header", authHeader, "header in which trusted proxies pass the authenticated user, used as the author of changes, example: X-Forwarded-User")
+	flagTrustedProxies := flag.String("trusted-proxies", "", "comma separated CIDRs of proxies trusted to set X-Forwarded-For, example: 127.0.0.1/32,10.0.0.0/8")
+	flagAccessLog := flag.Bool("access-log", accessLog, "log every request")
+	flagMetrics := flag.Bool("metrics", enableMetrics, "serve Prometheus metrics at /metrics")
+	flagTracing := flag.Bool("tracing", enableTracing, "export OpenTelemetry traces, configured by the OTEL_EXPORTER_OTLP_* environment variables")
+	flagMetricsAuth := flag.Bool("metrics-auth", metricsAuth, "only serve the metrics to administrators")
+	flagProtected := flag.String("protected", "", "comma separated list of pages only administrators may change, example: /index,/docs/")
+	flagMaxRevisions := flag.Int("max-revisions", maxRevisions, "squash the repository history beyond this many revisions, 0 keeps all (requires -allow-prune)")
+	flagAllowPrune := flag.Bool("allow-prune", allowPrune, "confirm that history may be rewritten by -max-revisions and /_prune")
+	flagGitConcurrency := flag.Int("git-concurrency", 0, "maximum number of git commands running at once, others wait, 0 without limit")
+	flagSquashIdle := flag.Duration("squash-idle", squashIdle, "squash the changes of an author into a single commit once they have been idle this long, example: 5m")
+	flagAmendWindow := flag.Int("amend-window", amendWindow, "seconds within which repeated changes of an author to a page amend the previous commit, 0 never amends")
+	flagReadHeaderTimeout := flag.Duration("read-header-timeout", readHeaderTimeout, "maximum duration for reading request headers")
+	flagReadTimeout := flag.Duration("read-timeout", readTimeout, "maximum duration for reading a request")
+	flagWriteTimeout := flag.Duration("write-timeout", writeTimeout, "maximum duration for writing a response")
+	flagIdleTimeout := flag.Duration("idle-timeout", idleTimeout, "maximum duration to keep idle connections open")
+	flagStaticCache := flag.Int("static-cache", staticCache, "seconds clients may cache static files, which are linked with their content hash, 0 links them without")
+	flagDefaultCache := flag.Int("default-cache", defaultCache, "seconds clients may cache page views, pages can override it with cache in their front matter")
+	flagMaxDepth := flag.Int("max-depth", maxDepth, "deepest directory level walked for listings and shown in full in the navigation, 0 without limit")
+	flagCacheTTL := flag.Duration("cache-ttl", cacheTTL, "maximum age of cached directory listings")
+	flagSearchMaxResults := flag.Int("search-max-results", searchMaxResults, "most pages a search returns, 0 without limit")
+	flagSearchTimeout := flag.Duration("search-timeout", searchTimeout, "longest a search scans the pages, 0 without limit")
+	flagWatch := flag.Bool("watch", watchChanges, "drop cached listings as soon as files of the wiki directory change outside of the wiki")
+	flagWatchDelay := flag.Duration("watch-delay", watchDelay, "how long --watch waits for further changes before dropping the caches")
+	flagIndexNames := flag.String("index-names", strings.Join(indexNames, ","), "comma separated pages shown for a directory, the first existing one wins, example: index,README,home")
+	flagHeadingOffset := flag.Int("heading-offset", headingOffset, "shift heading levels of pages down, so # becomes <h2> with 1")
+	flagSectionBytes := flag.Int("section-bytes", sectionBytes, "render pages larger than this many bytes one top-level section at a time, loading later sections as the reader scrolls, 0 never splits")
+	var flagAutolinks stringList
+	flag.Var(&flagAutolinks, "autolink-pattern", "link text matching a pattern, can be repeated, example: \"#(\\d+)->https://tracker/issues/$1\"")
+	var flagRewrites stringList
+	flag.Var(&flagRewrites, "rewrite", "serve the request paths matching a pattern from a page file, can be repeated, the first match wins, example: \"^/blog/(\\d+)/(.*)$->posts/$2.md\"")
+	flagDataTables := flag.Bool("data-tables", dataTables, "render .csv and .tsv files as sortable tables, ?raw=1 downloads them")
+	flagSlugRedirects := flag.Bool("slug-redirects", slugRedirects, "redirect missing pages to the page differing only in case, spaces, underscores or dashes")
+	flagIndexSummaries := flag.Bool("index-summaries", indexSummaries, "list the pages of directories without an index page, with their titles and summaries")
+	flagCSVDelimiter := flag.String("csv-delimiter", string(csvDelimiter), "field delimiter of .csv files, example: ;")
+	flagShortcuts := flag.Bool("shortcuts", false, "navigate with keyboard shortcuts: e edits, h shows the history, / focuses the search and r the recent changes")
+	flagShortcutsFile := flag.String("shortcuts-file", "", "JSON file overriding the keyboard shortcuts, example: {\"E\": \"edit\", \"e\": \"\"}")
+	flagSmartypants := flag.Bool("smartypants", smartypants, "render straight quotes, -- and ... as typographic quotes, dashes and ellipses")
+	flagEmoji := flag.Bool("emoji", useEmoji, "replace emoji shortcodes such as :rocket: in pages")
+	flagCodeCopy := flag.Bool("code-copy", useCodeCopy, "add a copy button to code blocks")
+	flagEditableTasks := flag.Bool("editable-tasks", editableTasks, "allow toggling task list items on the page")
+	flagExtensions := flag.String("extensions", strings.Join(extensions, ","), "comma separated list of page extensions, tried in order")
+	flagDiskCacheDir := flag.String("disk-cache-dir", diskCacheDir, "directory keeping the rendered pages gzipped across restarts, example: /var/cache/go-pages")
+	flagDiskCacheBytes := flag.Int64("disk-cache-bytes", diskCacheBytes, "size of the disk cache in bytes, beyond which the least recently used pages are dropped, 0 without limit")
+	flagMaxBodyBytes := flag.Int64("max-body-bytes", maxBodyBytes, "maximum size of a request body in bytes, larger ones get a 413, 0 without limit")
+	flagEditLock := flag.Duration("edit-lock", editLockTTL, "warn editors of a page opened by another one, the lock expires this long after the editor closed, 0 disables, example: 5m")
+	flagEncodingCheck := flag.String("encoding-check", encodingCheck, "saving content that is not valid UTF-8: reject, replace invalid bytes, or off (also keeps a BOM)")
+	flagMaxPageBytes := flag.Int("max-page-bytes", maxPageBytes, "maximum size of a saved page in bytes, 0 without limit")
+	flagFavicon := flag.String("favicon", favicon, "file served as favicon")
+	flagTouchIcon := flag.String("touch-icon", touchIcon, "file served as apple-touch-icon")
+	flagNewPageTemplate := flag.String("new-page-template", newPageTemplate, "file pre-filling the editor for new pages, directories can have their own _template.md")
+	flagPostCommitHook := flag.String("post-commit-hook", postCommitHook, "command run in the background after every commit, with the file and revision as arguments and the author in GO_PAGES_AUTHOR")
+	flagPdfCommand := flag.String("pdf-command", pdfCommand, "command converting HTML on stdin to PDF on stdout, example: \"wkhtmltopdf - -\"")
+	flagHostMap := flag.String("host-map", hostMap, "JSON file mapping host names to the directory and title of their wiki")
+	flagUnknownHost404 := flag.Bool("unknown-host-404", unknownHost404, "answer hosts missing in the host map with 404 rather than serving -dir")
+	flagTimezone := flag.String("timezone", "", "IANA time zone of commit and revision times and publish dates, example: Europe/Berlin, default is the server's zone")
+	flagExtraCSS := flag.String("extra-css", extraCSS, "URL of a stylesheet linked on every page, example: /static/css/custom.css")
+	flagStripComments := flag.Bool("strip-comments", stripComments, "leave HTML comments such as <!-- TODO --> in pages out of the rendered page")
+	flagBlocklist := flag.String("blocklist", "", "file of regular expressions, one per line, rejecting changes with content matching any of them as a whole word")
+	flagHTMLAllowlist := flag.String("html-allowlist", "", "JSON file with the inline HTML tags, attributes and iframe hosts allowed in pages")
+	flagInlineHistory := flag.Int("inline-history", inlineHistory, "number of latest revisions listed in a collapsible panel below every page, at most -log-limit, 0 lists none")
+	flagRecentPages := flag.Int("recent-pages", recentPages, "number of recently viewed pages shown to readers")
+	flagNoTracking := flag.Bool("no-tracking", noTracking, "do not keep recently viewed pages in a cookie")
+	flagLang := flag.String("lang", language, "language of the user interface, one of the files in the lang directory")
+	flagMsgEdit := flag.String("msg-edit", msgEdit, "suggested change message for editing a page, {page} is replaced by the page name")
+	flagMsgCreate := flag.String("msg-create", msgCreate, "suggested change message for creating a page, {page} is replaced by the page name")
+	flagRepoURL := flag.String("repo-url", repoURL, "URL of the content repository on GitHub, adds an edit link to every page, example: https://github.com/user/wiki")
+	flagRepoBranch := flag.String("repo-branch", repoBranch, "branch of the content repository the edit link points to")
+	flagHeadHTML := flag.String("head-html", "", "file with extra HTML to include in the page head")
+	flagFooterHTML := flag.String("footer-html", "", "file with extra HTML to include in the page footer")
 	flag.Parse()
 
 	// Update global variables to possibly overriden ones
@@ -35,20 +342,335 @@ func main() {
 	address = *flagAddress
 	title = *flagTitle
 	basepath = *flagBasepath
+	homeLabel = *flagHomeLabel
+	baseURL = strings.TrimSuffix(*flagBaseURL, "/")
+	robotsFile = *flagRobotsFile
+	llmsTxt = *flagLLMsTxt
+	logLimit = *flagLogLimit
+	settingsFile = *flagSettingsFile
+	adminUser = *flagAdminUser
+	authHeader = *flagAuthHeader
+	adminPassword = *flagAdminPassword
+	var ok bool
+	if store, ok = stores[*flagStorage]; !ok {
+		log.Fatalf("WARNING: unknown storage %q", *flagStorage)
+	}
+	defaultAuthor = *flagDefaultAuthor
+	noAuthorCookie = *flagNoAuthorCookie
+	signCommits = *flagSign
+	signingKey = *flagSigningKey
+	var err error
+	if *flagTimezone != "" {
+		if timezone, err = time.LoadLocation(*flagTimezone); err != nil {
+			log.Fatalf("WARNING: invalid time zone %q: %v", *flagTimezone, err)
+		}
+	}
+	if trustedProxies, err = parseProxies(*flagTrustedProxies); err != nil {
+		log.Fatalf("WARNING: invalid trusted proxies %q: %v", *flagTrustedProxies, err)
+	}
+	if authHeader != "" && len(trustedProxies) == 0 {
+		log.Fatalf("WARNING: the auth header %q needs trusted proxies", authHeader)
+	}
+	accessLog = *flagAccessLog
+	enableMetrics = *flagMetrics
+	metricsAuth = *flagMetricsAuth
+	enableTracing = *flagTracing
+	protectedPages = parseList(*flagProtected)
+	maxRevisions = *flagMaxRevisions
+	allowPrune = *flagAllowPrune
+	if maxRevisions < 0 {
+		maxRevisions = 0
+	}
+	if maxRevisions > 0 && !allowPrune {
+		log.Fatalf("WARNING: -max-revisions permanently rewrites history, confirm with -allow-prune")
+	}
+	amendWindow = *flagAmendWindow
+	squashIdle = *flagSquashIdle
+	if *flagGitConcurrency > 0 {
+		gitSlots = make(chan struct{}, *flagGitConcurrency)
+	}
+	readHeaderTimeout = *flagReadHeaderTimeout
+	readTimeout = *flagReadTimeout
+	writeTimeout = *flagWriteTimeout
+	idleTimeout = *flagIdleTimeout
+	defaultCache = *flagDefaultCache
+	staticCache = *flagStaticCache
+	cacheTTL = *flagCacheTTL
+	searchMaxResults = *flagSearchMaxResults
+	searchTimeout = *flagSearchTimeout
+	watchChanges = *flagWatch
+	watchDelay = *flagWatchDelay
+	maxDepth = *flagMaxDepth
+	headingOffset = *flagHeadingOffset
+	sectionBytes = *flagSectionBytes
+	for _, value := range flagAutolinks {
+		rule, err := parseAutolinkRule(value)
+		if err != nil {
+			log.Fatalf("WARNING: invalid autolink pattern %q: %v", value, err)
+		}
+		autolinkRules = append(autolinkRules, rule)
+	}
+	useEmoji = *flagEmoji
+	smartypants = *flagSmartypants
+	if *flagShortcuts {
+		if shortcuts, err = loadShortcuts(*flagShortcutsFile); err != nil {
+			log.Fatalf("WARNING: invalid shortcuts file %q: %v", *flagShortcutsFile, err)
+		}
+	}
+	dataTables = *flagDataTables
+	indexSummaries = *flagIndexSummaries
+	slugRedirects = *flagSlugRedirects
+	if delimiter := []rune(*flagCSVDelimiter); len(delimiter) != 1 || delimiter[0] == '"' || delimiter[0] == '\n' || delimiter[0] == '\r' {
+		log.Fatalf("WARNING: invalid CSV delimiter %q", *flagCSVDelimiter)
+	} else {
+		csvDelimiter = delimiter[0]
+	}
+	useCodeCopy = *flagCodeCopy
+	editableTasks = *flagEditableTasks
+	maxPageBytes = *flagMaxPageBytes
+	maxBodyBytes = *flagMaxBodyBytes
+	diskCacheDir = *flagDiskCacheDir
+	diskCacheBytes = *flagDiskCacheBytes
+	editLockTTL = *flagEditLock
+	encodingCheck = *flagEncodingCheck
+	if encodingCheck != "reject" && encodingCheck != "replace" && encodingCheck != "off" {
+		log.Fatalf("WARNING: unknown encoding check %q", encodingCheck)
+	}
+	favicon = *flagFavicon
+	touchIcon = *flagTouchIcon
+	newPageTemplate = *flagNewPageTemplate
+	pdfCommand = *flagPdfCommand
+	postCommitHook = *flagPostCommitHook
+	if args := strings.Fields(pdfCommand); len(args) > 0 {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			log.Printf("WARNING: PDF exports will fail, %v", err)
+		}
+	}
+	hostMap = *flagHostMap
+	extraCSS = *flagExtraCSS
+	unknownHost404 = *flagUnknownHost404
+	if *flagHTMLAllowlist != "" {
+		if inlineHTML, err = loadHTMLPolicy(*flagHTMLAllowlist); err != nil {
+			log.Fatalf("WARNING: invalid HTML allowlist %q: %v", *flagHTMLAllowlist, err)
+		}
+	}
+	stripComments = *flagStripComments
+	if *flagBlocklist != "" {
+		if blocklist, err = loadBlocklist(*flagBlocklist); err != nil {
+			log.Fatalf("WARNING: invalid blocklist %q: %v", *flagBlocklist, err)
+		}
+	}
+	recentPages = *flagRecentPages
+	inlineHistory = *flagInlineHistory
+	noTracking = *flagNoTracking
+	language = *flagLang
+	if err := loadLanguage(language); err != nil {
+		log.Fatalf("WARNING: could not load language %q: %v", language, err)
+	}
+	msgEdit = *flagMsgEdit
+	msgCreate = *flagMsgCreate
+	repoURL = strings.TrimSuffix(*flagRepoURL, "/")
+	repoBranch = *flagRepoBranch
+	extensions = parseExtensions(*flagExtensions)
+	if len(extensions) == 0 {
+		log.Fatalf("WARNING: no page extensions specified!")
+	}
+	pageSuffixes = append(append([]string(nil), extensions...), ".html")
+	indexNames = nil
+	for _, name := range parseList(*flagIndexNames) {
+		for _, ext := range extensions {
+			name = strings.TrimSuffix(name, ext)
+		}
+		if name == "" || strings.Contains(name, "/") {
+			log.Fatalf("WARNING: invalid index name %q", name)
+		}
+		indexNames = append(indexNames, name)
+	}
+	if len(indexNames) == 0 {
+		log.Fatalf("WARNING: --index-names needs at least one name")
+	}
+	for _, value := range flagRewrites {
+		rule, err := parseRewriteRule(value)
+		if err != nil {
+			log.Fatalf("WARNING: invalid rewrite rule %q: %v", value, err)
+		}
+		rewriteRules = append(rewriteRules, rule)
+	}
+
+	extraHead = readHTMLFile(*flagHeadHTML)
+	extraFooter = readHTMLFile(*flagFooterHTML)
+
+	// An empty address would silently bind to port 80
+	if strings.TrimSpace(address) == "" {
+		log.Fatalf("WARNING: no address specified, use for example -address=:8080")
+	}
+
+	// Renderer depends on the flags
+	md = newMarkdown()
+
+	// Settings changed while running take precedence over the flags
+	settings = Settings{Title: title, LogLimit: logLimit, ReadOnly: *flagReadOnly, Maintenance: *flagMaintenance}
+	if err := loadSettings(); err != nil {
+		log.Fatalf("WARNING: could not load settings from %q: %v", settingsFile, err)
+	}
 
 	// Check if wiki data directory exists
 	if _, err := os.Stat(directory); err != nil {
 		log.Fatalf("WARNING: the specified directory (%q) does not exist!", directory)
 	}
+	if _, ok := store.(gitStore); ok && isBareRepository() {
+		worktree, err := openBareRepository()
+		if err != nil {
+			log.Fatalf("WARNING: could not check out the bare repository %q: %v", directory, err)
+		}
+		log.Printf("Serving bare repository %q from worktree %q", directory, worktree)
+		directory = worktree
+	}
+	if _, ok := store.(gitStore); ok && defaultAuthor == "" {
+		if defaultAuthor = gitIdentity(); defaultAuthor != "" {
+			log.Printf("Committing changes without an author as %q", defaultAuthor)
+		}
+	}
+
+	if diskCacheDir != "" {
+		if err := loadDiskCache(); err != nil {
+			log.Fatalf("WARNING: could not use the disk cache %q: %v", diskCacheDir, err)
+		}
+	}
 
 	// Static files (js, css, etc)
 	fileServer := http.FileServer(http.Dir("./static"))
-	http.Handle("/static/", http.StripPrefix("/static/", fileServer))
+	handle("/static/", http.StripPrefix("/static/", withAssetCache(fileServer)))
 
 	// Wiki handlers
 	http.HandleFunc("/", wikiHandler)
+	handleFunc("/favicon.ico", iconHandler(favicon))
+	handleFunc("/apple-touch-icon.png", iconHandler(touchIcon))
+	handleFunc("/robots.txt", robotsHandler)
+	handleFunc("/sitemap.xml", sitemapHandler)
+	handleFunc("/feed.json", feedHandler)
+	if llmsTxt {
+		handleFunc("/llms.txt", llmsHandler)
+		handleFunc("/llms-full.txt", llmsFullHandler)
+	}
+	handleFunc("/_book/", bookHandler)
+	handleFunc("/_export", exportHandler)
+	handleFunc("/_export/", exportHandler)
+	handleFunc("/api/history/", historyHandler)
+	handleFunc("/api/meta/", metaHandler)
+	handleFunc("/_settings", settingsHandler)
+	handleFunc("/_prune", pruneHandler)
+	handleFunc("/_admin", adminHandler)
+	handleFunc("/_backlinks/", backlinksHandler)
+	handleFunc("/_authors", authorsHandler)
+	handleFunc("/_recent", recentHandler)
+	handleFunc("/_changes", changesHandler)
+	handleFunc("/_validate", validateHandler)
+	handleFunc("/_search", searchHandler)
+	if editLockTTL > 0 {
+		handleFunc("/_lock", lockHandler)
+	}
+	handleFunc("/_style/", styleHandler)
+	if enableMetrics {
+		handleFunc("/metrics", metricsHandler)
+	}
+
+	// Build the backlinks and aliases ahead of the first request for them
+	go cachedBacklinks()
+	go cachedAliases()
+
+	var handler http.Handler = withErrorPages(withRecovery(withMaintenance(withSignedIn(withBodyLimit(http.DefaultServeMux)))))
+	if accessLog {
+		handler = withAccessLog(handler)
+	}
+	stopTracing := func(context.Context) error { return nil }
+	if enableTracing {
+		var err error
+		if stopTracing, err = startTracing(); err != nil {
+			log.Fatalf("WARNING: could not export traces: %v", err)
+		}
+		handler = withTracing(handler)
+	}
+	if enableMetrics {
+		handler = withMetrics(handler)
+	}
+	if watchChanges {
+		if watchDelay <= 0 {
+			log.Fatalf("WARNING: --watch-delay must be positive")
+		}
+		go watchDirectory()
+	}
+	if os.Getenv(tenantEnv) != "" {
+		go watchMainProcess()
+	} else if hostMap != "" {
+		hosts, err := loadHostMap(hostMap)
+		if err != nil {
+			log.Fatalf("WARNING: invalid host map %q: %v", hostMap, err)
+		}
+		proxies, err := startHosts(hosts, *flagTrustedProxies)
+		if err != nil {
+			log.Fatalf("WARNING: could not start the wikis of the host map: %v", err)
+		}
+		handler = withHosts(proxies, handler)
+	}
+	handler = withRequestID(handler)
+	if token := os.Getenv(tenantEnv); token != "" {
+		handler = withTenant(token, handler)
+	}
+	server := &http.Server{
+		Addr:              address,
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+
+	// Listen until stopped, then commit any changes still pending
+	stopped := make(chan struct{})
+	go func() {
+		stopOnSignal(server)
+		close(stopped)
+	}()
+	var listener net.Listener
+	if os.Getenv(tenantEnv) != "" {
+		listener, err = tenantListener()
+	} else {
+		listener, err = net.Listen("tcp", address)
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+	log.Printf("Start listening on %s (timeouts: read header %v, read %v, write %v, idle %v)",
+		address, readHeaderTimeout, readTimeout, writeTimeout, idleTimeout)
+	if err := server.Serve(listener); err != http.ErrServerClosed {
+		log.Fatalln(err)
+	}
+	<-stopped
+	flushPending()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := stopTracing(ctx); err != nil {
+		log.Printf("Cant export the last traces, error: %v", err)
+	}
+}
 
-	// Listen
-	log.Printf("Start listening on %s", address)
-	log.Fatalln(http.ListenAndServe(address, nil))
+// readHTMLFile reads an optional operator provided HTML snippet.
+func readHTMLFile(file string) template.HTML {
+	if file == "" {
+		return ""
+	}
+	bytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Fatalf("WARNING: could not read HTML file %q: %v", file, err)
+	}
+	return template.HTML(bytes)
+}
+
+// iconHandler serves an icon file, which clients may cache for a week.
+func iconHandler(file string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=604800")
+		http.ServeFile(w, r, file)
+	}
 }
@@ -0,0 +1,148 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path"
+	"strings"
+	"time"
+)
+
+const frontMatterDelimiter = "---"
+
+// parseFrontMatter splits an optional front matter block of "key: value"
+// lines, delimited by "---" lines, from the start of a page. The remaining
+// content is returned as is, without a leading byte order mark.
+func parseFrontMatter(source []byte) (map[string]string, []byte) {
+	source = stripBOM(source)
+	meta := make(map[string]string)
+	rest := source
+	for first := true; len(rest) > 0; first = false {
+		line := rest
+		if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+			line, rest = rest[:i], rest[i+1:]
+		} else {
+			rest = nil
+		}
+		text := strings.TrimSpace(string(line))
+		if text == frontMatterDelimiter {
+			if first {
+				continue
+			}
+			return meta, rest
+		} else if first {
+			break
+		}
+		if i := strings.Index(text, ":"); i > 0 {
+			key := strings.TrimSpace(text[:i])
+			meta[key] = strings.Trim(strings.TrimSpace(text[i+1:]), `"'`)
+		}
+	}
+	// No front matter, or no closing delimiter
+	return make(map[string]string), source
+}
+
+// metaList parses a front matter list value such as "[a, b]".
+func metaList(value string) []string {
+	value = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(value), "["), "]")
+	var list []string
+	for _, entry := range parseList(value) {
+		list = append(list, strings.Trim(entry, `"'`))
+	}
+	return list
+}
+
+// sidecarSuffix replaces the extension of a page for its metadata file.
+const sidecarSuffix = ".meta.json"
+
+// sidecarFile returns the metadata file of a page file.
+func sidecarFile(file string) string {
+	return strings.TrimSuffix(file, path.Ext(file)) + sidecarSuffix
+}
+
+// readSidecar reads the metadata file of a page, flattening its values to
+// front matter strings, with lists written as "[a, b]". Returns nil when the
+// page has none.
+func readSidecar(file string) map[string]string {
+	values, ok := readSidecarValues(file)
+	if !ok {
+		return nil
+	}
+	meta := make(map[string]string)
+	for key, value := range values {
+		switch value := value.(type) {
+		case string:
+			meta[key] = value
+		case []interface{}:
+			var list []string
+			for _, entry := range value {
+				list = append(list, fmt.Sprint(entry))
+			}
+			meta[key] = "[" + strings.Join(list, ", ") + "]"
+		case map[string]interface{}, nil:
+			// Nested values have no front matter equivalent
+		default:
+			meta[key] = fmt.Sprint(value)
+		}
+	}
+	return meta
+}
+
+// readSidecarValues reads the metadata file of a page as JSON values, and
+// whether it has a valid one.
+func readSidecarValues(file string) (map[string]interface{}, bool) {
+	bytes, err := ioutil.ReadFile(path.Join(directory, sidecarFile(file)))
+	if err != nil {
+		return nil, false
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(bytes, &values); err != nil {
+		return nil, false
+	}
+	return values, true
+}
+
+// mergeSidecar adds the metadata file of a page to its front matter, the
+// metadata file taking precedence.
+func mergeSidecar(meta map[string]string, file string) map[string]string {
+	for key, value := range readSidecar(file) {
+		meta[key] = value
+	}
+	return meta
+}
+
+// publishLayouts are the accepted formats of the publish front matter, times
+// without a zone are in -timezone.
+var publishLayouts = []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"}
+
+// isUnpublished reports whether the publish date of a page file is still to
+// come. Pages with a malformed date stay unpublished until it is fixed.
+func isUnpublished(file string, source []byte) bool {
+	meta, _ := parseFrontMatter(source)
+	value := mergeSidecar(meta, file)["publish"]
+	if value == "" {
+		return false
+	}
+	for _, layout := range publishLayouts {
+		if date, err := time.ParseInLocation(layout, value, localZone()); err == nil {
+			return time.Now().Before(date)
+		}
+	}
+	log.Printf("Invalid publish date %q of %q, page not published", value, file)
+	return true
+}
+
+// localZone is -timezone, or the server's time zone.
+func localZone() *time.Location {
+	if timezone != nil {
+		return timezone
+	}
+	return time.Local
+}
@@ -0,0 +1,113 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metricBuckets are the upper bounds in seconds of the duration histograms.
+var metricBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// metrics are exposed at /metrics with -metrics.
+var metrics = struct {
+	registry  *prometheus.Registry
+	requests  *prometheus.CounterVec   // By status code
+	latency   *prometheus.HistogramVec // By method
+	git       *prometheus.HistogramVec // By git command
+	cacheHits *prometheus.CounterVec   // By cache and result
+}{
+	registry: prometheus.NewRegistry(),
+	requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gopages_http_requests_total",
+		Help: "Requests served by status code.",
+	}, []string{"code"}),
+	latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gopages_http_request_duration_seconds",
+		Help:    "Durations of the requests by method.",
+		Buckets: metricBuckets,
+	}, []string{"method"}),
+	git: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gopages_git_command_duration_seconds",
+		Help:    "Durations of the git commands by command.",
+		Buckets: metricBuckets,
+	}, []string{"command"}),
+	cacheHits: prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gopages_cache_lookups_total",
+		Help: "Lookups of the content caches by cache and result.",
+	}, []string{"cache", "result"}),
+}
+
+func init() {
+	// The host wikis of a host map each serve metrics of their own
+	var registerer prometheus.Registerer = metrics.registry
+	if host := os.Getenv(tenantHostEnv); host != "" {
+		registerer = prometheus.WrapRegistererWith(prometheus.Labels{"host": host}, registerer)
+	}
+	registerer.MustRegister(
+		metrics.requests,
+		metrics.latency,
+		metrics.git,
+		metrics.cacheHits,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "gopages_pages",
+			Help: "Pages of the wiki.",
+		}, func() float64 {
+			pages, _ := listPages("")
+			return float64(len(pages))
+		}),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// gitMetric records the duration of a git command, when metrics are on.
+func gitMetric(args []string, d time.Duration) {
+	if enableMetrics && len(args) > 1 {
+		metrics.git.WithLabelValues(args[1]).Observe(d.Seconds())
+	}
+}
+
+// cacheMetric records a cache lookup, when metrics are on.
+func cacheMetric(cache string, hit bool) {
+	if !enableMetrics {
+		return
+	}
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	metrics.cacheHits.WithLabelValues(cache, result).Inc()
+}
+
+// withMetrics counts the requests and their durations.
+func withMetrics(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		handler.ServeHTTP(sw, r)
+		metrics.requests.WithLabelValues(strconv.Itoa(sw.status)).Inc()
+		metrics.latency.WithLabelValues(r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+// metricsExporter writes the metrics in the Prometheus exposition formats.
+var metricsExporter = promhttp.HandlerFor(metrics.registry, promhttp.HandlerOpts{})
+
+// metricsHandler serves the metrics, only to administrators with
+// -metrics-auth.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if metricsAuth && !requireAdmin(w, r) {
+		return
+	}
+	metricsExporter.ServeHTTP(w, r)
+}
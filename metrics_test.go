@@ -0,0 +1,38 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	newTestWiki(t, map[string]string{"a.md": "a\n", "b.md": "b\n"})
+	defer func(old bool) { enableMetrics = old }(enableMetrics)
+	enableMetrics = true
+
+	handler := withMetrics(http.HandlerFunc(wikiHandler))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/a", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/a?revision=nope", nil))
+
+	w := httptest.NewRecorder()
+	metricsHandler(w, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{
+		`gopages_http_requests_total{code="200"}`,
+		`gopages_http_request_duration_seconds_bucket{method="GET",le="0.005"}`,
+		`gopages_http_request_duration_seconds_count{method="GET"}`,
+		`gopages_git_command_duration_seconds_count{command="`,
+		`gopages_cache_lookups_total{cache="`,
+		"gopages_pages 2",
+		"go_goroutines",
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("metrics without %s:\n%s", want, w.Body)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// parseProxies parses a comma separated list of CIDRs or single addresses.
+func parseProxies(value string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+	for _, entry := range parseList(value) {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, err
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+// isTrustedProxy reports whether an address belongs to a trusted proxy.
+func isTrustedProxy(addr string) bool {
+	ip := net.ParseIP(strings.TrimSpace(addr))
+	if ip == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the client, only trusting the forwarding
+// headers when the request comes from a trusted proxy.
+func clientIP(r *http.Request) string {
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peer = r.RemoteAddr
+	}
+	if !isTrustedProxy(peer) {
+		return peer
+	}
+
+	// The nearest address not added by one of our own proxies is the client
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				break
+			}
+			if !isTrustedProxy(hop) || i == 0 {
+				return hop
+			}
+		}
+	} else if real := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(real) != nil {
+		return real
+	}
+	return peer
+}
+
+// withRecovery turns a panicking request into an internal server error,
+// rather than dropping the connection.
+func withRecovery(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if err := recover(); err != nil {
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+				log.Printf("Panic serving %s %s [%s]: %v\n%s", r.Method, r.URL.RequestURI(), requestID(r), err, debug.Stack())
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+			}
+		}()
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// maintenanceRetryAfter is the Retry-After value in seconds during maintenance.
+const maintenanceRetryAfter = "300"
+
+// statusWriter remembers the status code of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// withAccessLog logs every request with the client address.
+func withAccessLog(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start, uri := time.Now(), r.URL.RequestURI()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		handler.ServeHTTP(sw, r)
+		log.Printf("%s %s %s %d %v [%s]", clientIP(r), r.Method, uri, sw.status, time.Since(start), requestID(r))
+	})
+}
+
+// withMaintenance shows the maintenance page to everyone but administrators
+// while maintenance mode is on.
+func withMaintenance(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := currentSettings()
+		// Administrators need the settings page to log in and switch it off
+		if !s.Maintenance || isAdmin(r) || r.URL.Path == "/_settings" || strings.HasPrefix(r.URL.Path, "/static/") {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		node := &Node{
+			Path:     r.URL.Path,
+			Title:    s.Title,
+			Basepath: strings.TrimSuffix(basepath, "/"),
+			Template: "maintenance.tpl",
+			System:   true,
+		}
+		w.Header().Set("Retry-After", maintenanceRetryAfter)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		renderTemplate(w, node)
+	})
+}
+
+// multipartMemory is how much of a multipart form is held in memory, the
+// rest of it goes to temporary files.
+const multipartMemory = 1 << 20
+
+// withBodyLimit limits request bodies to -max-body-bytes and parses forms up
+// front, so that oversized ones get a 413 rather than being cut off silently.
+func withBodyLimit(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if maxBodyBytes <= 0 || r.Body == nil {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+		var err error
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			err = r.ParseMultipartForm(multipartMemory)
+		} else {
+			err = r.ParseForm()
+		}
+		if err != nil && strings.Contains(err.Error(), "request body too large") {
+			http.Error(w, fmt.Sprintf("Requests are limited to %d bytes", maxBodyBytes), http.StatusRequestEntityTooLarge)
+			return
+		} else if err != nil {
+			http.Error(w, "Invalid form", http.StatusBadRequest)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
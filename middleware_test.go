@@ -0,0 +1,166 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// trusting trusts the proxies of a -trusted-proxies value until the end of
+// the test.
+func trusting(t *testing.T, proxies string) {
+	t.Helper()
+	networks, err := parseProxies(proxies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := trustedProxies
+	trustedProxies = networks
+	t.Cleanup(func() { trustedProxies = old })
+}
+
+func TestClientIP(t *testing.T) {
+	trusting(t, "10.0.0.0/8,192.168.1.1,::1")
+
+	tests := []struct {
+		name      string
+		peer      string
+		forwarded string
+		realIP    string
+		want      string
+	}{
+		{"no headers", "203.0.113.7:4000", "", "", "203.0.113.7"},
+		{"untrusted peer spoofing X-Forwarded-For", "203.0.113.7:4000", "198.51.100.1", "", "203.0.113.7"},
+		{"untrusted peer spoofing X-Real-IP", "203.0.113.7:4000", "", "198.51.100.1", "203.0.113.7"},
+		{"untrusted peer spoofing both", "203.0.113.7:4000", "10.0.0.1, 198.51.100.1", "198.51.100.2", "203.0.113.7"},
+		{"trusted proxy", "10.0.0.1:4000", "198.51.100.1", "", "198.51.100.1"},
+		{"trusted single address", "192.168.1.1:4000", "198.51.100.1", "", "198.51.100.1"},
+		{"trusted IPv6 proxy", "[::1]:4000", "2001:db8::1", "", "2001:db8::1"},
+		{"trusted X-Real-IP", "10.0.0.1:4000", "", "198.51.100.1", "198.51.100.1"},
+		{"trusted chain", "10.0.0.1:4000", "198.51.100.9, 198.51.100.1, 10.0.0.2", "", "198.51.100.1"},
+		{"client spoofing the start of the chain", "10.0.0.1:4000", "1.2.3.4, 198.51.100.1", "", "198.51.100.1"},
+		{"all trusted chain", "10.0.0.1:4000", "10.0.0.3, 10.0.0.2", "", "10.0.0.3"},
+		{"garbage hop", "10.0.0.1:4000", "198.51.100.1, garbage", "", "10.0.0.1"},
+		{"garbage before the client", "10.0.0.1:4000", "garbage, 198.51.100.1, 10.0.0.2", "", "198.51.100.1"},
+		{"garbage X-Real-IP", "10.0.0.1:4000", "", "not an address", "10.0.0.1"},
+		{"empty hops", "10.0.0.1:4000", " , ", "", "10.0.0.1"},
+		{"peer without a port", "203.0.113.7", "198.51.100.1", "", "203.0.113.7"},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = test.peer
+		if test.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", test.forwarded)
+		}
+		if test.realIP != "" {
+			r.Header.Set("X-Real-IP", test.realIP)
+		}
+		if got := clientIP(r); got != test.want {
+			t.Errorf("%s: clientIP = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestClientIPWithoutTrustedProxies(t *testing.T) {
+	trusting(t, "")
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "127.0.0.1:4000"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	r.Header.Set("X-Real-IP", "198.51.100.2")
+	if got := clientIP(r); got != "127.0.0.1" {
+		t.Errorf("clientIP = %q without trusted proxies, want the peer", got)
+	}
+}
+
+func TestParseProxies(t *testing.T) {
+	for _, value := range []string{"10.0.0.0/33", "not-an-address", "10.0.0.1/8/2"} {
+		if _, err := parseProxies(value); err == nil {
+			t.Errorf("parseProxies(%q) succeeded", value)
+		}
+	}
+}
+
+func TestRecoveryKeepsServing(t *testing.T) {
+	server := httptest.NewServer(withRecovery(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/panic" {
+			panic("broken page")
+		}
+		io.WriteString(w, "ok")
+	})))
+	defer server.Close()
+
+	for i := 0; i < 2; i++ {
+		resp, err := http.Get(server.URL + "/panic")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusInternalServerError {
+			t.Errorf("panicking handler answered %d, want 500", resp.StatusCode)
+		}
+
+		resp, err = http.Get(server.URL + "/")
+		if err != nil {
+			t.Fatalf("server stopped serving after a panic: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || string(body) != "ok" {
+			t.Errorf("request after a panic answered %d %q, want 200 \"ok\"", resp.StatusCode, body)
+		}
+	}
+}
+
+func TestRecoveryRepanicsAbort(t *testing.T) {
+	handler := withRecovery(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	w := httptest.NewRecorder()
+	defer func() {
+		if err := recover(); err != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler", err)
+		}
+		if w.Body.Len() > 0 {
+			t.Errorf("aborted request answered %q", w.Body)
+		}
+	}()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	t.Error("http.ErrAbortHandler was swallowed")
+}
+
+func TestBodyLimit(t *testing.T) {
+	defer func(old int64) { maxBodyBytes = old }(maxBodyBytes)
+	maxBodyBytes = 1024
+	served := false
+	handler := withBodyLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = true
+	}))
+
+	multipart := "--b\r\nContent-Disposition: form-data; name=\"content\"\r\n\r\n" + strings.Repeat("x", 2048) + "\r\n--b--\r\n"
+	tests := []struct {
+		contentType string
+		body        string
+		status      int
+	}{
+		{"application/x-www-form-urlencoded", "content=" + strings.Repeat("x", 100), http.StatusOK},
+		{"application/x-www-form-urlencoded", "content=" + strings.Repeat("x", 2048), http.StatusRequestEntityTooLarge},
+		{"multipart/form-data; boundary=b", multipart, http.StatusRequestEntityTooLarge},
+		{"application/x-www-form-urlencoded", "content=%zz", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		served = false
+		r := httptest.NewRequest("POST", "/page", strings.NewReader(test.body))
+		r.Header.Set("Content-Type", test.contentType)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != test.status || served != (test.status == http.StatusOK) {
+			t.Errorf("%s body of %d bytes answered %d, served %v, want %d", test.contentType, len(test.body), w.Code, served, test.status)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Representations a page can be served as.
+const (
+	formatHTML     = "html"
+	formatMarkdown = "markdown"
+	formatJSON     = "json"
+	formatPDF      = "pdf"
+)
+
+// formatTypes maps the media types of the Accept header to a representation.
+var formatTypes = map[string]string{
+	"text/html":             formatHTML,
+	"application/xhtml+xml": formatHTML,
+	"text/*":                formatHTML,
+	"*/*":                   formatHTML,
+	"text/markdown":         formatMarkdown,
+	"text/x-markdown":       formatMarkdown,
+	"application/json":      formatJSON,
+	"application/pdf":       formatPDF,
+}
+
+// negotiateFormat picks the representation of a page from the format
+// parameter, or else the Accept header, defaulting to HTML. Media types of
+// equal quality are preferred in the order listed.
+func negotiateFormat(r *http.Request) string {
+	switch r.FormValue("format") {
+	case "html":
+		return formatHTML
+	case "md", "markdown", "raw":
+		return formatMarkdown
+	case "json":
+		return formatJSON
+	case "pdf":
+		return formatPDF
+	}
+
+	format, best := formatHTML, 0.0
+	for _, entry := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(entry))
+		if err != nil {
+			continue
+		}
+		candidate, ok := formatTypes[mediaType]
+		if !ok {
+			continue
+		}
+		quality := 1.0
+		if value, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		if quality > best {
+			format, best = candidate, quality
+		}
+	}
+	return format
+}
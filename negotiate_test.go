@@ -0,0 +1,77 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		accept string
+		query  string
+		want   string
+	}{
+		{"", "", formatHTML},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "", formatHTML},
+		{"text/markdown", "", formatMarkdown},
+		{"text/x-markdown", "", formatMarkdown},
+		{"application/json", "", formatJSON},
+		{"text/html;q=0.5, application/json", "", formatJSON},
+		{"text/html, application/json;q=0.9", "", formatHTML},
+		{"application/json;q=0.4, text/markdown;q=0.8, text/html;q=0.6", "", formatMarkdown},
+		{"*/*;q=0.1, text/markdown;q=0.2", "", formatMarkdown},
+		{"text/markdown, application/json", "", formatMarkdown},
+		{"application/json, text/markdown", "", formatJSON},
+		{"text/markdown;q=0", "", formatHTML},
+		{"text/markdown;q=abc", "", formatHTML},
+		{"image/png", "", formatHTML},
+		{"application/x-unknown, image/*;q=0.9", "", formatHTML},
+		{"this is not a media type", "", formatHTML},
+		{"image/png, application/json;q=0.1", "", formatJSON},
+		{"application/json", "format=html", formatHTML},
+		{"text/html", "format=md", formatMarkdown},
+		{"text/html", "format=raw", formatMarkdown},
+		{"", "format=json", formatJSON},
+		{"text/markdown", "format=unknown", formatMarkdown},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/page?"+test.query, nil)
+		if test.accept != "" {
+			r.Header.Set("Accept", test.accept)
+		}
+		if got := negotiateFormat(r); got != test.want {
+			t.Errorf("negotiateFormat(Accept %q, ?%s) = %q, want %q", test.accept, test.query, got, test.want)
+		}
+	}
+}
+
+func TestNegotiatedPage(t *testing.T) {
+	newTestWiki(t, map[string]string{"a.md": "# Title\n"})
+	tests := []struct {
+		accept      string
+		contentType string
+	}{
+		{"text/markdown", "text/markdown"},
+		{"application/json", "application/json"},
+		{"image/webp", "text/html"},
+		{"", "text/html"},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/a", nil)
+		r.Header.Set("Accept", test.accept)
+		w := httptest.NewRecorder()
+		wikiHandler(w, r)
+		if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), test.contentType) {
+			t.Errorf("Accept %q answered %d %s, want %s", test.accept, w.Code, w.Header().Get("Content-Type"), test.contentType)
+		}
+		if vary := w.Header().Values("Vary"); !containsString(vary, "Accept") {
+			t.Errorf("Accept %q answered Vary %v, want Accept", test.accept, vary)
+		}
+	}
+}
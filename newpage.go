@@ -0,0 +1,43 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+)
+
+// newPageTemplateName is the file name of the new page template of a directory.
+const newPageTemplateName = "_template"
+
+// newPageContent returns the initial editor content for a new page, from the
+// template of the nearest directory with one, or -new-page-template. The
+// placeholders {{title}} and {{date}} are filled in.
+func newPageContent(page string) string {
+	var template []byte
+	for dir := path.Dir(page); template == nil; dir = path.Dir(dir) {
+		for _, ext := range extensions {
+			if bytes, err := ioutil.ReadFile(path.Join(directory, dir, newPageTemplateName+ext)); err == nil {
+				template = bytes
+				break
+			}
+		}
+		if dir == "." || dir == "/" {
+			break
+		}
+	}
+	if template == nil && newPageTemplate != "" {
+		template, _ = ioutil.ReadFile(newPageTemplate)
+	}
+	if template == nil {
+		return ""
+	}
+	return strings.NewReplacer(
+		"{{title}}", path.Base(page),
+		"{{date}}", time.Now().In(localZone()).Format("2006-01-02"),
+	).Replace(string(template))
+}
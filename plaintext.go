@@ -0,0 +1,142 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"html"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	emojiast "github.com/yuin/goldmark-emoji/ast"
+	"github.com/yuin/goldmark/ast"
+	east "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+var (
+	htmlHidden   = regexp.MustCompile(`(?is)<script\b.*?</script>|<style\b.*?</style>`)
+	htmlAnyTag   = regexp.MustCompile(`(?s)<!--.*?-->|<[^>]*>`)
+	blankLines   = regexp.MustCompile(`\n{3,}`)
+	lineSpaces   = regexp.MustCompile(`[ \t]+`)
+	spaceNewline = regexp.MustCompile(` *\n *`)
+)
+
+// PlainText returns the readable text of the node contents, without any
+// markup. Links and images keep their text, code keeps its lines and
+// paragraphs are separated by blank lines.
+func (node *Node) PlainText() string {
+	_, source := parseFrontMatter(node.Bytes)
+	switch path.Ext(node.File) {
+	case ".txt":
+		return strings.TrimSpace(string(source))
+	case ".html":
+		return cleanText(stripHTML(string(source)))
+	}
+
+	var buf strings.Builder
+	doc := md.Parser().Parse(text.NewReader(source), parser.WithContext(newParserContext(0)))
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		switch n := n.(type) {
+		case *ast.Text:
+			if entering {
+				buf.Write(n.Segment.Value(source))
+				if n.HardLineBreak() {
+					buf.WriteByte('\n')
+				} else if n.SoftLineBreak() {
+					buf.WriteByte(' ')
+				}
+			}
+		case *ast.String:
+			if entering {
+				buf.Write(n.Value)
+			}
+		case *ast.AutoLink:
+			if entering {
+				buf.Write(n.Label(source))
+			}
+			return ast.WalkSkipChildren, nil
+		case *ast.RawHTML:
+			return ast.WalkSkipChildren, nil
+		case *emojiast.Emoji:
+			if entering && n.Value.IsUnicode() {
+				buf.WriteString(string(n.Value.Unicode))
+			}
+		case *ast.CodeBlock, *ast.FencedCodeBlock, *ast.HTMLBlock:
+			if entering {
+				var lines strings.Builder
+				for i := 0; i < n.Lines().Len(); i++ {
+					line := n.Lines().At(i)
+					lines.Write(line.Value(source))
+				}
+				if _, ok := n.(*ast.HTMLBlock); ok {
+					buf.WriteString(stripHTML(lines.String()))
+				} else {
+					buf.WriteString(lines.String())
+				}
+			}
+		case *east.TableCell:
+			if !entering {
+				buf.WriteByte('\t')
+			}
+			return ast.WalkContinue, nil
+		case *east.TableRow, *east.TableHeader:
+			if !entering {
+				buf.WriteByte('\n')
+			}
+			return ast.WalkContinue, nil
+		}
+		if !entering && n.Type() == ast.TypeBlock {
+			// Blank lines between top-level blocks, single ones within
+			if last := n.LastChild(); last == nil || last.Type() != ast.TypeBlock {
+				buf.WriteByte('\n')
+			}
+			if n.Parent() != nil && n.Parent().Kind() == ast.KindDocument {
+				buf.WriteByte('\n')
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	return cleanText(buf.String())
+}
+
+// stripHTML drops the tags, scripts and styles of HTML, keeping its text.
+func stripHTML(source string) string {
+	source = htmlHidden.ReplaceAllString(source, "")
+	return html.UnescapeString(htmlAnyTag.ReplaceAllString(source, " "))
+}
+
+// cleanText collapses the spaces and blank lines of extracted text.
+func cleanText(s string) string {
+	s = lineSpaces.ReplaceAllString(s, " ")
+	s = spaceNewline.ReplaceAllString(s, "\n")
+	return strings.TrimSpace(blankLines.ReplaceAllString(s, "\n\n"))
+}
+
+// snippet shortens text to at most max characters on a single line, cutting
+// at a word boundary.
+func snippet(s string, max int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	runes := []rune(s)[:max]
+	cut := string(runes)
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, ".,;:") + "…"
+}
+
+// description returns the description of the node front matter, or the
+// beginning of its text.
+func (node *Node) description() string {
+	if value := node.Meta["description"]; value != "" {
+		return value
+	}
+	return snippet(node.PlainText(), 160)
+}
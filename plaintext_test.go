@@ -0,0 +1,60 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import "testing"
+
+func TestPlainText(t *testing.T) {
+	tests := []struct {
+		file   string
+		source string
+		want   string
+	}{
+		{"a.md", "# Title\n\nSome **bold _and italic_ text** with `code`.\n", "Title\n\nSome bold and italic text with code."},
+		{"a.md", "A [link with **bold**](https://example.com) and ![an image](cat.png).\n", "A link with bold and an image."},
+		{"a.md", "See <https://example.com> and <b>inline</b> HTML.\n", "See https://example.com and inline HTML."},
+		{"a.md", "```go\nfunc main() {\n**not bold**\n}\n```\n\nAfter.\n", "func main() {\n**not bold**\n}\n\nAfter."},
+		{"a.md", "    indented *code*\n", "indented *code*"},
+		{"a.md", "- one\n- two with *emphasis*\n  - nested [link](x)\n\n> quoted **text**\n", "one\ntwo with emphasis\nnested link\n\nquoted text"},
+		{"a.md", "| a | b |\n|---|---|\n| *c* | `d` |\n", "a b\nc d"},
+		{"a.md", "<div>\n<script>alert(1)</script>\n<p>Block &amp; text</p>\n</div>\n", "Block & text"},
+		{"a.md", "---\ntitle: Meta\n---\nBody :smile:\n", "Body :smile:"},
+		{"a.md", "line one  \nline two\nsoft\n", "line one\nline two soft"},
+		{"a.html", "<style>p{}</style><p>Hand &lt;written&gt;</p>", "Hand <written>"},
+		{"a.txt", "  *plain* text  \n", "*plain* text"},
+	}
+	for _, test := range tests {
+		node := &Node{File: test.file, Bytes: []byte(test.source)}
+		if got := node.PlainText(); got != test.want {
+			t.Errorf("PlainText(%q) = %q, want %q", test.source, got, test.want)
+		}
+	}
+}
+
+func TestPlainTextEmoji(t *testing.T) {
+	withMarkdown(t, &useEmoji, true)
+	node := &Node{File: "a.md", Bytes: []byte("Ship it :rocket: **now**\n")}
+	if got := node.PlainText(); got != "Ship it 🚀 now" {
+		t.Errorf("PlainText with -emoji = %q", got)
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	tests := []struct {
+		text string
+		max  int
+		want string
+	}{
+		{"short text", 20, "short text"},
+		{"split  across\nlines", 20, "split across lines"},
+		{"cut at a word boundary, please", 16, "cut at a word…"},
+		{"Überlänge Größenangaben", 12, "Überlänge…"},
+	}
+	for _, test := range tests {
+		if got := snippet(test.text, test.max); got != test.want {
+			t.Errorf("snippet(%q, %d) = %q, want %q", test.text, test.max, got, test.want)
+		}
+	}
+}
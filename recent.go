@@ -0,0 +1,54 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// recentCookie lists the pages a reader viewed last, most recent first.
+const recentCookie = "recent"
+
+// readRecent returns the recently viewed pages from the reader's cookie.
+func readRecent(r *http.Request) []string {
+	cookie, err := r.Cookie(recentCookie)
+	if err != nil {
+		return nil
+	}
+	value, err := url.QueryUnescape(cookie.Value)
+	if err != nil || value == "" {
+		return nil
+	}
+	return strings.Split(value, "|")
+}
+
+// trackRecent shows the pages viewed before on the node, and moves the node
+// to the front of the reader's recently viewed pages, keeping at most
+// -recent-pages of them. Nothing is tracked with -no-tracking.
+func trackRecent(w http.ResponseWriter, r *http.Request, node *Node) {
+	if noTracking || recentPages <= 0 {
+		return
+	}
+	pages := []string{node.Path}
+	for _, page := range readRecent(r) {
+		if page == node.Path || !strings.HasPrefix(page, "/") || strings.Contains(page, "|") {
+			continue
+		}
+		node.Recent = append(node.Recent, &Directory{Path: page, Name: strings.TrimPrefix(page, "/")})
+		if pages = append(pages, page); len(pages) == recentPages {
+			break
+		}
+	}
+	// One list for the whole wiki rather than one per directory
+	http.SetCookie(w, &http.Cookie{
+		Name:    recentCookie,
+		Value:   url.QueryEscape(strings.Join(pages, "|")),
+		Path:    "/",
+		Expires: time.Now().AddDate(1, 0, 0),
+	})
+}
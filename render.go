@@ -0,0 +1,568 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	east "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// headingAnchors gives every heading an id, unique within the page, and a
+// link to it.
+type headingAnchors struct{}
+
+// Extend adds the heading ids and anchor rendering to a markdown renderer.
+func (headingAnchors) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithAutoHeadingID(),
+		parser.WithASTTransformers(util.Prioritized(headingOffsetTransformer{}, 100)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(headingRenderer{}, 100)))
+}
+
+// headingRenderer renders headings like the default renderer, followed by an
+// anchor link to the heading id.
+type headingRenderer struct{}
+
+// RegisterFuncs registers the heading renderer.
+func (r headingRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindHeading, r.renderHeading)
+}
+
+func (r headingRenderer) renderHeading(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	n := node.(*ast.Heading)
+	if entering {
+		_, _ = w.WriteString("<h")
+		_ = w.WriteByte("0123456"[n.Level])
+		if n.Attributes() != nil {
+			html.RenderAttributes(w, node, html.HeadingAttributeFilter)
+		}
+		_ = w.WriteByte('>')
+		return ast.WalkContinue, nil
+	}
+
+	if id, ok := n.AttributeString("id"); ok {
+		if id, ok := id.([]byte); ok {
+			_, _ = w.WriteString(` <a class="anchor" href="#`)
+			_, _ = w.Write(util.EscapeHTML(id))
+			_, _ = w.WriteString(`" title="`)
+			_, _ = w.Write(util.EscapeHTML([]byte(T("anchor.title"))))
+			_, _ = w.WriteString(`">#</a>`)
+		}
+	}
+	_, _ = w.WriteString("</h")
+	_ = w.WriteByte("0123456"[n.Level])
+	_, _ = w.WriteString(">\n")
+	return ast.WalkContinue, nil
+}
+
+// headingIDs generates heading ids from their text, keeping letters of any
+// script, and numbers repeated ids.
+type headingIDs struct {
+	used map[string]bool
+}
+
+// headingOffsetKey holds the number of levels to shift the headings of a page.
+var headingOffsetKey = parser.NewContextKey()
+
+// newParserContext returns the context for parsing a single page.
+func newParserContext(offset int) parser.Context {
+	pc := parser.NewContext(parser.WithIDs(&headingIDs{used: make(map[string]bool)}))
+	pc.Set(headingOffsetKey, offset)
+	return pc
+}
+
+// headingOffsetTransformer shifts all headings down by the heading offset of
+// the page, no further than h6.
+type headingOffsetTransformer struct{}
+
+// Transform shifts the headings of a page.
+func (headingOffsetTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	offset, _ := pc.Get(headingOffsetKey).(int)
+	if offset <= 0 {
+		return
+	}
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if heading, ok := node.(*ast.Heading); ok && entering {
+			heading.Level += offset
+			if heading.Level > 6 {
+				heading.Level = 6
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+// Generate returns a unique id for a heading text.
+func (s *headingIDs) Generate(value []byte, kind ast.NodeKind) []byte {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(string(value)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			dash = false
+			b.WriteRune(r)
+		case unicode.IsSpace(r) || r == '-' || r == '_':
+			dash = true
+		}
+	}
+	id := b.String()
+	if id == "" {
+		id = "heading"
+	}
+	unique := id
+	for i := 1; s.used[unique]; i++ {
+		unique = fmt.Sprintf("%s-%d", id, i)
+	}
+	s.used[unique] = true
+	return []byte(unique)
+}
+
+// Put reserves an id.
+func (s *headingIDs) Put(value []byte) {
+	s.used[string(value)] = true
+}
+
+// scrollingTables wraps tables in a container scrolling them horizontally,
+// so wide tables do not break the layout.
+type scrollingTables struct{}
+
+// Extend adds the table rendering to a markdown renderer.
+func (scrollingTables) Extend(m goldmark.Markdown) {
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(tableRenderer{}, 100)))
+}
+
+// tableRenderer renders the table element like the table extension, inside
+// the scrolling container. Rows and cells, including their alignment, are
+// left to the table extension.
+type tableRenderer struct{}
+
+// RegisterFuncs registers the table renderer.
+func (r tableRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(east.KindTable, r.renderTable)
+}
+
+func (r tableRenderer) renderTable(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		_, _ = w.WriteString(`<div class="table-container">` + "\n<table")
+		if node.Attributes() != nil {
+			html.RenderAttributes(w, node, extension.TableAttributeFilter)
+		}
+		_, _ = w.WriteString(">\n")
+	} else {
+		_, _ = w.WriteString("</table>\n</div>\n")
+	}
+	return ast.WalkContinue, nil
+}
+
+// codeCopy wraps code blocks with a button copying their content.
+type codeCopy struct{}
+
+// Extend adds the code block rendering to a markdown renderer.
+func (codeCopy) Extend(m goldmark.Markdown) {
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(codeCopyRenderer{}, 100)))
+}
+
+// codeCopyRenderer renders code blocks like the default renderer, inside a
+// container holding the raw code for the copy button.
+type codeCopyRenderer struct{}
+
+// RegisterFuncs registers the code block renderers.
+func (r codeCopyRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindCodeBlock, r.renderCodeBlock)
+	reg.Register(ast.KindFencedCodeBlock, r.renderCodeBlock)
+}
+
+func (r codeCopyRenderer) renderCodeBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		_, _ = w.WriteString("</code></pre></div>\n")
+		return ast.WalkContinue, nil
+	}
+
+	var code bytes.Buffer
+	lines := node.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		code.Write(line.Value(source))
+	}
+	_, _ = w.WriteString(`<div class="code-block" data-code="`)
+	_, _ = w.Write(util.EscapeHTML(code.Bytes()))
+	_, _ = w.WriteString(`"><button type="button" class="btn btn-default btn-xs code-copy">`)
+	_, _ = w.Write(util.EscapeHTML([]byte(T("code.copy"))))
+	_, _ = w.WriteString(`</button><pre><code`)
+	if n, ok := node.(*ast.FencedCodeBlock); ok {
+		if language := n.Language(source); language != nil {
+			_, _ = w.WriteString(` class="language-`)
+			html.DefaultWriter.Write(w, language)
+			_ = w.WriteByte('"')
+		}
+	}
+	_ = w.WriteByte('>')
+	html.DefaultWriter.RawWrite(w, code.Bytes())
+	return ast.WalkSkipChildren, nil
+}
+
+// autolinkRule turns the matches of a pattern into links, expanding the
+// submatches like $1 in the URL template.
+type autolinkRule struct {
+	pattern *regexp.Regexp
+	url     string
+}
+
+// parseAutolinkRule parses a rule in the format "pattern->url".
+func parseAutolinkRule(value string) (autolinkRule, error) {
+	i := strings.LastIndex(value, "->")
+	if i < 0 {
+		return autolinkRule{}, fmt.Errorf("missing -> in %q", value)
+	}
+	pattern, err := regexp.Compile(strings.TrimSpace(value[:i]))
+	if err != nil {
+		return autolinkRule{}, err
+	}
+	return autolinkRule{pattern: pattern, url: strings.TrimSpace(value[i+2:])}, nil
+}
+
+// autolinks links the matches of the autolink rules in the page text, leaving
+// code and existing links alone.
+type autolinks struct {
+	rules []autolinkRule
+}
+
+// Extend adds the autolinks to a markdown renderer.
+func (a autolinks) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(a, 200)))
+}
+
+// Transform links the matches in all text nodes.
+func (a autolinks) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var texts []*ast.Text
+	inAnchor := false
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := node.(type) {
+		case *ast.Link, *ast.AutoLink, *ast.Image, *ast.CodeSpan:
+			return ast.WalkSkipChildren, nil
+		case *ast.RawHTML:
+			// Inline HTML links are made of separate opening and closing tags
+			var raw bytes.Buffer
+			for i := 0; i < n.Segments.Len(); i++ {
+				segment := n.Segments.At(i)
+				raw.Write(segment.Value(source))
+			}
+			tag := strings.ToLower(raw.String())
+			if strings.HasPrefix(tag, "<a ") || strings.HasPrefix(tag, "<a>") {
+				inAnchor = true
+			} else if strings.HasPrefix(tag, "</a") {
+				inAnchor = false
+			}
+		case *ast.Text:
+			if !inAnchor {
+				texts = append(texts, n)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	for _, node := range texts {
+		a.link(node, source)
+	}
+}
+
+// link splits a text node around the earliest match of any rule, and goes on
+// with the remaining text.
+func (a autolinks) link(node *ast.Text, source []byte) {
+	for node != nil {
+		segment := node.Segment
+		value := segment.Value(source)
+		var match []int
+		var rule autolinkRule
+		for _, r := range a.rules {
+			if m := r.pattern.FindSubmatchIndex(value); m != nil && m[1] > m[0] && (match == nil || m[0] < match[0]) {
+				match, rule = m, r
+			}
+		}
+		if match == nil {
+			return
+		}
+
+		link := ast.NewLink()
+		link.Destination = rule.pattern.Expand(nil, []byte(rule.url), value, match)
+		link.AppendChild(link, ast.NewTextSegment(text.NewSegment(segment.Start+match[0], segment.Start+match[1])))
+		rest := ast.NewTextSegment(text.NewSegment(segment.Start+match[1], segment.Stop))
+		rest.SetSoftLineBreak(node.SoftLineBreak())
+		rest.SetHardLineBreak(node.HardLineBreak())
+
+		node.Segment = text.NewSegment(segment.Start, segment.Start+match[0])
+		node.SetSoftLineBreak(false)
+		node.SetHardLineBreak(false)
+		parent := node.Parent()
+		parent.InsertAfter(parent, node, link)
+		parent.InsertAfter(parent, link, rest)
+		node = rest
+	}
+}
+
+// imageAttributes sizes images with an attribute block following them, as in
+// ![alt](src){width=300 height=200 .class}, or a title ending in =WxH, as in
+// ![alt](src "title =300x200"). Invalid attribute blocks are left as text.
+type imageAttributes struct{}
+
+// Extend adds the image attributes to a markdown renderer.
+func (imageAttributes) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(imageAttributes{}, 100)))
+}
+
+var (
+	imageSizeTitle = regexp.MustCompile(`^(.*?)\s*=(\d*)x(\d*)$`)
+	imageSize      = regexp.MustCompile(`^\d+(px|%)?$`)
+	imageClass     = regexp.MustCompile(`^\.[A-Za-z][\w-]*$`)
+)
+
+// Transform sets the attributes of all images.
+func (imageAttributes) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var images []*ast.Image
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if image, ok := node.(*ast.Image); ok && entering {
+			images = append(images, image)
+		}
+		return ast.WalkContinue, nil
+	})
+	for _, image := range images {
+		if m := imageSizeTitle.FindSubmatch(image.Title); m != nil && len(m[2])+len(m[3]) > 0 {
+			image.Title = m[1]
+			if len(m[2]) > 0 {
+				image.SetAttributeString("width", m[2])
+			}
+			if len(m[3]) > 0 {
+				image.SetAttributeString("height", m[3])
+			}
+			if len(image.Title) == 0 {
+				image.Title = nil
+			}
+		}
+
+		// The block may be split over several adjacent text nodes
+		first, ok := image.NextSibling().(*ast.Text)
+		if !ok || len(first.Segment.Value(source)) == 0 || source[first.Segment.Start] != '{' {
+			continue
+		}
+		end := -1
+		var texts []*ast.Text
+		for node, stop := ast.Node(first), first.Segment.Start; end < 0; node = node.NextSibling() {
+			next, ok := node.(*ast.Text)
+			if !ok || next.Segment.Start != stop {
+				break
+			}
+			texts = append(texts, next)
+			if i := bytes.IndexByte(next.Segment.Value(source), '}'); i >= 0 {
+				end = next.Segment.Start + i
+			}
+			stop = next.Segment.Stop
+		}
+		if end < 0 {
+			continue
+		}
+		attributes, ok := parseImageAttributes(string(source[first.Segment.Start+1 : end]))
+		if !ok {
+			continue
+		}
+		for _, attribute := range attributes {
+			image.SetAttributeString(attribute[0], []byte(attribute[1]))
+		}
+		last := texts[len(texts)-1]
+		for _, node := range texts[:len(texts)-1] {
+			node.Parent().RemoveChild(node.Parent(), node)
+		}
+		last.Segment = last.Segment.WithStart(end + 1)
+		if last.Segment.IsEmpty() && !last.SoftLineBreak() && !last.HardLineBreak() {
+			last.Parent().RemoveChild(last.Parent(), last)
+		}
+	}
+}
+
+// parseImageAttributes parses the width, height, loading and class entries
+// of an image attribute block, failing on anything else.
+func parseImageAttributes(block string) ([][2]string, bool) {
+	var attributes [][2]string
+	var classes []string
+	for _, entry := range strings.Fields(block) {
+		if imageClass.MatchString(entry) {
+			classes = append(classes, entry[1:])
+			continue
+		}
+		i := strings.Index(entry, "=")
+		if i < 0 {
+			return nil, false
+		}
+		key, value := entry[:i], strings.Trim(entry[i+1:], `"'`)
+		switch {
+		case (key == "width" || key == "height") && imageSize.MatchString(value):
+		case key == "loading" && (value == "lazy" || value == "eager"):
+		default:
+			return nil, false
+		}
+		attributes = append(attributes, [2]string{key, value})
+	}
+	if len(classes) > 0 {
+		attributes = append(attributes, [2]string{"class", strings.Join(classes, " ")})
+	}
+	return attributes, len(attributes) > 0
+}
+
+// admonitionMarker matches the first line of a GitHub style alert, such as
+// "> [!NOTE]".
+var admonitionMarker = regexp.MustCompile(`^\[!([A-Za-z]+)\]$`)
+
+// admonitionIcons are the glyphicons of the alert types, other types are
+// left as blockquotes.
+var admonitionIcons = map[string]string{
+	"note":      "info-sign",
+	"tip":       "ok-sign",
+	"important": "exclamation-sign",
+	"warning":   "warning-sign",
+	"caution":   "fire",
+}
+
+// kindAdmonition is the node kind of alerts.
+var kindAdmonition = ast.NewNodeKind("Admonition")
+
+// admonitionNode is a blockquote turned into an alert of a type.
+type admonitionNode struct {
+	ast.BaseBlock
+	kind string
+}
+
+// Kind returns the node kind of alerts.
+func (n *admonitionNode) Kind() ast.NodeKind {
+	return kindAdmonition
+}
+
+// Dump dumps the alert for debugging.
+func (n *admonitionNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Type": n.kind}, nil)
+}
+
+// admonitions renders blockquotes starting with an alert marker as styled
+// alerts with an icon and a class per type.
+type admonitions struct{}
+
+// Extend adds the alerts to a markdown renderer.
+func (a admonitions) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(a, 100)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(a, 100)))
+}
+
+// Transform replaces the blockquotes of known alert types, dropping their
+// marker line.
+func (a admonitions) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var quotes []*ast.Blockquote
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if quote, ok := node.(*ast.Blockquote); ok && entering {
+			quotes = append(quotes, quote)
+		}
+		return ast.WalkContinue, nil
+	})
+	for _, quote := range quotes {
+		paragraph, ok := quote.FirstChild().(*ast.Paragraph)
+		if !ok || paragraph.Lines().Len() == 0 {
+			continue
+		}
+		line := paragraph.Lines().At(0)
+		m := admonitionMarker.FindSubmatch(bytes.TrimSpace(line.Value(source)))
+		if m == nil || admonitionIcons[strings.ToLower(string(m[1]))] == "" {
+			continue
+		}
+		for child := paragraph.FirstChild(); child != nil; {
+			next := child.NextSibling()
+			if text, ok := child.(*ast.Text); !ok || text.Segment.Start >= line.Stop {
+				break
+			}
+			paragraph.RemoveChild(paragraph, child)
+			child = next
+		}
+		if paragraph.FirstChild() == nil {
+			quote.RemoveChild(quote, paragraph)
+		}
+		alert := &admonitionNode{kind: strings.ToLower(string(m[1]))}
+		for child := quote.FirstChild(); child != nil; {
+			next := child.NextSibling()
+			alert.AppendChild(alert, child)
+			child = next
+		}
+		quote.Parent().ReplaceChild(quote.Parent(), quote, alert)
+	}
+}
+
+// RegisterFuncs registers the alert renderer.
+func (a admonitions) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindAdmonition, a.renderAdmonition)
+}
+
+func (a admonitions) renderAdmonition(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	n := node.(*admonitionNode)
+	if entering {
+		fmt.Fprintf(w, "<div class=\"admonition admonition-%s\">\n", n.kind)
+		fmt.Fprintf(w, "<p class=\"admonition-title\"><span class=\"glyphicon glyphicon-%s\"></span> %s</p>\n",
+			admonitionIcons[n.kind], util.EscapeHTML([]byte(T("admonition."+n.kind))))
+	} else {
+		_, _ = w.WriteString("</div>\n")
+	}
+	return ast.WalkContinue, nil
+}
+
+// htmlComments drops the HTML comments of pages from the rendering, leaving
+// them in the source only. Comments in code are text and stay.
+type htmlComments struct{}
+
+// Extend adds the comment stripping to a markdown renderer.
+func (c htmlComments) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(c, 100)))
+}
+
+// Transform removes the HTML blocks and inline HTML that are comments.
+func (c htmlComments) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var comments []ast.Node
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := node.(type) {
+		case *ast.HTMLBlock:
+			if n.HTMLBlockType == ast.HTMLBlockType2 {
+				comments = append(comments, n)
+			}
+		case *ast.RawHTML:
+			if n.Segments.Len() == 0 {
+				break
+			}
+			if first := n.Segments.At(0); bytes.HasPrefix(first.Value(source), []byte("<!--")) {
+				comments = append(comments, n)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	for _, comment := range comments {
+		comment.Parent().RemoveChild(comment.Parent(), comment)
+	}
+}
@@ -0,0 +1,147 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+)
+
+// render converts markdown the way page views do, with a heading offset.
+func render(t *testing.T, source string, offset int) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := md.Convert([]byte(source), &buf, parser.WithContext(newParserContext(offset))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// withMarkdown renders pages with a markdown option set until the end of the
+// test.
+func withMarkdown(t *testing.T, option *bool, value bool) {
+	t.Helper()
+	old := *option
+	*option = value
+	md = newMarkdown()
+	t.Cleanup(func() {
+		*option = old
+		md = newMarkdown()
+	})
+}
+
+func TestHeadingIDs(t *testing.T) {
+	tests := []struct {
+		headings []string
+		ids      []string
+	}{
+		{[]string{"Hello World", "Hello, World!", "hello world"}, []string{"hello-world", "hello-world-1", "hello-world-2"}},
+		{[]string{"Intro", "Intro 1", "Intro"}, []string{"intro", "intro-1", "intro-2"}},
+		{[]string{"C++ & Go: a_b--c"}, []string{"c-go-a-b-c"}},
+		{[]string{"Über Straße", "Привет мир", "日本語の見出し", "مرحبا"}, []string{"über-straße", "привет-мир", "日本語の見出し", "مرحبا"}},
+		{[]string{"!!!", "???"}, []string{"heading", "heading-1"}},
+		{[]string{"2021 Report"}, []string{"2021-report"}},
+	}
+	for _, test := range tests {
+		ids := &headingIDs{used: make(map[string]bool)}
+		for i, heading := range test.headings {
+			if got := string(ids.Generate([]byte(heading), ast.KindHeading)); got != test.ids[i] {
+				t.Errorf("Generate(%q) = %q after %q, want %q", heading, got, test.headings[:i], test.ids[i])
+			}
+		}
+	}
+}
+
+func TestHeadingIDsUnique(t *testing.T) {
+	ids := &headingIDs{used: make(map[string]bool)}
+	ids.Put([]byte("taken"))
+	seen := map[string]bool{"taken": true}
+	for _, heading := range []string{"Taken", "a", "a", "A 1", "a-1", "a 1", "a-2", "A", "taken"} {
+		id := string(ids.Generate([]byte(heading), ast.KindHeading))
+		if seen[id] {
+			t.Errorf("Generate(%q) = %q, which is already used", heading, id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestHeadingAnchors(t *testing.T) {
+	html := render(t, "# Über uns\n\n## Über uns\n\n### Привет, мир!\n", 0)
+	for _, id := range []string{"über-uns", "über-uns-1", "привет-мир"} {
+		anchor := regexp.MustCompile(`<h\d id="` + id + `">.*<a class="anchor" href="#` + id + `"`)
+		if !anchor.MatchString(html) {
+			t.Errorf("no heading %q with an anchor link in:\n%s", id, html)
+		}
+	}
+}
+
+func TestHeadingOffset(t *testing.T) {
+	source := "# One\n\n## Two\n\n### Three\n\n#### Four\n\n##### Five\n\n###### Six\n"
+	tests := []struct {
+		offset int
+		levels []int
+	}{
+		{0, []int{1, 2, 3, 4, 5, 6}},
+		{-2, []int{1, 2, 3, 4, 5, 6}},
+		{1, []int{2, 3, 4, 5, 6, 6}},
+		{3, []int{4, 5, 6, 6, 6, 6}},
+		{5, []int{6, 6, 6, 6, 6, 6}},
+		{100, []int{6, 6, 6, 6, 6, 6}},
+	}
+	heading := regexp.MustCompile(`<h(\d) `)
+	for _, test := range tests {
+		var levels []int
+		for _, m := range heading.FindAllStringSubmatch(render(t, source, test.offset), -1) {
+			levels = append(levels, int(m[1][0]-'0'))
+		}
+		if fmt.Sprint(levels) != fmt.Sprint(test.levels) {
+			t.Errorf("heading levels with offset %d = %v, want %v", test.offset, levels, test.levels)
+		}
+	}
+}
+
+func TestHeadingOffsetFrontMatter(t *testing.T) {
+	newTestWiki(t, map[string]string{"a.md": "---\nheading-offset: 2\n---\n# Title\n\n##### Deep\n"})
+	w := httptest.NewRecorder()
+	wikiHandler(w, httptest.NewRequest("GET", "/a", nil))
+	for _, want := range []string{`<h3 id="title">`, `<h6 id="deep">`} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("page with heading-offset 2 does not contain %s", want)
+		}
+	}
+}
+
+func TestSmartypants(t *testing.T) {
+	source := "He said \"hello\" -- and 'bye'... --- end\n"
+
+	withMarkdown(t, &smartypants, false)
+	html := render(t, source, 0)
+	if !strings.Contains(html, "He said &quot;hello&quot; -- and 'bye'... --- end") {
+		t.Errorf("straight quotes and dashes changed without -smartypants:\n%s", html)
+	}
+	code := render(t, "`say \"hi\" -- now`\n", 0)
+	if !strings.Contains(code, "<code>say &quot;hi&quot; -- now</code>") {
+		t.Errorf("code changed without -smartypants:\n%s", code)
+	}
+
+	withMarkdown(t, &smartypants, true)
+	html = render(t, source, 0)
+	for _, want := range []string{"&ldquo;hello&rdquo;", "&ndash;", "&lsquo;bye&rsquo;", "&hellip;", "&mdash;"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("no %s with -smartypants:\n%s", want, html)
+		}
+	}
+	code = render(t, "`say \"hi\" -- now`\n", 0)
+	if !strings.Contains(code, "<code>say &quot;hi&quot; -- now</code>") {
+		t.Errorf("code changed with -smartypants:\n%s", code)
+	}
+}
@@ -0,0 +1,73 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// rewriteRule maps the request paths matching a pattern to a page file,
+// expanding the submatches like $1 in the file template.
+type rewriteRule struct {
+	pattern *regexp.Regexp
+	file    string
+}
+
+// rewriteReference matches the submatch references of a file template.
+var rewriteReference = regexp.MustCompile(`\$(\d+)|\$\{(\d+)\}`)
+
+// parseRewriteRule parses a rule in the format "pattern->file", such as
+// "^/blog/(\d+)/(.*)$->posts/$2.md".
+func parseRewriteRule(value string) (rewriteRule, error) {
+	i := strings.LastIndex(value, "->")
+	if i < 0 {
+		return rewriteRule{}, fmt.Errorf("missing -> in %q", value)
+	}
+	pattern, err := regexp.Compile(strings.TrimSpace(value[:i]))
+	if err != nil {
+		return rewriteRule{}, err
+	}
+	file := strings.TrimSpace(value[i+2:])
+	if file == "" {
+		return rewriteRule{}, fmt.Errorf("missing file in %q", value)
+	}
+	for _, m := range rewriteReference.FindAllStringSubmatch(file, -1) {
+		n, _ := strconv.Atoi(m[1] + m[2])
+		if n > pattern.NumSubexp() {
+			return rewriteRule{}, fmt.Errorf("%q has no submatch %d", pattern, n)
+		}
+	}
+	if ext := path.Ext(file); ext != "" && !strings.Contains(ext, "$") && !isPageFile(file) {
+		return rewriteRule{}, fmt.Errorf("%q is not a page file", file)
+	}
+	return rewriteRule{pattern: pattern, file: file}, nil
+}
+
+// rewriteFile returns the page file of a request path by the first matching
+// -rewrite rule, if any. Files with .. or hidden parts, which could reach
+// outside the data directory or into .git, are returned empty.
+func rewriteFile(page string) (string, bool) {
+	for _, rule := range rewriteRules {
+		m := rule.pattern.FindStringSubmatchIndex(page)
+		if m == nil {
+			continue
+		}
+		file := strings.TrimPrefix(string(rule.pattern.ExpandString(nil, rule.file, page, m)), "/")
+		for _, part := range strings.Split(file, "/") {
+			if part == "" || strings.HasPrefix(part, ".") {
+				return "", true
+			}
+		}
+		if !isPageFile(file) {
+			file = resolveFile(file)
+		}
+		return file, true
+	}
+	return "", false
+}
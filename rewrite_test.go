@@ -0,0 +1,99 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// rewriting applies -rewrite rules until the end of the test.
+func rewriting(t *testing.T, values ...string) {
+	t.Helper()
+	old := rewriteRules
+	rewriteRules = nil
+	for _, value := range values {
+		rule, err := parseRewriteRule(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rewriteRules = append(rewriteRules, rule)
+	}
+	t.Cleanup(func() { rewriteRules = old })
+}
+
+func TestRewriteFile(t *testing.T) {
+	newTestWiki(t, map[string]string{"posts/hello.md": "# Hello\n"})
+	rewriting(t,
+		`^/blog/(\d+)/(.*)$->posts/$2.md`,
+		`^/blog/(.*)$->archive/${1}`,
+		`^/docs/(.*)$->$1`,
+		`^/raw/(.*)$->/$1.md`,
+		`^/swap/(\w+)-(\w+)$->$2/$1.md`)
+
+	tests := []struct {
+		page    string
+		file    string
+		matched bool
+	}{
+		{"/blog/2021/hello", "posts/hello.md", true},
+		{"/blog/2021/a/b", "posts/a/b.md", true},
+		{"/blog/notes", "archive/notes.md", true},
+		{"/swap/a-b", "b/a.md", true},
+		{"/raw/x", "x.md", true},
+		{"/other", "", false},
+
+		// Traversal and hidden files
+		{"/docs/../../etc/passwd", "", true},
+		{"/docs/a/../../../etc/passwd", "", true},
+		{"/docs/.git/config", "", true},
+		{"/docs/a/./.hidden", "", true},
+		{"/docs/a/.hidden/page", "", true},
+		{"/docs/a/./b", "", true},
+		{"/docs/a//b", "", true},
+		{"/docs/", "", true},
+		{"/blog/2021/../../../etc/passwd", "", true},
+		{"/raw/../x", "", true},
+	}
+	for _, test := range tests {
+		file, matched := rewriteFile(test.page)
+		if file != test.file || matched != test.matched {
+			t.Errorf("rewriteFile(%q) = %q, %v, want %q, %v", test.page, file, matched, test.file, test.matched)
+		}
+	}
+
+	for _, page := range []string{"/docs/.git/config", "/docs/../../etc/passwd"} {
+		w := httptest.NewRecorder()
+		wikiHandler(w, httptest.NewRequest("GET", page, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s answered %d, want 404", page, w.Code)
+		}
+	}
+	w := httptest.NewRecorder()
+	wikiHandler(w, httptest.NewRequest("GET", "/blog/2021/hello", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("/blog/2021/hello answered %d, want the rewritten page", w.Code)
+	}
+}
+
+func TestParseRewriteRule(t *testing.T) {
+	for _, value := range []string{
+		`^/blog/(.*)$`,
+		`^/blog/(.*$->posts/$1.md`,
+		`^/blog/(.*)$->`,
+		`^/blog/(.*)$->posts/$2.md`,
+		`^/blog/(.*)$->posts/${3}.md`,
+		`^/blog/(.*)$->posts/$1.exe`,
+	} {
+		if _, err := parseRewriteRule(value); err == nil {
+			t.Errorf("parseRewriteRule(%q) succeeded", value)
+		}
+	}
+	rule, err := parseRewriteRule(`^/a->b/(x)$->c/$1.md`)
+	if err != nil || rule.pattern.String() != `^/a->b/(x)$` || rule.file != "c/$1.md" {
+		t.Errorf("parseRewriteRule with -> in the pattern = %v, %v", rule, err)
+	}
+}
@@ -0,0 +1,85 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// defaultRobots keeps crawlers away from the system pages and the editing
+// and history views, which are expensive to render.
+const defaultRobots = `User-agent: *
+Disallow: %[1]s/_
+Disallow: %[1]s/api/
+Disallow: %[1]s/*?edit=
+Disallow: %[1]s/*?*&edit=
+Disallow: %[1]s/*?revisions=
+Disallow: %[1]s/*?*&revisions=
+Disallow: %[1]s/*?revision=
+Disallow: %[1]s/*?*&revision=
+`
+
+func robotsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if robotsFile != "" {
+		bytes, err := ioutil.ReadFile(robotsFile)
+		if err != nil {
+			log.Printf("Cant read robots file %q, error: %v", robotsFile, err)
+			http.Error(w, "Could not read robots.txt", http.StatusInternalServerError)
+			return
+		}
+		w.Write(bytes)
+		return
+	}
+	fmt.Fprintf(w, defaultRobots, strings.TrimSuffix(basepath, "/"))
+	if baseURL != "" {
+		fmt.Fprintf(w, "\nSitemap: %s%s/sitemap.xml\n", baseURL, strings.TrimSuffix(basepath, "/"))
+	}
+}
+
+// sitemapURL is a single page of the sitemap.
+type sitemapURL struct {
+	Loc string `xml:"loc"`
+}
+
+// isNoIndex reports whether the front matter of a page asks search engines
+// not to index it, with "noindex: true".
+func isNoIndex(meta map[string]string) bool {
+	return parseBool(meta["noindex"])
+}
+
+func sitemapHandler(w http.ResponseWriter, r *http.Request) {
+	if baseURL == "" {
+		http.NotFound(w, r)
+		return
+	}
+	sitemap := struct {
+		XMLName xml.Name     `xml:"urlset"`
+		XMLNS   string       `xml:"xmlns,attr"`
+		URLs    []sitemapURL `xml:"url"`
+	}{XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+	pages, _ := listPages("")
+	for _, file := range pages {
+		bytes, err := ioutil.ReadFile(path.Join(directory, file))
+		if err != nil || isUnpublished(file, bytes) {
+			continue
+		}
+		if meta, _ := parseFrontMatter(bytes); isNoIndex(mergeSidecar(meta, file)) {
+			continue
+		}
+		sitemap.URLs = append(sitemap.URLs, sitemapURL{Loc: baseURL + pageURL(file)})
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	if err := xml.NewEncoder(w).Encode(sitemap); err != nil {
+		log.Printf("Could not encode sitemap: %v", err)
+	}
+}
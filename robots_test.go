@@ -0,0 +1,58 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNoIndex(t *testing.T) {
+	newTestWiki(t, map[string]string{
+		"public.md":               "# Public\n",
+		"hidden.md":               "---\nnoindex: true\n---\n# Hidden\n",
+		"indexed.md":              "---\nnoindex: false\n---\n# Indexed\n",
+		"sidecar.md":              "# Sidecar\n",
+		"sidecar" + sidecarSuffix: `{"noindex": true}`,
+	})
+	defer func(old string) { baseURL = old }(baseURL)
+	baseURL = "https://wiki.example.com"
+
+	tests := []struct {
+		page    string
+		noindex bool
+	}{
+		{"/public", false},
+		{"/hidden", true},
+		{"/indexed", false},
+		{"/sidecar", true},
+	}
+	sitemap := httptest.NewRecorder()
+	sitemapHandler(sitemap, httptest.NewRequest("GET", "/sitemap.xml", nil))
+	llms := httptest.NewRecorder()
+	llmsHandler(llms, httptest.NewRequest("GET", "/llms.txt", nil))
+	llmsFull := httptest.NewRecorder()
+	llmsFullHandler(llmsFull, httptest.NewRequest("GET", "/llms-full.txt", nil))
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		wikiHandler(w, httptest.NewRequest("GET", test.page, nil))
+		if got := strings.Contains(w.Body.String(), `<meta name="robots" content="noindex">`); got != test.noindex {
+			t.Errorf("%s has the noindex meta tag %v, want %v", test.page, got, test.noindex)
+		}
+		loc := "<loc>" + baseURL + test.page + "</loc>"
+		if got := strings.Contains(sitemap.Body.String(), loc); got == test.noindex {
+			t.Errorf("%s is in the sitemap %v, want %v:\n%s", test.page, got, !test.noindex, sitemap.Body)
+		}
+		url := "(" + baseURL + test.page + ")"
+		if got := strings.Contains(llms.Body.String(), url); got == test.noindex {
+			t.Errorf("%s is in llms.txt %v, want %v:\n%s", test.page, got, !test.noindex, llms.Body)
+		}
+		url = "URL: " + baseURL + test.page + "\n"
+		if got := strings.Contains(llmsFull.Body.String(), url); got == test.noindex {
+			t.Errorf("%s is in llms-full.txt %v, want %v:\n%s", test.page, got, !test.noindex, llmsFull.Body)
+		}
+	}
+}
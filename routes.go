@@ -0,0 +1,38 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// reservedPaths holds the paths served by handlers other than the wiki, which
+// no page may shadow. Paths ending with a slash reserve everything below them.
+var reservedPaths = []string{"/api/"}
+
+// handleFunc registers a handler for a reserved path.
+func handleFunc(pattern string, handler http.HandlerFunc) {
+	handle(pattern, handler)
+}
+
+// handle registers a handler for a reserved path.
+func handle(pattern string, handler http.Handler) {
+	reservedPaths = append(reservedPaths, pattern)
+	http.Handle(pattern, handler)
+}
+
+// isReserved reports whether a page path is taken by a reserved path.
+func isReserved(page string) bool {
+	for _, reserved := range reservedPaths {
+		if page == reserved || page == strings.TrimSuffix(reserved, "/") {
+			return true
+		}
+		if strings.HasSuffix(reserved, "/") && strings.HasPrefix(page, reserved) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// reserving reserves the paths of handlers until the end of the test.
+func reserving(t *testing.T, patterns ...string) {
+	t.Helper()
+	old := reservedPaths
+	reservedPaths = append(append([]string(nil), old...), patterns...)
+	t.Cleanup(func() { reservedPaths = old })
+}
+
+func TestIsReserved(t *testing.T) {
+	reserving(t, "/static/", "/_search")
+	tests := []struct {
+		page     string
+		reserved bool
+	}{
+		{"/static", true},
+		{"/static/", true},
+		{"/static/css/style", true},
+		{"/_search", true},
+		{"/api/history/a", true},
+		{"/_search/sub", false},
+		{"/statics", false},
+		{"/search", false},
+		{"/docs/static", false},
+	}
+	for _, test := range tests {
+		if got := isReserved(test.page); got != test.reserved {
+			t.Errorf("isReserved(%q) = %v, want %v", test.page, got, test.reserved)
+		}
+	}
+}
+
+func TestReservedPagesRejected(t *testing.T) {
+	dir := newTestWiki(t, map[string]string{"index.md": "# Home\n"})
+	reserving(t, "/static/", "/_search")
+
+	for _, page := range []string{"/static", "/static/css/style", "/_search", "/api/history/a"} {
+		if w := postPage(t, nil, page, "# Shadow\n"); w.Code != http.StatusBadRequest {
+			t.Errorf("creating a page at %s answered %d, want 400", page, w.Code)
+		}
+		w := httptest.NewRecorder()
+		wikiHandler(w, httptest.NewRequest("GET", page+"?edit=1", nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("editing a page at %s answered %d, want 400", page, w.Code)
+		}
+	}
+	if status := gitStatus(t, dir); status != "" {
+		t.Errorf("files left behind by the rejected pages:\n%s", status)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "static.md")); !os.IsNotExist(err) {
+		t.Error("static.md was created")
+	}
+
+	if w := postPage(t, nil, "/statics", "# Fine\n"); w.Code >= 400 {
+		t.Errorf("creating a page at /statics answered %d", w.Code)
+	}
+}
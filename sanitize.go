@@ -0,0 +1,215 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+// htmlPolicy is the inline HTML allowed in pages, which is otherwise omitted.
+// In the policy file, tags maps every allowed tag to its allowed attributes
+// and iframeHosts lists the hosts iframes may embed, for example:
+//
+//	{"tags": {"details": ["open"], "summary": [], "iframe": ["src", "width"]},
+//	 "iframeHosts": ["www.youtube.com"]}
+type htmlPolicy struct {
+	Tags        map[string][]string `json:"tags"`
+	IframeHosts []string            `json:"iframeHosts"`
+}
+
+var (
+	htmlName      = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+	htmlHost      = regexp.MustCompile(`^[a-z0-9]([a-z0-9.-]*[a-z0-9])?(:\d+)?$`)
+	htmlComment   = regexp.MustCompile(`^<!--[\s\S]*?-->`)
+	htmlTag       = regexp.MustCompile(`^<(/?)([a-zA-Z][a-zA-Z0-9-]*)((?:\s+[^\s"'>/=]+(?:\s*=\s*(?:"[^"]*"|'[^']*'|[^\s"'=<>` + "`" + `]+))?)*)\s*/?>`)
+	htmlAttribute = regexp.MustCompile(`([^\s"'>/=]+)(?:\s*=\s*("[^"]*"|'[^']*'|[^\s"'=<>` + "`" + `]+))?`)
+)
+
+// htmlUnsafeTags can never be allowed, as they run code or restyle the wiki.
+var htmlUnsafeTags = map[string]bool{"script": true, "style": true, "object": true, "embed": true, "base": true, "meta": true, "link": true}
+
+// htmlURLAttributes hold links, which must be safe URLs.
+var htmlURLAttributes = map[string]bool{"href": true, "src": true, "cite": true, "poster": true, "action": true, "formaction": true, "data": true}
+
+// htmlURLSchemes are the schemes allowed in links, besides relative URLs.
+var htmlURLSchemes = map[string]bool{"http": true, "https": true, "mailto": true}
+
+// loadHTMLPolicy reads and validates an inline HTML policy file.
+func loadHTMLPolicy(file string) (*htmlPolicy, error) {
+	bytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var policy htmlPolicy
+	decoder := json.NewDecoder(strings.NewReader(string(bytes)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&policy); err != nil {
+		return nil, err
+	}
+	for tag, attributes := range policy.Tags {
+		if !htmlName.MatchString(tag) || htmlUnsafeTags[tag] {
+			return nil, fmt.Errorf("tag %q can not be allowed", tag)
+		}
+		for _, attribute := range attributes {
+			if !htmlName.MatchString(attribute) || strings.HasPrefix(attribute, "on") || attribute == "style" {
+				return nil, fmt.Errorf("attribute %q of tag %q can not be allowed", attribute, tag)
+			}
+		}
+	}
+	for _, host := range policy.IframeHosts {
+		if !htmlHost.MatchString(host) {
+			return nil, fmt.Errorf("invalid iframe host %q", host)
+		}
+	}
+	if _, ok := policy.Tags["iframe"]; ok && len(policy.IframeHosts) == 0 {
+		return nil, fmt.Errorf("iframes need iframeHosts")
+	}
+	return &policy, nil
+}
+
+// allows reports whether a piece of HTML only has allowed tags, attributes
+// and links, besides comments and text.
+func (p *htmlPolicy) allows(raw []byte) bool {
+	for i := bytes.IndexByte(raw, '<'); i >= 0; i = bytes.IndexByte(raw, '<') {
+		raw = raw[i:]
+		if m := htmlComment.Find(raw); m != nil {
+			raw = raw[len(m):]
+			continue
+		}
+		m := htmlTag.FindSubmatch(raw)
+		if m == nil {
+			return false
+		}
+		tag := strings.ToLower(string(m[2]))
+		allowed, ok := p.Tags[tag]
+		if !ok {
+			return false
+		}
+		if len(m[1]) == 0 && !p.allowsAttributes(tag, allowed, string(m[3])) {
+			return false
+		}
+		raw = raw[len(m[0]):]
+	}
+	return true
+}
+
+// allowsAttributes checks the attributes of an opening tag.
+func (p *htmlPolicy) allowsAttributes(tag string, allowed []string, attributes string) bool {
+	for _, m := range htmlAttribute.FindAllStringSubmatch(attributes, -1) {
+		// Browsers decode entities before following a link
+		name, value := strings.ToLower(m[1]), html.UnescapeString(strings.Trim(m[2], `"'`))
+		found := false
+		for _, a := range allowed {
+			found = found || a == name
+		}
+		if !found {
+			return false
+		}
+		if htmlURLAttributes[name] && !safeURL(value) {
+			return false
+		}
+		if tag == "iframe" && name == "src" && !p.allowsFrame(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// safeURL reports whether a decoded attribute value is a relative URL or one
+// of htmlURLSchemes. Browsers ignore the whitespace and control characters
+// within a scheme such as "java\tscript:", and its case.
+func safeURL(value string) bool {
+	value = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, value)
+	u, err := url.Parse(strings.ToLower(value))
+	return err == nil && (u.Scheme == "" || htmlURLSchemes[u.Scheme])
+}
+
+// allowsFrame reports whether an iframe may embed a URL.
+func (p *htmlPolicy) allowsFrame(src string) bool {
+	u, err := url.Parse(src)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return false
+	}
+	for _, host := range p.IframeHosts {
+		if strings.EqualFold(u.Host, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedHTML renders the inline HTML allowed by a policy as is, and omits
+// any other like the default renderer.
+type allowedHTML struct {
+	policy *htmlPolicy
+}
+
+// Extend adds the inline HTML rendering to a markdown renderer.
+func (a allowedHTML) Extend(m goldmark.Markdown) {
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(a, 100)))
+}
+
+// RegisterFuncs registers the inline HTML renderers.
+func (a allowedHTML) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindHTMLBlock, a.renderHTMLBlock)
+	reg.Register(ast.KindRawHTML, a.renderRawHTML)
+}
+
+func (a allowedHTML) renderHTMLBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	n := node.(*ast.HTMLBlock)
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	var raw bytes.Buffer
+	for i := 0; i < n.Lines().Len(); i++ {
+		line := n.Lines().At(i)
+		raw.Write(line.Value(source))
+	}
+	if n.HasClosure() {
+		raw.Write(n.ClosureLine.Value(source))
+	}
+	if a.policy.allows(raw.Bytes()) {
+		_, _ = w.Write(raw.Bytes())
+	} else {
+		_, _ = w.WriteString("<!-- raw HTML omitted -->\n")
+	}
+	return ast.WalkContinue, nil
+}
+
+func (a allowedHTML) renderRawHTML(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkSkipChildren, nil
+	}
+	n := node.(*ast.RawHTML)
+	var raw bytes.Buffer
+	for i := 0; i < n.Segments.Len(); i++ {
+		segment := n.Segments.At(i)
+		raw.Write(segment.Value(source))
+	}
+	if a.policy.allows(raw.Bytes()) {
+		_, _ = w.Write(raw.Bytes())
+	} else {
+		_, _ = w.WriteString("<!-- raw HTML omitted -->")
+	}
+	return ast.WalkSkipChildren, nil
+}
@@ -0,0 +1,92 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// testPolicy allows links, images and YouTube iframes.
+var testPolicy = &htmlPolicy{
+	Tags:        map[string][]string{"a": {"href", "title"}, "img": {"src", "alt"}, "iframe": {"src"}, "b": {}},
+	IframeHosts: []string{"www.youtube.com"},
+}
+
+func TestPolicyLinks(t *testing.T) {
+	tests := []struct {
+		html    string
+		allowed bool
+	}{
+		{`<a href="https://example.com/">x</a>`, true},
+		{`<a href="http://example.com/">x</a>`, true},
+		{`<a href="mailto:someone@example.com">x</a>`, true},
+		{`<a href="/page">x</a>`, true},
+		{`<a href="../page?a=1#top">x</a>`, true},
+		{`<a href="#top">x</a>`, true},
+		{`<a href="//example.com/">x</a>`, true},
+		{`<a href="https://example.com/?a=1&amp;b=2">x</a>`, true},
+		{`<a href>x</a>`, true},
+		{`<a href="javascript:alert(1)">x</a>`, false},
+		{`<a href="JavaScript:alert(1)">x</a>`, false},
+		{`<a href="JAVASCRIPT:alert(1)">x</a>`, false},
+		{`<a href="jav&#x61;script:alert(1)">x</a>`, false},
+		{`<a href="jav&#97;script:alert(1)">x</a>`, false},
+		{`<a href="javascript&colon;alert(1)">x</a>`, false},
+		{`<a href=" javascript:alert(1)">x</a>`, false},
+		{`<a href="&#x20;javascript:alert(1)">x</a>`, false},
+		{`<a href="java	script:alert(1)">x</a>`, false},
+		{`<a href="java&#x09;script:alert(1)">x</a>`, false},
+		{`<a href="java&NewLine;script:alert(1)">x</a>`, false},
+		{"<a href=\"\x01javascript:alert(1)\">x</a>", false},
+		{`<a href='javascript:alert(1)'>x</a>`, false},
+		{`<a href=javascript:alert(1)>x</a>`, false},
+		{`<a href="vbscript:msgbox(1)">x</a>`, false},
+		{`<a href="data:text/html,<script>alert(1)</script>">x</a>`, false},
+		{`<img src="data:image/svg+xml;base64,PHN2Zz4=" alt="x">`, false},
+		{`<a href="file:///etc/passwd">x</a>`, false},
+		{`<a href="x" onclick="alert(1)">x</a>`, false},
+		{`<a title="javascript:alert(1)" href="/">x</a>`, true},
+		{`<script>alert(1)</script>`, false},
+	}
+	for _, test := range tests {
+		if got := testPolicy.allows([]byte(test.html)); got != test.allowed {
+			t.Errorf("allows(%q) = %v, want %v", test.html, got, test.allowed)
+		}
+	}
+}
+
+func TestPolicyFrames(t *testing.T) {
+	tests := []struct {
+		html    string
+		allowed bool
+	}{
+		{`<iframe src="https://www.youtube.com/embed/x"></iframe>`, true},
+		{`<iframe src="https://WWW.YOUTUBE.COM/embed/x"></iframe>`, true},
+		{`<iframe src="https://evil.example/embed/x"></iframe>`, false},
+		{`<iframe src="https://www.youtube.com&#64;evil.example/"></iframe>`, false},
+		{`<iframe src="/local"></iframe>`, false},
+		{`<iframe src="javascript:alert(1)"></iframe>`, false},
+	}
+	for _, test := range tests {
+		if got := testPolicy.allows([]byte(test.html)); got != test.allowed {
+			t.Errorf("allows(%q) = %v, want %v", test.html, got, test.allowed)
+		}
+	}
+}
+
+func TestPolicyRendering(t *testing.T) {
+	defer func(old *htmlPolicy) { inlineHTML = old; md = newMarkdown() }(inlineHTML)
+	inlineHTML = testPolicy
+	md = newMarkdown()
+
+	html := render(t, "Click <a href=\"jav&#x61;script:alert(1)\">here</a> or <b>there</b>.\n\n<a href=\" javascript:alert(1)\">block</a>\n", 0)
+	if strings.Contains(html, "script:") {
+		t.Errorf("dangerous links rendered:\n%s", html)
+	}
+	if !strings.Contains(html, "<b>there</b>") {
+		t.Errorf("allowed HTML omitted:\n%s", html)
+	}
+}
@@ -0,0 +1,92 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// searchPages scans the pages for the words of a query, ignoring case, and
+// returns the pages having all of them. The scan stops at -search-max-results
+// pages or once ctx is done, returning the results so far as truncated.
+func searchPages(ctx context.Context, query string, admin bool) (results []*Directory, truncated bool) {
+	var words [][]byte
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		words = append(words, []byte(word))
+	}
+	if len(words) == 0 {
+		return nil, false
+	}
+	pages, _ := listPages("")
+	for _, file := range pages {
+		if ctx.Err() != nil {
+			return results, true
+		}
+		content, err := ioutil.ReadFile(path.Join(directory, file))
+		if err != nil {
+			log.Printf("Cant read file %q, error: %v", file, err)
+			continue
+		}
+		lower := bytes.ToLower(content)
+		found := true
+		for _, word := range words {
+			found = found && bytes.Contains(lower, word)
+		}
+		if !found || (!admin && isUnpublished(file, content)) {
+			continue
+		}
+		if searchMaxResults > 0 && len(results) >= searchMaxResults {
+			return results, true
+		}
+		meta, _ := parseFrontMatter(content)
+		results = append(results, &Directory{
+			Path:    pageURL(file),
+			Name:    strings.TrimSuffix(file, path.Ext(file)),
+			Heading: meta["title"],
+			Summary: matchingLine(content, lower, words[0]),
+		})
+	}
+	return results, false
+}
+
+// matchingLine returns the first line of content with a word, shortened.
+// Lowering keeps the lines, but not always their length, so the line is
+// found by its number.
+func matchingLine(content, lower, word []byte) string {
+	n := bytes.Count(lower[:bytes.Index(lower, word)], []byte("\n"))
+	return snippet(string(bytes.SplitN(content, []byte("\n"), n+2)[n]), 200)
+}
+
+// searchHandler lists the pages matching the q query, see searchPages.
+func searchHandler(w http.ResponseWriter, r *http.Request) {
+	s := currentSettings()
+	node := &Node{
+		Path:     "/_search",
+		Title:    s.Title,
+		Basepath: strings.TrimSuffix(basepath, "/"),
+		Template: "search.tpl",
+		System:   true,
+		Query:    strings.TrimSpace(r.FormValue("q")),
+	}
+	node.readTheme(w, r)
+	ctx := r.Context()
+	if searchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, searchTimeout)
+		defer cancel()
+	}
+	node.Pages, node.Truncated = searchPages(ctx, node.Query, isAdmin(r))
+	if node.Truncated {
+		log.Printf("Search for %q truncated at %d results", node.Query, len(node.Pages))
+	}
+	node.Dirs = listDirectories("/")
+	renderTemplate(w, node)
+}
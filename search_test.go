@@ -0,0 +1,76 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSearchPages(t *testing.T) {
+	files := map[string]string{
+		"other.md":  "# Other\n\nNothing to see.\n",
+		"future.md": "---\npublish: 2999-01-01\n---\n# Future match\n",
+		"cased.md":  "# Cased\n\nA MATCH in capitals.\n",
+	}
+	for i := 0; i < 4; i++ {
+		files[fmt.Sprintf("page%d.md", i)] = fmt.Sprintf("# Page %d\n\nA match here.\n", i)
+	}
+	newTestWiki(t, files)
+	defer func(old int) { searchMaxResults = old }(searchMaxResults)
+
+	tests := []struct {
+		max       int
+		admin     bool
+		results   int
+		truncated bool
+	}{
+		{0, false, 5, false},
+		{5, false, 5, false},
+		{3, false, 3, true},
+		{1, false, 1, true},
+		{0, true, 6, false},
+		{5, true, 5, true},
+	}
+	for _, test := range tests {
+		searchMaxResults = test.max
+		results, truncated := searchPages(context.Background(), "  Match ", test.admin)
+		if len(results) != test.results || truncated != test.truncated {
+			t.Errorf("searchPages with max %d, admin %v = %d results, truncated %v, want %d, %v",
+				test.max, test.admin, len(results), truncated, test.results, test.truncated)
+		}
+	}
+
+	searchMaxResults = 0
+	if results, truncated := searchPages(context.Background(), "match other", false); len(results) != 0 || truncated {
+		t.Errorf("searchPages needing all words = %d results, truncated %v", len(results), truncated)
+	}
+	if results, truncated := searchPages(context.Background(), " ", false); results != nil || truncated {
+		t.Errorf("searchPages without words = %d results, truncated %v", len(results), truncated)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if results, truncated := searchPages(ctx, "match", false); len(results) != 0 || !truncated {
+		t.Errorf("searchPages once the context is done = %d results, truncated %v, want 0, true", len(results), truncated)
+	}
+}
+
+func TestSearchHandlerTruncated(t *testing.T) {
+	newTestWiki(t, map[string]string{"a.md": "match\n", "b.md": "match\n"})
+	defer func(old int) { searchMaxResults = old }(searchMaxResults)
+
+	for _, max := range []int{0, 1} {
+		searchMaxResults = max
+		w := httptest.NewRecorder()
+		searchHandler(w, httptest.NewRequest("GET", "/_search?q=match", nil))
+		if got := strings.Contains(w.Body.String(), T("search.truncated")); got != (max == 1) {
+			t.Errorf("search with max %d shows the truncation notice %v, want %v", max, got, max == 1)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"bytes"
+)
+
+// splitSections splits markdown at its top-level ATX headings ("# Title"),
+// outside of code fences. Text before the first heading stays with it.
+func splitSections(source []byte) [][]byte {
+	var sections [][]byte
+	start := 0
+	heading := false // The current section has a heading
+	fence := ""
+	for offset := 0; offset < len(source); {
+		end := bytes.IndexByte(source[offset:], '\n') + offset + 1
+		if end == offset {
+			end = len(source)
+		}
+		line := bytes.TrimRight(source[offset:end], "\r\n")
+		indent := len(line) - len(bytes.TrimLeft(line, " "))
+		line = line[indent:]
+		switch {
+		case indent >= 4:
+			// Indented code
+		case fence != "":
+			if bytes.HasPrefix(line, []byte(fence)) && len(bytes.Trim(line, fence[:1]+" ")) == 0 {
+				fence = ""
+			}
+		case bytes.HasPrefix(line, []byte("```")) || bytes.HasPrefix(line, []byte("~~~")):
+			fence = string(line[:len(line)-len(bytes.TrimLeft(line, string(line[:1])))])
+		case bytes.Equal(line, []byte("#")) || bytes.HasPrefix(line, []byte("# ")) || bytes.HasPrefix(line, []byte("#\t")):
+			if heading {
+				sections = append(sections, source[start:offset])
+				start = offset
+			}
+			heading = true
+		}
+		offset = end
+	}
+	return append(sections, source[start:])
+}
@@ -0,0 +1,107 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Settings holds the options which can be changed while running.
+type Settings struct {
+	Title    string `json:"title"`
+	LogLimit int    `json:"logLimit"`
+	ReadOnly bool   `json:"readOnly"`
+
+	Maintenance bool `json:"maintenance"`
+}
+
+var (
+	settings      Settings
+	settingsMutex sync.RWMutex
+)
+
+// currentSettings returns a copy of the active settings.
+func currentSettings() Settings {
+	settingsMutex.RLock()
+	defer settingsMutex.RUnlock()
+	return settings
+}
+
+// updateSettings replaces the active settings and saves them.
+func updateSettings(s Settings) error {
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+	settings = s
+	if settingsFile == "" {
+		return nil
+	}
+	bytes, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(settingsFile, bytes, 0644)
+}
+
+// loadSettings overrides the active settings with previously saved ones.
+func loadSettings() error {
+	if settingsFile == "" {
+		return nil
+	}
+	bytes, err := ioutil.ReadFile(settingsFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+	return json.Unmarshal(bytes, &settings)
+}
+
+func settingsHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	s := currentSettings()
+	if r.Method == http.MethodPost {
+		if !checkCSRF(w, r) {
+			return
+		}
+		s.Title = strings.TrimSpace(r.PostFormValue("title"))
+		s.ReadOnly = parseBool(r.PostFormValue("readonly"))
+		s.Maintenance = parseBool(r.PostFormValue("maintenance"))
+		limit, err := strconv.Atoi(r.PostFormValue("loglimit"))
+		if err != nil || limit < 1 || s.Title == "" {
+			http.Error(w, "Invalid settings", http.StatusBadRequest)
+			return
+		}
+		s.LogLimit = limit
+		if err := updateSettings(s); err != nil {
+			log.Printf("Cant save settings to %q, error: %v", settingsFile, err)
+		}
+		http.Redirect(w, r, strings.TrimSuffix(basepath, "/")+r.URL.Path, http.StatusSeeOther)
+		return
+	}
+
+	node := &Node{
+		Path:     r.URL.Path,
+		Title:    s.Title,
+		Basepath: strings.TrimSuffix(basepath, "/"),
+		Template: "settings.tpl",
+		System:   true,
+		Settings: s,
+		CSRF:     csrfToken(r),
+	}
+	node.Dirs = listDirectories(r.URL.Path)
+	renderTemplate(w, node)
+}
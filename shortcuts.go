@@ -0,0 +1,70 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// shortcutActions are the actions keyboard shortcuts can take.
+var shortcutActions = map[string]bool{"edit": true, "history": true, "search": true, "recent": true, "home": true}
+
+// defaultShortcuts maps the keys to their actions, see -shortcuts.
+var defaultShortcuts = map[string]string{"e": "edit", "h": "history", "/": "search", "r": "recent"}
+
+// loadShortcuts reads a shortcut file overriding the default shortcuts, with
+// an empty action removing a key, for example:
+//
+//	{"e": "", "E": "edit", "g": "home"}
+func loadShortcuts(file string) (map[string]string, error) {
+	shortcuts := make(map[string]string)
+	for key, action := range defaultShortcuts {
+		shortcuts[key] = action
+	}
+	if file == "" {
+		return shortcuts, nil
+	}
+	bytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var overrides map[string]string
+	if err := json.Unmarshal(bytes, &overrides); err != nil {
+		return nil, err
+	}
+	for key, action := range overrides {
+		if len([]rune(key)) != 1 {
+			return nil, fmt.Errorf("shortcut %q is not a single key", key)
+		}
+		if action == "" {
+			delete(shortcuts, key)
+		} else if !shortcutActions[action] {
+			return nil, fmt.Errorf("unknown action %q of shortcut %q", action, key)
+		} else {
+			shortcuts[key] = action
+		}
+	}
+	return shortcuts, nil
+}
+
+// shortcutURLs returns the URLs of the shortcut actions on the page of a
+// node. Searching focuses the search field of the page instead.
+func shortcutURLs(node *Node) map[string]string {
+	basepath := strings.TrimSuffix(basepath, "/")
+	urls := map[string]string{
+		"recent": basepath + "/_recent",
+		"home":   basepath + "/",
+	}
+	if !node.System && node.Path != "" {
+		urls["history"] = basepath + node.Path + "?revisions=1"
+		if !node.ReadOnly {
+			urls["edit"] = basepath + node.Path + "?edit=1"
+		}
+	}
+	return urls
+}
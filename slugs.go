@@ -0,0 +1,79 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// slugSeparators are runs of characters which slugs treat alike.
+var slugSeparators = regexp.MustCompile(`[\s_-]+`)
+
+// slug normalises a page path for comparison, so that "/My_Page" and
+// "/my page" both become "/my-page".
+func slug(page string) string {
+	parts := strings.Split(strings.ToLower(page), "/")
+	for i, part := range parts {
+		parts[i] = strings.Trim(slugSeparators.ReplaceAllString(part, "-"), "-")
+	}
+	return strings.Join(parts, "/")
+}
+
+// slugMatches returns the files of the other pages with the slug of page,
+// leaving out unpublished pages unless admin.
+func slugMatches(page string, admin bool) []string {
+	want := slug(strings.TrimPrefix(page, "/"))
+	pages, _ := listPages("")
+	var matches []string
+	for _, file := range pages {
+		name := strings.TrimSuffix(file, path.Ext(file))
+		if "/"+name == page || slug(name) != want {
+			continue
+		}
+		if !admin {
+			bytes, err := ioutil.ReadFile(path.Join(directory, file))
+			if err != nil || isUnpublished(file, bytes) {
+				continue
+			}
+		}
+		matches = append(matches, file)
+	}
+	return matches
+}
+
+// serveSlugMatch redirects a missing page to the page differing only in case
+// or separators, with -slug-redirects. Several such pages are listed to pick
+// from instead. Returns false if there are none.
+func serveSlugMatch(w http.ResponseWriter, r *http.Request, node *Node) bool {
+	matches := slugMatches(node.Path, isAdmin(r))
+	switch len(matches) {
+	case 0:
+		return false
+	case 1:
+		target := (&url.URL{Path: pageURL(matches[0])}).EscapedPath()
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+		return true
+	}
+	for _, file := range matches {
+		node.Pages = append(node.Pages, &Directory{
+			Path: pageURL(file),
+			Name: strings.TrimSuffix(file, path.Ext(file)),
+		})
+	}
+	node.Template = "slugs.tpl"
+	node.System = true
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusMultipleChoices)
+	renderTemplate(w, node)
+	return true
+}
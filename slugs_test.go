@@ -0,0 +1,79 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSlug(t *testing.T) {
+	tests := []struct {
+		page string
+		want string
+	}{
+		{"/My_Page", "/my-page"},
+		{"/my page", "/my-page"},
+		{"/MY-PAGE", "/my-page"},
+		{"/my  __ -page", "/my-page"},
+		{"/_draft_", "/draft"},
+		{"/Docs/Getting_Started", "/docs/getting-started"},
+		{"/docs/getting started/", "/docs/getting-started/"},
+		{"/Über_Uns", "/über-uns"},
+		{"/tab\tand\nnewline", "/tab-and-newline"},
+		{"/café.v2", "/café.v2"},
+		{"/", "/"},
+	}
+	for _, test := range tests {
+		if got := slug(test.page); got != test.want {
+			t.Errorf("slug(%q) = %q, want %q", test.page, got, test.want)
+		}
+	}
+}
+
+func TestSlugRedirects(t *testing.T) {
+	newTestWiki(t, map[string]string{
+		"Getting_Started.md": "# Start\n",
+		"docs/Read Me.md":    "# Read me\n",
+		"Twin-Page.md":       "# One\n",
+		"twin_page.md":       "# Other\n",
+		"Later.md":           "---\npublish: 2999-01-01\n---\n# Later\n",
+	})
+	defer func(old bool) { slugRedirects = old }(slugRedirects)
+	slugRedirects = true
+
+	get := func(page string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		wikiHandler(w, httptest.NewRequest("GET", page, nil))
+		return w
+	}
+	tests := []struct {
+		page     string
+		location string
+	}{
+		{"/getting-started", "/Getting_Started"},
+		{"/GETTING%20STARTED?theme=dark", "/Getting_Started?theme=dark"},
+		{"/docs/read_me", "/docs/Read%20Me"},
+	}
+	for _, test := range tests {
+		w := get(test.page)
+		if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != test.location {
+			t.Errorf("%s answered %d to %q, want a redirect to %s", test.page, w.Code, w.Header().Get("Location"), test.location)
+		}
+	}
+
+	if w := get("/twin%20page"); w.Code != http.StatusMultipleChoices ||
+		!strings.Contains(w.Body.String(), "/Twin-Page") || !strings.Contains(w.Body.String(), "/twin_page") {
+		t.Errorf("a slug of two pages answered %d, want both pages to pick from", w.Code)
+	}
+	if w := get("/later"); w.Code == http.StatusMovedPermanently {
+		t.Error("a missing page redirects to an unpublished one")
+	}
+	if w := get("/Getting_Started"); w.Code != http.StatusOK {
+		t.Errorf("an existing page answered %d", w.Code)
+	}
+}
@@ -0,0 +1,126 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// pendingCommit holds the changes of one author staged since their last
+// commit, which are squashed into a single commit once the author has been
+// idle for -squash-idle. Guarded by gitMutex, as the changes wait in the
+// index shared by all commits.
+var pendingCommit = struct {
+	author string
+	files  []string
+	msgs   []string
+	timer  *time.Timer
+	err    error // Why the changes could not be committed, reported by the next save
+}{}
+
+// gitCommitLater stages the changes of files and defers their commit until
+// the author is idle. The pending changes of another author are committed
+// before staging, so that they do not pick up these changes.
+func gitCommitLater(files []string, msg string, author string, stage func() error) error {
+	gitMutex.Lock()
+	defer gitMutex.Unlock()
+
+	if len(pendingCommit.files) > 0 && pendingCommit.author != author {
+		commitPending()
+	}
+	if err := pendingCommit.err; err != nil {
+		// Rather than piling up changes that may never be committed
+		pendingCommit.err = nil
+		return fmt.Errorf("the pending changes could not be committed: %v", err)
+	}
+	if err := stage(); err != nil {
+		return err
+	}
+	pendingCommit.author = author
+	pendingCommit.files = append(pendingCommit.files, files...)
+	if !containsString(pendingCommit.msgs, msg) {
+		pendingCommit.msgs = append(pendingCommit.msgs, msg)
+	}
+	if pendingCommit.timer != nil {
+		pendingCommit.timer.Stop()
+	}
+	pendingCommit.timer = time.AfterFunc(squashIdle, flushPending)
+	invalidateCaches()
+	return nil
+}
+
+// flushPending commits the pending changes, if any.
+func flushPending() {
+	gitMutex.Lock()
+	defer gitMutex.Unlock()
+	commitPending()
+}
+
+// commitPending commits the pending changes with their messages, the
+// caller holding gitMutex. Changes failing to commit stay staged and
+// pending, to be tried again once -squash-idle passed.
+func commitPending() {
+	if len(pendingCommit.files) == 0 {
+		return
+	}
+	if pendingCommit.timer != nil {
+		pendingCommit.timer.Stop()
+	}
+	files, msgs, author := uniqueStrings(pendingCommit.files), pendingCommit.msgs, pendingCommit.author
+	pendingCommit.author, pendingCommit.files, pendingCommit.msgs, pendingCommit.timer = "", nil, nil, nil
+	log.Printf("Committing the changes of %q to %q", author, files)
+	if err := commitStaged(files, strings.Join(msgs, "\n\n"), author); err != nil {
+		log.Printf("Error: the changes of %q to %q stay pending: %v", author, files, err)
+		pendingCommit.author, pendingCommit.files, pendingCommit.msgs = author, files, msgs
+		pendingCommit.timer = time.AfterFunc(squashIdle, flushPending)
+		pendingCommit.err = err
+		return
+	}
+	pendingCommit.err = nil
+}
+
+// stopOnSignal shuts the server down on SIGINT or SIGTERM, waiting for
+// running requests so that their changes are committed.
+func stopOnSignal(server *http.Server) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+	log.Printf("Shutting down")
+	close(stopHosts)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Could not finish all requests: %v", err)
+	}
+}
+
+// containsString reports whether list has s.
+func containsString(list []string, s string) bool {
+	for _, entry := range list {
+		if entry == s {
+			return true
+		}
+	}
+	return false
+}
+
+// uniqueStrings returns list without repeated entries, in order.
+func uniqueStrings(list []string) []string {
+	var unique []string
+	for _, entry := range list {
+		if !containsString(unique, entry) {
+			unique = append(unique, entry)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,67 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// squashing defers the commits of the test until the author was idle for an
+// hour, dropping any changes still pending at its end.
+func squashing(t *testing.T) {
+	oldIdle := squashIdle
+	squashIdle = time.Hour
+	t.Cleanup(func() {
+		gitMutex.Lock()
+		if pendingCommit.timer != nil {
+			pendingCommit.timer.Stop()
+		}
+		pendingCommit.author, pendingCommit.files, pendingCommit.msgs, pendingCommit.timer, pendingCommit.err = "", nil, nil, nil, nil
+		gitMutex.Unlock()
+		squashIdle = oldIdle
+	})
+}
+
+func TestFailedSquashStaysPending(t *testing.T) {
+	dir := newTestWiki(t, map[string]string{"a.md": "old\n"})
+	squashing(t)
+	failCommits(t, dir)
+
+	if err := store.Write("a.md", []byte("first\n"), "alice", "First"); err != nil {
+		t.Fatal(err)
+	}
+	flushPending()
+	if len(pendingCommit.files) != 1 || pendingCommit.author != "alice" {
+		t.Fatalf("changes of a failed commit no longer pending: %+v", pendingCommit)
+	}
+	if status := gitStatus(t, dir); status != "M  a.md" {
+		t.Errorf("git status %q, want a.md staged", status)
+	}
+
+	// Another author neither gets their change mixed in, nor loses it silently
+	if err := store.Write("b.md", []byte("bob\n"), "bob", "Bob"); err == nil {
+		t.Error("save of another author succeeded while the pending changes can not be committed")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b.md")); !os.IsNotExist(err) {
+		t.Error("b.md staged along with the pending changes of another author")
+	}
+
+	// Once committing works again, the pending changes are committed
+	if err := os.Remove(filepath.Join(dir, ".git/hooks/pre-commit")); err != nil {
+		t.Fatal(err)
+	}
+	flushPending()
+	if status := gitStatus(t, dir); status != "" {
+		t.Errorf("changes left after committing them: %q", status)
+	}
+	logs := store.History("a.md", 1)
+	if len(logs) != 1 || !strings.Contains(logs[0].Message, "First") {
+		t.Errorf("history of a.md %+v, want the pending commit", logs)
+	}
+}
@@ -0,0 +1,121 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+)
+
+// Store keeps the wiki files and their history, selected with -storage.
+type Store interface {
+	// Read returns a file at a revision, the latest one without a revision.
+	// Returns nothing for unknown files and revisions.
+	Read(file, revision string) []byte
+	// Write saves a file as a single change, removing the drop files along
+	// with it.
+	Write(file string, content []byte, author, msg string, drop ...string) error
+	// Remove deletes a file as a single change.
+	Remove(file, author, msg string) error
+	// History returns the latest limit changes of a file, newest first.
+	History(file string, limit int) []*Log
+}
+
+// stores are the available storages by -storage name.
+var stores = map[string]Store{
+	"git": gitStore{},
+	"fs":  fsStore{},
+}
+
+// fsStore keeps the wiki as plain files without any history, for where git
+// is not wanted or available.
+type fsStore struct{}
+
+// Read returns a file, there are no revisions.
+func (fsStore) Read(file, revision string) []byte {
+	if revision != "" {
+		return nil
+	}
+	bytes, _ := ioutil.ReadFile(path.Join(directory, file))
+	return bytes
+}
+
+// Write saves a file, author and msg are not kept.
+func (fsStore) Write(file string, content []byte, author, msg string, drop ...string) error {
+	if err := writeFile(content, path.Join(directory, file)); err != nil {
+		return err
+	}
+	for _, dropped := range drop {
+		if err := os.Remove(path.Join(directory, dropped)); err != nil && !os.IsNotExist(err) {
+			log.Printf("Cant remove %q, error: %v", dropped, err)
+		}
+	}
+	invalidateCaches()
+	return nil
+}
+
+// Remove deletes a file.
+func (fsStore) Remove(file, author, msg string) error {
+	defer invalidateCaches()
+	return os.Remove(path.Join(directory, file))
+}
+
+// History is always empty.
+func (fsStore) History(file string, limit int) []*Log {
+	return nil
+}
+
+// Show reads the node revision.
+func (node *Node) Show() *Node {
+	defer node.span("Show")()
+	node.Bytes = store.Read(node.File, node.Revision)
+	return node
+}
+
+// History reads the node log.
+func (node *Node) History() *Node {
+	return node.history(currentSettings().LogLimit)
+}
+
+// history reads up to limit entries of the node log, defaulting the node
+// revision to the latest one.
+func (node *Node) history(limit int) *Node {
+	defer node.span("History")()
+	node.Log = make([]*Log, 0)
+	for _, logLine := range store.History(node.File, limit) {
+		logLine.Link = logLine.Hash != node.Revision
+		node.Log = append(node.Log, logLine)
+	}
+	if node.Revision == "" && len(node.Log) > 0 {
+		node.Revision = node.Log[0].Hash
+		node.Log[0].Link = false
+	}
+	return node
+}
+
+// Revert saves the node revision as the latest one.
+func (node *Node) Revert(author string) error {
+	bytes := store.Read(node.File, node.Revision)
+	if len(bytes) == 0 {
+		return fmt.Errorf("no revision %q of %q", node.Revision, node.File)
+	}
+	log.Printf("Reverts %v to revision %s", node.File, node.Revision)
+	return node.write(bytes, author, "Reverted to: "+node.Revision)
+}
+
+// write commits content as the node file, see Store.Write.
+func (node *Node) write(content []byte, author, msg string, drop ...string) error {
+	defer node.span("Write")()
+	return store.Write(node.File, content, author, msg, drop...)
+}
+
+// remove commits the removal of the node file.
+func (node *Node) remove(author, msg string) error {
+	defer node.span("Remove")()
+	return store.Remove(node.File, author, msg)
+}
@@ -0,0 +1,48 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// styleFileName is the stylesheet of a directory, applying to the pages below.
+const styleFileName = "_style.css"
+
+// pageStyles returns the URLs of the stylesheets of a page: -extra-css and
+// the style file of the nearest directory with one.
+func pageStyles(page string) []string {
+	var styles []string
+	if extraCSS != "" {
+		styles = append(styles, extraCSS)
+	}
+	for dir := path.Dir(page); ; dir = path.Dir(dir) {
+		if info, err := os.Stat(path.Join(directory, dir, styleFileName)); err == nil {
+			// The modification time makes clients fetch a changed file
+			url := strings.TrimSuffix(basepath, "/") + path.Join("/_style", dir, styleFileName)
+			styles = append(styles, fmt.Sprintf("%s?v=%d", url, info.ModTime().Unix()))
+			break
+		}
+		if dir == "." || dir == "/" {
+			break
+		}
+	}
+	return styles
+}
+
+// styleHandler serves the style files of the directories.
+func styleHandler(w http.ResponseWriter, r *http.Request) {
+	file := path.Clean(strings.TrimPrefix(r.URL.Path, "/_style"))
+	if path.Base(file) != styleFileName {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/css; charset=utf-8")
+	http.ServeFile(w, r, path.Join(directory, file))
+}
@@ -0,0 +1,97 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+// gitSubmodules returns the paths of the submodules of the wiki repository.
+func gitSubmodules() []string {
+	buf, err := gitRun(exec.Command("git", "ls-files", "--stage", "-z"))
+	if err != nil {
+		log.Printf("Error: could not list submodules: %v", err)
+		return nil
+	}
+	var submodules []string
+	for _, entry := range strings.Split(buf.String(), "\x00") {
+		// Submodules are staged as gitlinks: 160000 <commit> <stage>\t<path>
+		if fields := strings.SplitN(entry, "\t", 2); len(fields) == 2 && strings.HasPrefix(fields[0], "160000 ") {
+			submodules = append(submodules, fields[1])
+		}
+	}
+	return submodules
+}
+
+// submoduleOf returns the submodule a file belongs to, empty for the files of
+// the wiki repository itself.
+func submoduleOf(file string) string {
+	if _, ok := store.(gitStore); !ok {
+		return ""
+	}
+	found := ""
+	for _, submodule := range cachedSubmodules() {
+		if strings.HasPrefix(file, submodule+"/") && len(submodule) > len(found) {
+			found = submodule
+		}
+	}
+	return found
+}
+
+// submoduleCheckedOut reports whether a submodule has a repository to query,
+// which it lacks until git submodule update --init.
+func submoduleCheckedOut(submodule string) bool {
+	_, err := os.Stat(path.Join(directory, submodule, ".git"))
+	return err == nil
+}
+
+// gitPath returns the git options and the path to query a file with. The
+// files of a submodule are queried in the repository of the submodule, by
+// their path relative to it.
+func gitPath(file string) ([]string, string) {
+	submodule := submoduleOf(file)
+	if submodule == "" {
+		return nil, file
+	}
+	if !submoduleCheckedOut(submodule) {
+		log.Printf("Error: cant read %q, the submodule %q is not checked out, run: git submodule update --init", file, submodule)
+		return nil, file
+	}
+	return []string{"-C", submodule}, strings.TrimPrefix(file, submodule+"/")
+}
+
+// submoduleFiles adds the files of the checked out submodules to files, as
+// listed by gitFiles and relative to the data directory.
+func submoduleFiles(files map[string]bool) {
+	for _, submodule := range cachedSubmodules() {
+		if !submoduleCheckedOut(submodule) {
+			continue
+		}
+		buf, err := gitRun(exec.Command("git", "-C", submodule, "ls-files", "-z", "--cached", "--others", "--exclude-standard"))
+		if err != nil {
+			log.Printf("Error: could not list files of submodule %q: %v", submodule, err)
+			continue
+		}
+		for _, file := range strings.Split(buf.String(), "\x00") {
+			if file != "" {
+				files[submodule+"/"+file] = true
+			}
+		}
+	}
+}
+
+// errSubmodule rejects changes to the files of a submodule, which are made
+// and committed in the repository of the submodule instead.
+func errSubmodule(file string) error {
+	if submodule := submoduleOf(file); submodule != "" {
+		return fmt.Errorf("%q belongs to the submodule %q, change it there", file, submodule)
+	}
+	return nil
+}
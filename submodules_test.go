@@ -0,0 +1,80 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// withSubmodule adds a repository with a page committed twice as the
+// submodule lib of the test wiki.
+func withSubmodule(t *testing.T, dir string) {
+	t.Helper()
+	lib := t.TempDir()
+	git := func(dir string, args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "protocol.file.allow=always"}, args...)...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	git(lib, "init", "-q")
+	git(lib, "config", "user.name", "librarian")
+	git(lib, "config", "user.email", "librarian@example.com")
+	git(lib, "config", "commit.gpgsign", "false")
+	for _, msg := range []string{"Add the library page", "Update the library page"} {
+		writeTestFile(t, filepath.Join(lib, "page.md"), "# "+msg+"\n")
+		git(lib, "add", "page.md")
+		git(lib, "commit", "-q", "-m", msg)
+	}
+	git(dir, "submodule", "add", "-q", lib, "lib")
+	git(dir, "commit", "-q", "-m", "Add the submodule")
+	invalidateCaches()
+}
+
+func TestSubmodules(t *testing.T) {
+	dir := newTestWiki(t, map[string]string{"a.md": "# A\n"})
+	withSubmodule(t, dir)
+
+	if got := submoduleOf("lib/page.md"); got != "lib" {
+		t.Errorf("submoduleOf(lib/page.md) = %q, want lib", got)
+	}
+	if got := submoduleOf("a.md"); got != "" {
+		t.Errorf("submoduleOf(a.md) = %q, want none", got)
+	}
+	if pages, _ := listPages(""); !containsString(pages, "lib/page.md") {
+		t.Errorf("listPages = %q, without the page of the submodule", pages)
+	}
+	if got := string(store.Read("lib/page.md", "HEAD")); got != "# Update the library page\n" {
+		t.Errorf("Read(lib/page.md) = %q, want the submodule's latest revision", got)
+	}
+
+	var messages []string
+	for _, log := range store.History("lib/page.md", 10) {
+		messages = append(messages, log.Author+": "+log.Message)
+	}
+	if got := strings.Join(messages, ", "); got != "librarian: Update the library page, librarian: Add the library page" {
+		t.Errorf("History(lib/page.md) = %s, want the commits of the submodule", got)
+	}
+
+	err := store.Write("lib/page.md", []byte("# Changed\n"), "tester", "Update")
+	if err == nil || !strings.Contains(err.Error(), `submodule "lib"`) {
+		t.Errorf("Write(lib/page.md) = %v, want an error naming the submodule", err)
+	}
+	if err := store.Remove("lib/page.md", "tester", "Remove"); err == nil {
+		t.Error("Remove(lib/page.md) succeeded")
+	}
+	if w := postPage(t, nil, "/lib/page", "# Changed\n"); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), `submodule "lib"`) {
+		t.Errorf("saving a page of the submodule answered %d %q, want 403", w.Code, w.Body)
+	}
+	if status := gitStatus(t, filepath.Join(dir, "lib")); status != "" {
+		t.Errorf("the submodule changed:\n%s", status)
+	}
+}
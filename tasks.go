@@ -0,0 +1,145 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"bytes"
+	"strconv"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	east "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// taskCheckBoxes numbers the check boxes of task list items as data-task, so
+// that toggling them does not count other check boxes of the page.
+type taskCheckBoxes struct{}
+
+// Extend adds the task numbering and rendering to a markdown renderer.
+func (taskCheckBoxes) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(taskNumbers{}, 100)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(taskRenderer{}, 100)))
+}
+
+// taskNumbers numbers the task check boxes in the order they are rendered.
+type taskNumbers struct{}
+
+// Transform numbers the task check boxes of a page.
+func (taskNumbers) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	for i, box := range taskBoxes(doc) {
+		box.SetAttributeString("data-task", []byte(strconv.Itoa(i)))
+	}
+}
+
+// taskRenderer renders task check boxes like the default renderer, with their
+// number.
+type taskRenderer struct{}
+
+// RegisterFuncs registers the task check box renderer.
+func (r taskRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(east.KindTaskCheckBox, r.renderTaskCheckBox)
+}
+
+func (r taskRenderer) renderTaskCheckBox(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	_, _ = w.WriteString("<input ")
+	if node.(*east.TaskCheckBox).IsChecked {
+		_, _ = w.WriteString(`checked="" `)
+	}
+	_, _ = w.WriteString(`disabled="" type="checkbox"`)
+	if n, ok := node.AttributeString("data-task"); ok {
+		_, _ = w.WriteString(` data-task="`)
+		_, _ = w.Write(util.EscapeHTML(n.([]byte)))
+		_ = w.WriteByte('"')
+	}
+	_, _ = w.WriteString("> ")
+	return ast.WalkContinue, nil
+}
+
+// taskBoxes returns the task check boxes below node in the order they are
+// rendered.
+func taskBoxes(node ast.Node) []*east.TaskCheckBox {
+	var boxes []*east.TaskCheckBox
+	ast.Walk(node, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if box, ok := node.(*east.TaskCheckBox); ok && entering {
+			boxes = append(boxes, box)
+		}
+		return ast.WalkContinue, nil
+	})
+	return boxes
+}
+
+// sectionTask returns the number within the whole page of task n of a section
+// of a large page, see -section-bytes. Check boxes are numbered per section as
+// sections are rendered on their own.
+func (node *Node) sectionTask(section, n int) (int, bool) {
+	if section == 0 {
+		return n, true
+	}
+	_, source := parseFrontMatter(node.Bytes)
+	source = node.expandTokens(source)
+	if sectionBytes <= 0 || len(source) <= sectionBytes {
+		return 0, false
+	}
+	sections := splitSections(source)
+	if section < 0 || section >= len(sections) {
+		return 0, false
+	}
+	for _, s := range sections[:section] {
+		n += len(taskBoxes(md.Parser().Parse(text.NewReader(s))))
+	}
+	return n, true
+}
+
+// toggleTask flips the check mark of the n-th task list item of a markdown
+// page, counting the check boxes in the order they are rendered.
+func toggleTask(source []byte, n int) ([]byte, bool) {
+	_, body := parseFrontMatter(source)
+	offset := len(source) - len(body)
+
+	boxes := taskBoxes(md.Parser().Parse(text.NewReader(body)))
+	if n < 0 || n >= len(boxes) {
+		return source, false
+	}
+	mark := checkBoxMark(body, boxes[n])
+	if mark < 0 {
+		return source, false
+	}
+
+	toggled := append([]byte{}, source...)
+	if body[mark] == 'x' || body[mark] == 'X' {
+		toggled[offset+mark] = ' '
+	} else {
+		toggled[offset+mark] = 'x'
+	}
+	return toggled, true
+}
+
+// checkBoxMark returns the position of the check mark of a task check box in
+// source, -1 if it is not found. Check boxes do not keep their position, but
+// start with the first [ after the text before them, or the start of their
+// line.
+func checkBoxMark(source []byte, box ast.Node) int {
+	start := -1
+	if previous, ok := box.PreviousSibling().(*ast.Text); ok {
+		start = previous.Segment.Stop
+	} else if lines := box.Parent().Lines(); lines.Len() > 0 {
+		start = lines.At(0).Start
+	}
+	if start < 0 {
+		return -1
+	}
+	i := bytes.IndexByte(source[start:], '[')
+	if i < 0 || start+i+2 >= len(source) || source[start+i+2] != ']' {
+		return -1
+	}
+	return start + i + 1
+}
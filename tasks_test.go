@@ -0,0 +1,139 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// checkBoxes matches the rendered task check boxes.
+var checkBoxes = regexp.MustCompile(`<input (checked="" )?disabled="" type="checkbox" data-task="(\d+)">`)
+
+// renderedTasks returns whether each rendered task check box is checked.
+func renderedTasks(t *testing.T, source []byte) []bool {
+	t.Helper()
+	_, body := parseFrontMatter(source)
+	var buf bytes.Buffer
+	if err := md.Convert(body, &buf); err != nil {
+		t.Fatal(err)
+	}
+	var checked []bool
+	for i, m := range checkBoxes.FindAllStringSubmatch(buf.String(), -1) {
+		if m[2] != strconv.Itoa(i) {
+			t.Errorf("task %d is numbered %s", i, m[2])
+		}
+		checked = append(checked, m[1] != "")
+	}
+	return checked
+}
+
+func TestToggleTaskMatchesRendering(t *testing.T) {
+	pages := map[string]string{
+		"list":     "- [ ] one\n- [x] two\n* [X] three\n1. [ ] four\n",
+		"nested":   "- [ ] outer\n  - [x] inner\n- [ ] last\n",
+		"quoted":   "> - [ ] quoted\n\n- [ ] after\n",
+		"fenced":   "```\n- [ ] fenced\n```\n- [ ] real\n",
+		"indented": "Text\n\n    - [ ] indented code\n\n- [ ] real\n",
+		"html":     "<div>\n- [ ] html block\n</div>\n\n- [ ] real\n",
+		"front":    "---\ntitle: Tasks\n---\n- [ ] first\n- [x] second\n",
+		"text":     "not a task [ ] here\n\n- plain [ ] item\n- [ ] task [ ] with brackets\n",
+	}
+	for name, page := range pages {
+		source := []byte(page)
+		before := renderedTasks(t, source)
+		if len(before) == 0 {
+			t.Fatalf("%s: no rendered tasks", name)
+		}
+		for n := range before {
+			toggled, ok := toggleTask(source, n)
+			if !ok {
+				t.Errorf("%s: task %d not found", name, n)
+				continue
+			}
+			after := renderedTasks(t, toggled)
+			if len(after) != len(before) {
+				t.Errorf("%s: toggling task %d changed the tasks to %v", name, n, after)
+				continue
+			}
+			for i := range before {
+				if want := before[i] != (i == n); after[i] != want {
+					t.Errorf("%s: toggling task %d left task %d checked %v, want %v", name, n, i, after[i], want)
+				}
+			}
+		}
+		if _, ok := toggleTask(source, len(before)); ok {
+			t.Errorf("%s: toggled task %d, there are only %d", name, len(before), len(before))
+		}
+	}
+}
+
+func TestTaskNumbersSkipOtherCheckBoxes(t *testing.T) {
+	defer func(old *htmlPolicy) { inlineHTML = old; md = newMarkdown() }(inlineHTML)
+	inlineHTML = &htmlPolicy{Tags: map[string][]string{"input": {"type"}}}
+	md = newMarkdown()
+
+	source := "<input type=\"checkbox\"> not a task\n\n- [ ] one\n- [x] two <input type=\"checkbox\">\n"
+	got := render(t, source, 0)
+	if n := strings.Count(got, `<input type="checkbox">`); n != 2 {
+		t.Fatalf("rendered %d HTML check boxes, want 2: %s", n, got)
+	}
+	if got := renderedTasks(t, []byte(source)); len(got) != 2 || got[0] || !got[1] {
+		t.Errorf("rendered tasks %v, want [false true]", got)
+	}
+	toggled, ok := toggleTask([]byte(source), 0)
+	if want := strings.Replace(source, "[ ]", "[x]", 1); !ok || string(toggled) != want {
+		t.Errorf("toggleTask(%q, 0) = %q, want %q", source, toggled, want)
+	}
+}
+
+func TestToggleSectionTask(t *testing.T) {
+	page := "# One\n\n- [ ] a\n- [ ] b\n\n# Two\n\n- [ ] c\n"
+	dir := newTestWiki(t, map[string]string{"page.md": page})
+	defer func(tasks bool, bytes int) { editableTasks, sectionBytes = tasks, bytes }(editableTasks, sectionBytes)
+	editableTasks, sectionBytes = true, 1
+	defer func(old Settings) { settings = old }(settings)
+	settings.LogLimit = logLimit
+
+	// Sections number their tasks on their own
+	w := httptest.NewRecorder()
+	wikiHandler(w, httptest.NewRequest("GET", "/page?section=1", nil))
+	if body := w.Body.String(); !strings.Contains(body, `data-task="0"`) || strings.Contains(body, `data-task="1"`) {
+		t.Fatalf("section 1 renders %s, want a single task 0", body)
+	}
+
+	revision := func() string {
+		out, err := exec.Command("git", "-C", dir, "log", "-1", "--format=%h").Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	form := url.Values{"task": {"0"}, "section": {"1"}, "revision": {revision()}, "author": {"tester"}}
+	if w := postForm(t, nil, "/page", form); w.Code != 303 {
+		t.Fatalf("toggling task 0 of section 1 answered %d: %s", w.Code, w.Body)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "page.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Replace(page, "[ ] c", "[x] c", 1); string(got) != want {
+		t.Errorf("toggling task 0 of section 1 saved %q, want %q", got, want)
+	}
+
+	form.Set("section", "2")
+	form.Set("revision", revision())
+	if w := postForm(t, nil, "/page", form); w.Code != 400 {
+		t.Errorf("toggling a task of a missing section answered %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,61 @@
+{{ template "header" . }}
+<div class="row col content">
+	<h1>{{ T "admin.title" }}</h1>
+	<table class="table">
+		<tbody>
+			<tr><th>{{ T "admin.pages" }}</th><td>{{ .Stats.Pages }}</td></tr>
+			<tr><th>{{ T "admin.size" }}</th><td>{{ .Stats.Bytes }} {{ T "admin.bytes" }}</td></tr>
+			{{ if .Stats.Git }}
+			<tr><th>{{ T "admin.commits" }}</th><td>{{ .Stats.Commits }}</td></tr>
+			{{ end }}
+		</tbody>
+	</table>
+	{{ if not .Stats.Git }}
+	<p class="text-muted">{{ T "admin.nogit" }}</p>
+	{{ end }}
+
+	<h2>{{ T "admin.largest" }}</h2>
+	<table class="table">
+		<tbody>
+			{{ range $page := .Stats.Largest }}
+			<tr>
+				<td><a href="{{ $page.Page }}">{{ $page.File }}</a></td>
+				<td>{{ $page.Bytes }} {{ T "admin.bytes" }}</td>
+			</tr>
+			{{ end }}
+		</tbody>
+	</table>
+
+	{{ if .Stats.Git }}
+	<h2>{{ T "admin.authors" }}</h2>
+	<table class="table">
+		<thead>
+			<tr><th>{{ T "authors.author" }}</th><th>{{ T "authors.edits" }}</th></tr>
+		</thead>
+		<tbody>
+			{{ range $author := .Authors }}
+			<tr>
+				<td><a href="{{ $.Basepath }}/_recent?author={{ $author.Name }}">{{ $author.Name }}</a></td>
+				<td>{{ $author.Edits }}</td>
+			</tr>
+			{{ end }}
+		</tbody>
+	</table>
+
+	<h2>{{ T "admin.recent" }}</h2>
+	<div class="list-group">
+		{{ range $log := .Changes }}
+		{{ if $log.Page }}
+		<a href="{{ $log.Page }}?revision={{ $log.Hash }}&revisions=1" class="list-group-item">
+			<kbd class="hash">{{ $log.Hash }}</kbd> {{ $log.Message }} ({{ $log.Author }}, {{ $log.Time }})
+		</a>
+		{{ else }}
+		<div class="list-group-item">
+			<kbd class="hash">{{ $log.Hash }}</kbd> {{ $log.Message }} ({{ $log.Author }}, {{ $log.Time }})
+		</div>
+		{{ end }}
+		{{ end }}
+	</div>
+	{{ end }}
+</div>
+{{ template "footer" . }}
@@ -0,0 +1,18 @@
+{{ template "header" . }}
+<div class="row col content">
+	<h1>{{ T "authors.title" }}</h1>
+	<table class="table">
+		<thead>
+			<tr><th>{{ T "authors.author" }}</th><th>{{ T "authors.edits" }}</th></tr>
+		</thead>
+		<tbody>
+			{{ range $author := .Authors }}
+			<tr>
+				<td><a href="{{ $.Basepath }}/_recent?author={{ $author.Name }}">{{ $author.Name }}</a></td>
+				<td>{{ $author.Edits }}</td>
+			</tr>
+			{{ end }}
+		</tbody>
+	</table>
+</div>
+{{ template "footer" . }}
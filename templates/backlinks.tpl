@@ -0,0 +1,14 @@
+{{ template "header" . }}
+<div class="row col content">
+	<h1>{{ T "backlinks.title" .Path }}</h1>
+	{{ if .Backlinks }}
+	<ul>
+		{{ range $page := .Backlinks }}
+		<li><a href="{{ $page.Path }}">{{ $page.Name }}</a></li>
+		{{ end }}
+	</ul>
+	{{ else }}
+	<p class="text-muted">{{ T "backlinks.none" }}</p>
+	{{ end }}
+</div>
+{{ template "footer" . }}
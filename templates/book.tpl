@@ -0,0 +1,37 @@
+<!doctype html>
+<html lang="{{ .Lang }}">
+
+<head>
+	<meta charset="UTF-8">
+	<title>{{ .Title }} - {{ .Path }}</title>
+	<meta name="viewport" content="width=device-width, initial-scale=1">
+
+	<link href="{{ .Basepath }}{{ asset "css/hljs/zenburn.css" }}" rel="stylesheet">
+	<link href="{{ .Basepath }}{{ asset "css/bootstrap.min.css" }}" rel="stylesheet">
+	<link href="{{ .Basepath }}{{ asset "css/main.css" }}" rel="stylesheet">
+	<link href="{{ .Basepath }}{{ asset "css/print.css" }}" rel="stylesheet" media="print">
+	{{ with .PrintCSS }}<style>{{ . }}</style>{{ end }}
+</head>
+
+<body>
+	<div class="container">
+		{{ range $section := .Sections }}
+		<div class="row col content book-section">
+			{{ with $section.Title }}<h1 class="book-section-title">{{ . }}</h1>{{ end }}
+			{{ $section.Markdown }}
+		</div>
+		{{ end }}
+		{{ if .More }}
+		<div class="row col book-more">
+			{{ range $dir := .More }}
+			<a href="{{ $.Basepath }}/_book/{{ $dir }}" class="text-muted">{{ T "book.more" $dir }}</a><br>
+			{{ end }}
+		</div>
+		{{ end }}
+	</div>
+
+	<script src="{{ .Basepath }}{{ asset "js/highlight.pack.js" }}"></script>
+	<script>hljs.initHighlightingOnLoad();</script>
+</body>
+
+</html>
@@ -0,0 +1,46 @@
+{{ template "header" . }}
+{{ if .Since }}
+<div class="row col">
+	<h1>{{ T "changes.since" .Since }}</h1>
+	{{ if .PageChanges }}
+	<table class="table">
+		<tr><th>{{ T "changes.page" }}</th><th>{{ T "changes.change" }}</th><th>{{ T "changes.commits" }}</th></tr>
+		{{ range $change := .PageChanges }}
+		<tr>
+			<td>{{ if eq $change.Status "deleted" }}{{ $change.File }}{{ else }}<a href="{{ $change.Page }}">{{ $change.File }}</a>{{ end }}</td>
+			<td>{{ T (print "changes." $change.Status) }}</td>
+			<td>
+				{{ range $log := $change.Commits }}
+				<kbd class="hash">{{ $log.Hash }}</kbd> {{ $log.Message }} ({{ $log.Author }}, {{ $log.Time }})<br>
+				{{ end }}
+			</td>
+		</tr>
+		{{ end }}
+	</table>
+	{{ else }}
+	<p class="text-muted">{{ T "changes.none" }}</p>
+	{{ end }}
+</div>
+{{ else }}
+<div class="row col">
+	<h1>{{ if .ChangesBy }}{{ T "changes.by" .ChangesBy }}{{ else }}{{ T "changes.title" }}{{ end }}</h1>
+	{{ if .Changes }}
+	<div class="list-group">
+		{{ range $log := .Changes }}
+		{{ if $log.Page }}
+		<a href="{{ $log.Page }}?revision={{ $log.Hash }}&revisions=1" class="list-group-item">
+			<kbd class="hash">{{ $log.Hash }}</kbd> {{ $log.Message }} ({{ $log.Author }}, {{ $log.Time }})
+		</a>
+		{{ else }}
+		<div class="list-group-item">
+			<kbd class="hash">{{ $log.Hash }}</kbd> {{ $log.Message }} ({{ $log.Author }}, {{ $log.Time }})
+		</div>
+		{{ end }}
+		{{ end }}
+	</div>
+	{{ else }}
+	<p class="text-muted">{{ if .ChangesBy }}{{ T "changes.none.by" .ChangesBy }}{{ else }}{{ T "changes.none" }}{{ end }}</p>
+	{{ end }}
+</div>
+{{ end }}
+{{ template "footer" . }}
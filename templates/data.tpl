@@ -0,0 +1,53 @@
+{{ template "header" . }}
+<div class="row col content">
+	<p class="text-right">
+		<a href="?raw=1{{ if .Revision }}&revision={{ .Revision }}{{ end }}" class="text-muted"><span class="glyphicon glyphicon-download-alt"></span> {{ T "data.raw" }}</a>
+	</p>
+	{{ if .DataHeader }}
+	<div class="table-container">
+	<table class="table table-striped data-table">
+		<thead>
+			<tr>{{ range $field := .DataHeader }}<th>{{ $field }}</th>{{ end }}</tr>
+		</thead>
+		<tbody>
+			{{ range $row := .DataRows }}
+			<tr>{{ range $field := $row }}<td>{{ $field }}</td>{{ end }}</tr>
+			{{ end }}
+		</tbody>
+	</table>
+	</div>
+	{{ else }}
+	<p class="text-muted">{{ T "data.empty" }}</p>
+	{{ end }}
+</div>
+<script>
+(function () {
+	// Sort by a column when clicking its header, numbers by their value
+	var table = document.querySelector('.data-table');
+	if (!table) {
+		return;
+	}
+	table.querySelectorAll('th').forEach(function (th, column) {
+		th.style.cursor = 'pointer';
+		th.addEventListener('click', function () {
+			var ascending = th.dataset.sort !== 'asc';
+			table.querySelectorAll('th').forEach(function (other) {
+				delete other.dataset.sort;
+			});
+			th.dataset.sort = ascending ? 'asc' : 'desc';
+			var body = table.tBodies[0];
+			var rows = Array.prototype.slice.call(body.rows);
+			rows.sort(function (a, b) {
+				var x = a.cells[column] ? a.cells[column].textContent : '';
+				var y = b.cells[column] ? b.cells[column].textContent : '';
+				var order = x !== '' && y !== '' && !isNaN(x) && !isNaN(y) ? x - y : x.localeCompare(y);
+				return ascending ? order : -order;
+			});
+			rows.forEach(function (row) {
+				body.appendChild(row);
+			});
+		});
+	});
+})();
+</script>
+{{ template "footer" . }}
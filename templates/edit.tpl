@@ -1,22 +1,153 @@
 {{ template "header" . }}
+{{ if .Draft }}
 <div class="row col">
-	<form method="POST" action="?">
+	<form method="POST" action="?" class="alert alert-info">
+		{{ T "draft.notice" }}
+		<input type="hidden" name="author" value="{{ .Author }}" />
+		{{ if .CSRF }}<input type="hidden" name="csrf" value="{{ .CSRF }}" />{{ end }}
+		<button type="submit" name="publish" value="1" class="btn btn-primary btn-xs">
+			<span class="glyphicon glyphicon-send"></span> {{ T "draft.publish" }}
+		</button>
+	</form>
+</div>
+{{ end }}
+{{ if .LockRefresh }}
+<div class="row col">
+	<div class="alert alert-warning edit-lock"{{ if not .LockedBy }} hidden{{ end }}>{{ if .LockedBy }}{{ T "edit.locked" .LockedBy .LockedSince }}{{ end }}</div>
+</div>
+{{ end }}
+<div class="row col">
+	<form method="POST" action="?" class="edit-form">
+		<input type="hidden" name="lock" value="{{ .LockToken }}" />
+		{{ if .CSRF }}<input type="hidden" name="csrf" value="{{ .CSRF }}" />{{ end }}
 		<div class="form-group col">
-			<textarea type="text" class="form-control editbox" spellcheck="false" rows="15" placeholder="Insert markdown here" name="content">{{ .Content }}</textarea>
+			<textarea type="text" class="form-control editbox" spellcheck="false" rows="15" placeholder="{{ T "edit.placeholder" }}" name="content">{{ .Content }}</textarea>
+			<p class="help-block text-right editor-status">
+				<span class="editor-position"></span> &middot;
+				<span class="editor-size">{{ .Size }}</span>{{ if .MaxBytes }} / {{ .MaxBytes }}{{ end }} {{ T "edit.bytes" }}
+			</p>
+			<ul class="help-block text-warning editor-issues"></ul>
+		</div>
+		<div class="form-group col">
+			<input type="text" class="form-control" name="coauthors" placeholder="{{ T "edit.coauthors" }}" />
 		</div>
 		<div class="form-inline col">
-			<div class="form-group col-md-8">
-				<input type="text" class="form-control changelog" name="msg" placeholder="Changelog" value="{{ .Changelog }}" />
+			<div class="form-group col-md-6">
+				<input type="text" class="form-control changelog" name="msg" placeholder="{{ T "edit.changelog" }}" value="{{ .Changelog }}" />
 			</div>
 			<div class="form-group col-md-2">
-				<input type="text" class="form-control" name="author" placeholder="Author" value="{{ .Author }}" />
+				<input type="text" class="form-control" name="author" placeholder="{{ T "edit.author" }}" value="{{ .Author }}"{{ if not .Author }} required{{ end }} />
 			</div>
-			<div class="form-group col-md-2">
+			<div class="form-group col-md-4">
 				<button type="submit" class="btn btn-default">
-					<span class="glyphicon glyphicon-floppy-disk"></span> Save
+					<span class="glyphicon glyphicon-floppy-disk"></span> {{ T "edit.save" }}
+				</button>
+				<button type="submit" name="draft" value="1" class="btn btn-default">
+					<span class="glyphicon glyphicon-file"></span> {{ T "edit.draft" }}
 				</button>
 			</div>
 		</div>
 	</form>
 </div>
+<script>
+(function () {
+	var editor = document.querySelector('.editbox');
+	var position = document.querySelector('.editor-position');
+	var size = document.querySelector('.editor-size');
+	var maxBytes = {{ .MaxBytes }};
+	var indent = '    ';
+	var positionFormat = {{ T "edit.position" }};
+
+	function insert(text) {
+		var start = editor.selectionStart;
+		editor.value = editor.value.slice(0, start) + text + editor.value.slice(editor.selectionEnd);
+		editor.selectionStart = editor.selectionEnd = start + text.length;
+		update();
+	}
+
+	function update() {
+		var bytes = new TextEncoder().encode(editor.value).length;
+		var lines = editor.value.slice(0, editor.selectionStart).split('\n');
+		position.textContent = positionFormat.replace('{line}', lines.length).replace('{column}', lines[lines.length - 1].length + 1);
+		size.textContent = bytes;
+		size.parentNode.classList.toggle('text-danger', maxBytes > 0 && bytes > maxBytes);
+	}
+
+	editor.addEventListener('keydown', function (event) {
+		if (event.key === 'Tab' && !event.shiftKey && !event.ctrlKey && !event.altKey) {
+			event.preventDefault();
+			insert(indent);
+		} else if (event.key === 'Enter' && !event.shiftKey) {
+			// Continue with the indentation of the current line
+			var before = editor.value.slice(0, editor.selectionStart);
+			var line = before.slice(before.lastIndexOf('\n') + 1);
+			var current = line.match(/^[ \t]*/)[0];
+			if (current) {
+				event.preventDefault();
+				insert('\n' + current);
+			}
+		}
+	});
+	['input', 'keyup', 'click'].forEach(function (type) {
+		editor.addEventListener(type, update);
+	});
+	update();
+
+	// Check the page while typing, once the author pauses
+	var issues = document.querySelector('.editor-issues');
+	var timer;
+	function validate() {
+		var body = new URLSearchParams({content: editor.value, page: {{ .Path }}});
+		fetch({{ .Basepath }} + '/_validate', {method: 'POST', body: body}).then(function (response) {
+			return response.json();
+		}).then(function (result) {
+			issues.innerHTML = '';
+			result.issues.forEach(function (issue) {
+				var item = document.createElement('li');
+				item.textContent = {{ T "edit.line" }}.replace('{line}', issue.line) + ': ' + issue.message;
+				issues.appendChild(item);
+			});
+		});
+	}
+	editor.addEventListener('input', function () {
+		clearTimeout(timer);
+		timer = setTimeout(validate, 1000);
+	});
+	validate();
+{{ if .LockRefresh }}
+
+	// Keep the advisory edit lock while the editor is open, or warn of the
+	// editor holding it
+	var form = document.querySelector('.edit-form');
+	var warning = document.querySelector('.edit-lock');
+	var lockFormat = {{ T "edit.locked" "{author}" "{minutes}" }};
+	function lock(release) {
+		var body = new URLSearchParams({page: {{ .Path }}, token: form.lock.value});
+		{{ if .CSRF }}body.set('csrf', {{ .CSRF }});{{ end }}
+		if (release) {
+			body.set('release', '1');
+			navigator.sendBeacon({{ .Basepath }} + '/_lock', body);
+			return;
+		}
+		fetch({{ .Basepath }} + '/_lock', {method: 'POST', body: body}).then(function (response) {
+			return response.json();
+		}).then(function (result) {
+			form.lock.value = result.token || '';
+			warning.hidden = !result.editor;
+			warning.textContent = lockFormat.replace('{author}', result.editor).replace('{minutes}', result.minutes);
+		});
+	}
+	setInterval(lock, {{ .LockRefresh }});
+	var saving = false;
+	form.addEventListener('submit', function () {
+		saving = true;
+	});
+	window.addEventListener('pagehide', function () {
+		if (!saving && form.lock.value) {
+			lock(true);
+		}
+	});
+{{ end }}
+})();
+</script>
 {{ template "footer" . }}
@@ -0,0 +1,13 @@
+{{ template "header" . }}
+<div class="row col content">
+	{{ if .Markdown }}
+	{{ .Markdown }}
+	{{ else }}
+	<h1>{{ T "error.title" .Status }}</h1>
+	<p>{{ .Message }}</p>
+	{{ end }}
+	{{ if .RequestID }}
+	<p class="text-muted">{{ T "error.id" .RequestID }}</p>
+	{{ end }}
+</div>
+{{ template "footer" . }}
@@ -1,18 +1,152 @@
 {{define "footer"}}
 <div class="row col">
+	{{ if .Recent }}
+	<p class="text-muted recent">
+		{{ T "recent" }}:
+		{{ range $i, $page := .Recent }}{{ if $i }} &middot; {{ end }}<a class="text-muted" href="{{ $.Basepath }}{{ $page.Path }}">{{ $page.Name }}</a>{{ end }}
+	</p>
+	{{ end }}
 	<hr class="text-muted" />
 
 	<p class="text-center text-muted footer">
-		<a class="text-muted" target="_blank" href="https://github.com/adam-p/markdown-here/wiki/Markdown-Cheatsheet">Markdown Cheatsheet</a> |
-		<a class="text-muted" target="_blank" href="https://github.com/jpxd/go-pages">Source on Github</a>
+		<a class="text-muted" target="_blank" href="https://github.com/adam-p/markdown-here/wiki/Markdown-Cheatsheet">{{ T "footer.cheatsheet" }}</a> |
+		<a class="text-muted" target="_blank" href="https://github.com/jpxd/go-pages">{{ T "footer.source" }}</a> |
+		<a class="text-muted" href="{{ .Basepath }}/_search">{{ T "search" }}</a> |
+		{{ if not .System }}
+		<a class="text-muted" href="{{ .Basepath }}/_backlinks{{ .Path }}">{{ T "backlinks" }}</a> |
+		{{ end }}
+		{{ if eq .Theme "dark" }}
+		<a class="text-muted" href="{{ themeURL .RawQuery "light" }}">{{ T "theme.light" }}</a>
+		{{ else }}
+		<a class="text-muted" href="{{ themeURL .RawQuery "dark" }}">{{ T "theme.dark" }}</a>
+		{{ end }}
 	</p>
+	{{ .ExtraFooter }}
 </div>
 <!-- end container -->
 </div>
 
 <link href='//fonts.googleapis.com/css?family=PT+Sans:400,400italic,700' rel='stylesheet' type='text/css'>
-<script src="/static/js/highlight.pack.js"></script>
+<script src="{{ .Basepath }}{{ asset "js/highlight.pack.js" }}"></script>
 <script>hljs.initHighlightingOnLoad();</script>
+<script>
+document.querySelectorAll('.content .anchor').forEach(function (anchor) {
+	anchor.addEventListener('click', function () {
+		if (navigator.clipboard) {
+			navigator.clipboard.writeText(anchor.href);
+		}
+	});
+});
+</script>
+{{ if .Shortcuts }}
+<script>
+(function () {
+	var shortcuts = {{ .Shortcuts }};
+	var urls = {{ .ShortcutURLs }};
+	document.addEventListener('keydown', function (event) {
+		var target = event.target;
+		if (event.ctrlKey || event.metaKey || event.altKey || target.isContentEditable ||
+			/^(INPUT|TEXTAREA|SELECT)$/.test(target.tagName)) {
+			return;
+		}
+		var action = shortcuts[event.key];
+		if (action === 'search') {
+			var search = document.querySelector('input[type=search]');
+			if (search) {
+				event.preventDefault();
+				search.focus();
+			}
+		} else if (action && urls[action]) {
+			event.preventDefault();
+			window.location = urls[action];
+		}
+	});
+})();
+</script>
+{{ end }}
+{{ if .CodeCopy }}
+<script>
+document.querySelectorAll('.content .code-copy').forEach(function (button) {
+	button.addEventListener('click', function () {
+		navigator.clipboard.writeText(button.parentNode.dataset.code).then(function () {
+			button.textContent = {{ T "code.copied" }};
+			setTimeout(function () {
+				button.textContent = {{ T "code.copy" }};
+			}, 2000);
+		});
+	});
+});
+</script>
+{{ end }}
+{{ if .LazySections }}
+<script>
+(function () {
+	function load(section) {
+		var params = new URLSearchParams(location.search);
+		params.set('section', section.dataset.section);
+		fetch('?' + params).then(function (response) {
+			return response.ok ? response.text() : Promise.reject(response.status);
+		}).then(function (html) {
+			section.innerHTML = html;
+			if (window.enableTasks) {
+				enableTasks(section);
+			}
+			section.querySelectorAll('pre code').forEach(function (block) {
+				hljs.highlightBlock(block);
+			});
+			if (window.MathJax && MathJax.typesetPromise) {
+				MathJax.typesetPromise([section]);
+			}
+		}, function () {
+			section.innerHTML = '';
+		});
+	}
+	var sections = Array.prototype.slice.call(document.querySelectorAll('.lazy-section'));
+	if (!('IntersectionObserver' in window)) {
+		sections.forEach(load);
+		return;
+	}
+	var observer = new IntersectionObserver(function (entries) {
+		entries.forEach(function (entry) {
+			if (entry.isIntersecting) {
+				observer.unobserve(entry.target);
+				load(entry.target);
+			}
+		});
+	}, {rootMargin: '1000px'});
+	sections.forEach(function (section) {
+		observer.observe(section);
+	});
+})();
+</script>
+{{ end }}
+{{ if .EditableTasks }}
+<script>
+// Task check boxes are numbered per section of a large page
+function enableTasks(root) {
+	root.querySelectorAll('input[data-task]').forEach(function (box) {
+		var section = box.closest('.lazy-section');
+		box.disabled = false;
+		box.addEventListener('change', function () {
+			var body = new URLSearchParams({
+				task: box.dataset.task,
+				section: section ? section.dataset.section : 0,
+				revision: {{ .Revision }},
+				csrf: {{ .CSRF }}
+			});
+			fetch('?', {method: 'POST', body: body}).then(function (response) {
+				if (!response.ok) {
+					return response.text().then(alert);
+				}
+			}).then(function () {
+				location.reload();
+			});
+		});
+	});
+}
+document.querySelectorAll('.content').forEach(enableTasks);
+</script>
+{{ end }}
 
 </body>
 
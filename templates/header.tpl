@@ -1,14 +1,30 @@
 {{define "header"}}
 <!doctype html>
+<html lang="{{ .Lang }}"{{ if .Theme }} data-theme="{{ .Theme }}"{{ end }}>
 
 <head>
 	<meta charset="UTF-8">
 	<title>{{.Title}}</title>
+	{{ if .Description }}
+	<meta name="description" content="{{ .Description }}">
+	<meta property="og:description" content="{{ .Description }}">
+	{{ end }}
 	<meta name="viewport" content="width=device-width, initial-scale=1">
+	{{ if .NoIndex }}
+	<meta name="robots" content="noindex">
+	{{ end }}
+	<link rel="icon" href="{{ .Basepath }}/favicon.ico">
+	<link rel="apple-touch-icon" href="{{ .Basepath }}/apple-touch-icon.png">
 
-	<link href="{{ .Basepath }}/static/css/hljs/zenburn.css" rel="stylesheet">
-	<link href="{{ .Basepath }}/static/css/bootstrap.min.css" rel="stylesheet">
-	<link href="{{ .Basepath }}/static/css/main.css" rel="stylesheet">
+	<link href="{{ .Basepath }}{{ asset "css/hljs/zenburn.css" }}" rel="stylesheet">
+	<link href="{{ .Basepath }}{{ asset "css/bootstrap.min.css" }}" rel="stylesheet">
+	<link href="{{ .Basepath }}{{ asset "css/main.css" }}" rel="stylesheet">
+	{{ if eq .Theme "dark" }}
+	<link href="{{ .Basepath }}{{ asset "css/dark.css" }}" rel="stylesheet">
+	{{ else if not .Theme }}
+	<link href="{{ .Basepath }}{{ asset "css/dark.css" }}" rel="stylesheet" media="(prefers-color-scheme: dark)">
+	{{ end }}
+	<link href="{{ .Basepath }}{{ asset "css/print.css" }}" rel="stylesheet" media="print">
 
  	<script src="https://polyfill.io/v3/polyfill.min.js?features=es6"></script>
  	<script id="MathJax-script" async src="https://cdn.jsdelivr.net/npm/mathjax@3/es5/tex-mml-chtml.js"></script>
@@ -19,7 +35,10 @@
    	 }
  	}; 
  	</script>
-
+	{{ range $style := .Styles }}
+	<link href="{{ $style }}" rel="stylesheet">
+	{{ end }}
+	{{ .ExtraHead }}
 </head>
 
 <body>
@@ -34,19 +53,29 @@
 				{{ end }}
 				{{ end }}
 				<li class="no-before">{{ if .Revision}}<a href="?revision={{.Revision}}&revisions=1" class="text-muted">{{.Revision}}</a>{{end}}</li>
+				{{ if or .EditURL (not (or .ReadOnly .System)) }}
 				<li class="edit-right">
-				
+				{{ if .EditURL }}
+				<a href="{{ .EditURL }}" class="text-muted"><span class="glyphicon glyphicon-pencil"></span> {{ T "edit.github" }}</a>&nbsp;
+				{{ end }}
+				{{ if not (or .ReadOnly .System) }}
+
 				{{ if .Edit | and .AskDelete }}
-				<a href="?delete=1" class="text-muted"><span class="glyphicon glyphicon-trash"></span> Are you sure?</a>&nbsp;
+				<form method="POST" action="?" class="inline-form">
+					{{ if .CSRF }}<input type="hidden" name="csrf" value="{{ .CSRF }}" />{{ end }}
+					<button type="submit" name="delete" value="1" class="btn btn-link text-muted"><span class="glyphicon glyphicon-trash"></span> {{ T "delete.confirm" }}</button>
+				</form>&nbsp;
 				{{ else if .Edit }}
-				<a href="?edit=1&askdelete=1" class="text-muted"><span class="glyphicon glyphicon-trash"></span> Delete</a>&nbsp;
+				<a href="?edit=1&askdelete=1" class="text-muted"><span class="glyphicon glyphicon-trash"></span> {{ T "delete" }}</a>&nbsp;
 				{{ end }}
 				{{ if .Edit | or .Revisions }}
-					<a href="?" class="text-muted"><span class="glyphicon glyphicon-remove"></span> Close</a>
+					<a href="?" class="text-muted"><span class="glyphicon glyphicon-remove"></span> {{ T "close" }}</a>
 				{{ else }}
-					<a href="?edit=1" class="text-muted"><span class="glyphicon glyphicon-edit"></span> Edit</a>
+					<a href="?edit=1" class="text-muted"><span class="glyphicon glyphicon-edit"></span> {{ T "edit" }}</a>
+				{{ end }}
 				{{ end }}
 				</li>
+				{{ end }}
 			</ol>
 
 		</div>
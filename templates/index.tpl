@@ -0,0 +1,24 @@
+{{ template "header" . }}
+<div class="row col content">
+	<h1>{{ T "index.title" .Path }}</h1>
+	{{ if or .Subdirs .Pages }}
+	<ul class="list-unstyled index-listing">
+		{{ range $dir := .Subdirs }}
+		<li><span class="glyphicon glyphicon-folder-open text-muted"></span> <a href="{{ $dir.Path }}">{{ $dir.Name }}/</a></li>
+		{{ end }}
+		{{ range $page := .Pages }}
+		<li>
+			<a href="{{ $page.Path }}">{{ or $page.Heading $page.Name }}</a>
+			{{ if $page.Heading }}<small class="text-muted">{{ $page.Name }}</small>{{ end }}
+			{{ with $page.Summary }}<p class="text-muted index-summary">{{ . }}</p>{{ end }}
+		</li>
+		{{ end }}
+	</ul>
+	{{ else }}
+	<p class="text-muted">{{ T "index.empty" }}</p>
+	{{ end }}
+	{{ if not .ReadOnly }}
+	<p><a href="?edit=1" class="text-muted"><span class="glyphicon glyphicon-edit"></span> {{ T "index.create" }}</a></p>
+	{{ end }}
+</div>
+{{ template "footer" . }}
@@ -0,0 +1,6 @@
+{{ template "header" . }}
+<div class="row col content">
+	<h1>{{ T "maintenance.title" }}</h1>
+	<p>{{ T "maintenance.text" .Title }}</p>
+</div>
+{{ template "footer" . }}
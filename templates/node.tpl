@@ -1,5 +1,21 @@
 {{define "node"}}
 <div class="row col content">
 	{{ .Markdown }}
+	{{ range $section := .LazySections }}
+	<div class="lazy-section" data-section="{{ $section }}"><p class="text-muted">{{ T "section.loading" }}</p></div>
+	{{ end }}
 </div>
+{{ if .InlineHistory }}
+<div class="row col">
+	<details class="inline-history">
+		<summary class="text-muted">{{ T "history.inline" (len .InlineHistory) }}</summary>
+		<ul class="list-unstyled">
+			{{ range $log := .InlineHistory }}
+			<li><a href="?revision={{ $log.Hash }}&revisions=1"><kbd class="hash">{{ $log.Hash }}</kbd></a> {{ $log.Message }} <span class="text-muted">({{ $log.Author }}, {{ $log.Time }})</span></li>
+			{{ end }}
+		</ul>
+		<a href="?revisions=1" class="text-muted">{{ T "history.all" }}</a>
+	</details>
+</div>
+{{ end }}
 {{end}}
@@ -0,0 +1,12 @@
+{{ template "header" . }}
+<div class="row col content">
+	<h1>{{ T "prune.title" }}</h1>
+	<p class="text-muted">{{ T "prune.warning" }}</p>
+	<form method="POST" action="?" class="form-inline">
+		<input type="hidden" name="csrf" value="{{ .CSRF }}" />
+		<label for="keep">{{ T "prune.keep" }}</label>
+		<input type="number" class="form-control" id="keep" name="keep" min="1" value="{{ if .PruneKeep }}{{ .PruneKeep }}{{ end }}" />
+		<button type="submit" class="btn btn-danger">{{ T "prune.submit" }}</button>
+	</form>
+</div>
+{{ template "footer" . }}
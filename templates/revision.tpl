@@ -1,13 +1,29 @@
 {{ define "revision" }}
 <!-- Actions for a specific revision (revert, diff etc) -->
+{{ if not .ReadOnly }}
 <div class="row col">
-	<form method="POST">
-		<div class="form-group">
+	<div class="form-group">
+		<a href="?revert-preview={{ .Revision }}" class="btn btn-danger btn-xs">
+			<span class="glyphicon glyphicon-step-backward"></span> {{ T "revert" }}
+		</a>
+	</div>
+</div>
+{{ end }}
+{{end}}
+
+{{ define "revertpreview" }}
+<!-- Confirmation of a revert, showing the reverted page below -->
+<div class="row col">
+	<div class="alert alert-warning">
+		<form method="POST" action="?" class="inline-form">
+			{{ T "revert.preview" .Revision }}
+			<input type="hidden" name="revert" value="{{ .Revision }}" />
+			{{ if .CSRF }}<input type="hidden" name="csrf" value="{{ .CSRF }}" />{{ end }}
 			<button type="submit" class="btn btn-danger btn-xs">
-				<span class="glyphicon glyphicon-step-backward"></span> Revert to this version
+				<span class="glyphicon glyphicon-step-backward"></span> {{ T "revert.confirm" }}
 			</button>
-			<input type="hidden" name="revert" value="{{ .Revision }}" />
-		</div>
-	</form>
+			<a href="?revision={{ .Revision }}&revisions=1" class="btn btn-default btn-xs">{{ T "cancel" }}</a>
+		</form>
+	</div>
 </div>
 {{end}}
@@ -0,0 +1,25 @@
+{{ template "header" . }}
+<div class="row col content">
+	<h1>{{ T "search.title" }}</h1>
+	<form method="GET" action="{{ .Basepath }}/_search" class="form-inline search-form">
+		<input type="search" name="q" value="{{ .Query }}" class="form-control" placeholder="{{ T "search.placeholder" }}" autofocus>
+		<button type="submit" class="btn btn-default">{{ T "search" }}</button>
+	</form>
+	{{ if .Pages }}
+	<ul class="list-unstyled index-listing">
+		{{ range $page := .Pages }}
+		<li>
+			<a href="{{ $page.Path }}">{{ or $page.Heading $page.Name }}</a>
+			{{ if $page.Heading }}<small class="text-muted">{{ $page.Name }}</small>{{ end }}
+			{{ with $page.Summary }}<p class="text-muted index-summary">{{ . }}</p>{{ end }}
+		</li>
+		{{ end }}
+	</ul>
+	{{ else if and .Query (not .Truncated) }}
+	<p class="text-muted">{{ T "search.none" }}</p>
+	{{ end }}
+	{{ if .Truncated }}
+	<p class="text-muted">{{ T "search.truncated" }}</p>
+	{{ end }}
+</div>
+{{ template "footer" . }}
@@ -0,0 +1,28 @@
+{{ template "header" . }}
+<div class="row col">
+	<form method="POST" action="?">
+		<input type="hidden" name="csrf" value="{{ .CSRF }}" />
+		<div class="form-group">
+			<label for="title">{{ T "settings.title" }}</label>
+			<input type="text" class="form-control" id="title" name="title" value="{{ .Settings.Title }}" />
+		</div>
+		<div class="form-group">
+			<label for="loglimit">{{ T "settings.loglimit" }}</label>
+			<input type="number" class="form-control" id="loglimit" name="loglimit" min="1" value="{{ .Settings.LogLimit }}" />
+		</div>
+		<div class="checkbox">
+			<label>
+				<input type="checkbox" name="readonly" value="1" {{ if .Settings.ReadOnly }}checked{{ end }} /> {{ T "settings.readonly" }}
+			</label>
+		</div>
+		<div class="checkbox">
+			<label>
+				<input type="checkbox" name="maintenance" value="1" {{ if .Settings.Maintenance }}checked{{ end }} /> {{ T "settings.maintenance" }}
+			</label>
+		</div>
+		<button type="submit" class="btn btn-default">
+			<span class="glyphicon glyphicon-floppy-disk"></span> {{ T "edit.save" }}
+		</button>
+	</form>
+</div>
+{{ template "footer" . }}
@@ -0,0 +1,13 @@
+{{ template "header" . }}
+<div class="row col content">
+	<h1>{{ T "slugs.title" }}</h1>
+	<ul>
+		{{ range $page := .Pages }}
+		<li><a href="{{ $page.Path }}">{{ $page.Name }}</a></li>
+		{{ end }}
+	</ul>
+	{{ if not .ReadOnly }}
+	<p><a href="?edit=1" class="text-muted"><span class="glyphicon glyphicon-edit"></span> {{ T "slugs.create" .Path }}</a></p>
+	{{ end }}
+</div>
+{{ template "footer" . }}
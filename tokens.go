@@ -0,0 +1,94 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"time"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// pageToken matches a token in page content, such as {{now}}.
+var pageToken = regexp.MustCompile(`\{\{\s*([a-z]+(?::[a-z]+)?)\s*\}\}`)
+
+// pageTokens render the tokens allowed in page content when the page is
+// viewed, other tokens are left as they are.
+var pageTokens = map[string]func(node *Node) string{
+	// The current date
+	"now": func(node *Node) string {
+		return time.Now().In(localZone()).Format("2006-01-02")
+	},
+	// When the shown revision was made, like in the page history
+	"date:relative": func(node *Node) string {
+		for _, entry := range node.Log {
+			if entry.Hash == node.Revision {
+				return entry.Time
+			}
+		}
+		if len(node.Log) > 0 {
+			return node.Log[0].Time
+		}
+		return ""
+	},
+}
+
+// expandTokens replaces the pageTokens of markdown source, except in code
+// blocks and code spans.
+func (node *Node) expandTokens(source []byte) []byte {
+	if !bytes.Contains(source, []byte("{{")) {
+		return source
+	}
+	var code [][2]int
+	doc := md.Parser().Parse(text.NewReader(source), parser.WithContext(newParserContext(0)))
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.CodeBlock, *ast.FencedCodeBlock:
+			lines := n.Lines()
+			if lines.Len() > 0 {
+				code = append(code, [2]int{lines.At(0).Start, lines.At(lines.Len() - 1).Stop})
+			}
+			return ast.WalkSkipChildren, nil
+		case *ast.CodeSpan:
+			for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+				if t, ok := c.(*ast.Text); ok {
+					code = append(code, [2]int{t.Segment.Start, t.Segment.Stop})
+				}
+			}
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+
+	var buf bytes.Buffer
+	last := 0
+	for _, m := range pageToken.FindAllSubmatchIndex(source, -1) {
+		render, ok := pageTokens[string(source[m[2]:m[3]])]
+		if !ok || inRanges(code, m[0]) {
+			continue
+		}
+		buf.Write(source[last:m[0]])
+		buf.WriteString(render(node))
+		last = m[1]
+	}
+	buf.Write(source[last:])
+	return buf.Bytes()
+}
+
+// inRanges reports whether offset is within any of the ranges.
+func inRanges(ranges [][2]int, offset int) bool {
+	for _, r := range ranges {
+		if offset >= r[0] && offset < r[1] {
+			return true
+		}
+	}
+	return false
+}
@@ -1,9 +1,47 @@
 package main
 
-import "strconv"
+import (
+	"strconv"
+	"strings"
+)
 
 // parseBool parses a string to a bool.
 func parseBool(value string) bool {
 	boolValue, err := strconv.ParseBool(value)
 	return err == nil && boolValue
 }
+
+// parseList splits a comma separated string, dropping empty entries.
+func parseList(value string) []string {
+	var list []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
+
+// parseExtensions parses a comma separated extension list, making sure
+// every extension starts with a dot.
+func parseExtensions(value string) []string {
+	list := parseList(value)
+	for i, ext := range list {
+		if !strings.HasPrefix(ext, ".") {
+			list[i] = "." + ext
+		}
+	}
+	return list
+}
+
+// stringList is a flag which can be given multiple times.
+type stringList []string
+
+func (list *stringList) String() string {
+	return strings.Join(*list, ", ")
+}
+
+func (list *stringList) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
@@ -0,0 +1,94 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the spans of the wiki, which are dropped without -tracing.
+var tracer = otel.Tracer("github.com/rain-1/go-pages")
+
+// startTracing exports the spans to the OTLP/HTTP traces endpoint of the
+// standard OTEL_EXPORTER_OTLP_* environment variables, in batches. Returns
+// the function exporting the spans still queued on shutdown.
+func startTracing() (func(context.Context) error, error) {
+	ctx := context.Background()
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES take precedence
+	attributes := []attribute.KeyValue{attribute.String("service.name", "go-pages")}
+	if host := os.Getenv(tenantHostEnv); host != "" {
+		attributes = append(attributes, attribute.String("wiki.host", host))
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attributes...),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK())
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	log.Printf("Exporting traces with OTLP/HTTP")
+	return provider.Shutdown, nil
+}
+
+// span starts a span of the node's request, with the page and revision, and
+// returns the function ending it.
+func (node *Node) span(name string) func() {
+	if node.ctx == nil {
+		return func() {}
+	}
+	_, s := tracer.Start(node.ctx, name, trace.WithAttributes(
+		attribute.String("page.path", node.Path),
+		attribute.String("page.revision", node.Revision)))
+	return func() { s.End() }
+}
+
+// randomHex returns n random bytes in hex.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// withTracing traces every request as a server span, continuing the trace of
+// a W3C traceparent header.
+func withTracing(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, s := tracer.Start(ctx, r.Method+" "+r.URL.Path,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.method", r.Method),
+				attribute.String("http.target", r.URL.RequestURI()),
+				attribute.String("request.id", requestID(r))))
+		defer s.End()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		handler.ServeHTTP(sw, r.WithContext(ctx))
+		s.SetAttributes(attribute.Int("http.status_code", sw.status))
+		if sw.status >= 500 {
+			s.SetStatus(codes.Error, http.StatusText(sw.status))
+		}
+	})
+}
@@ -0,0 +1,92 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans records the spans of the wiki until the end of the test.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	oldTracer, oldPropagator := tracer, otel.GetTextMapPropagator()
+	tracer = provider.Tracer("test")
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		tracer = oldTracer
+		otel.SetTextMapPropagator(oldPropagator)
+	})
+	return recorder
+}
+
+// spanAttribute returns an attribute of a span.
+func spanAttribute(s sdktrace.ReadOnlySpan, key string) attribute.Value {
+	for _, a := range s.Attributes() {
+		if string(a.Key) == key {
+			return a.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTracing(t *testing.T) {
+	recorder := recordSpans(t)
+	handler := withTracing(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		node := &Node{Path: r.URL.Path, ctx: r.Context()}
+		node.span("Write")()
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+
+	r := httptest.NewRequest("POST", "/page", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/broken", nil))
+
+	spans := recorder.Ended()
+	if len(spans) != 4 {
+		t.Fatalf("%d spans ended, want a server and a page span per request", len(spans))
+	}
+	page, server := spans[0], spans[1]
+	if server.Name() != "POST /page" || server.SpanKind() != trace.SpanKindServer {
+		t.Errorf("server span %q of kind %v", server.Name(), server.SpanKind())
+	}
+	if got := server.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("server span of trace %s, want the trace of the traceparent header", got)
+	}
+	if got := server.Parent().SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("server span with parent %s, want the span of the traceparent header", got)
+	}
+	if got := spanAttribute(server, "http.status_code").AsInt64(); got != 200 {
+		t.Errorf("server span with status code %d", got)
+	}
+	if page.Name() != "Write" || page.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Errorf("page span %q is not a child of the server span", page.Name())
+	}
+	if got := spanAttribute(page, "page.path").AsString(); got != "/page" {
+		t.Errorf("page span of path %q", got)
+	}
+	if server.Status().Code != codes.Unset {
+		t.Errorf("successful request with span status %v", server.Status())
+	}
+
+	broken := spans[3]
+	if broken.Status().Code != codes.Error || broken.Parent().IsValid() {
+		t.Errorf("failed request with span status %v, parent %v", broken.Status(), broken.Parent())
+	}
+}
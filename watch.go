@@ -0,0 +1,92 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDirectory drops the content derived caches whenever the files of the
+// wiki data directory change outside of the wiki, such as edits in an editor
+// or commits on the command line.
+func watchDirectory() {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Fatalf("WARNING: could not watch %q: %v", directory, err)
+	}
+	if err := watchTree(watcher, directory); err != nil {
+		log.Fatalf("WARNING: could not watch %q: %v", directory, err)
+	}
+	// Commits outside of the wiki change the index
+	if err := watcher.Add(path.Join(directory, ".git")); err != nil && !os.IsNotExist(err) {
+		log.Printf("Error: could not watch the commits of %q: %v", directory, err)
+	}
+	log.Printf("Watching %q for changes", directory)
+	watchEvents(watcher)
+}
+
+// watchTree adds a directory and those below it to watcher, skipping hidden
+// directories.
+func watchTree(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.Walk(dir, func(entry string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		if entry != dir && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+		return watcher.Add(entry)
+	})
+}
+
+// watchEvents drops the caches once the events of watcher stop for
+// -watch-delay, so that a checkout of many files invalidates them once.
+// Directories created meanwhile are watched too. Returns when the watcher
+// is closed.
+func watchEvents(watcher *fsnotify.Watcher) {
+	settled := time.NewTimer(watchDelay)
+	settled.Stop()
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Base(filepath.Dir(event.Name)) == ".git" && !isGitState(event.Name) {
+				continue
+			}
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := watchTree(watcher, event.Name); err != nil {
+						log.Printf("Error: could not watch %q: %v", event.Name, err)
+					}
+				}
+			}
+			settled.Reset(watchDelay)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("Error: watching %q: %v", directory, err)
+		case <-settled.C:
+			log.Printf("Files of %q changed, dropping caches", directory)
+			invalidateCaches()
+		}
+	}
+}
+
+// isGitState reports whether a file of the git directory records the state
+// of the repository, rather than the locks and objects of git at work.
+func isGitState(file string) bool {
+	name := filepath.Base(file)
+	return name == "index" || name == "HEAD"
+}
@@ -0,0 +1,91 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watching watches the test wiki for changes until the end of the test.
+func watching(t *testing.T, dir string) {
+	t.Helper()
+	old := watchDelay
+	watchDelay = 50 * time.Millisecond
+	t.Cleanup(func() { watchDelay = old })
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := watchTree(watcher, dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := watcher.Add(filepath.Join(dir, ".git")); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		watchEvents(watcher)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		watcher.Close()
+		<-done
+	})
+}
+
+// pagesCached reports whether the page listing is cached.
+func pagesCached() bool {
+	pageCache.Lock()
+	defer pageCache.Unlock()
+	return pageCache.pages != nil
+}
+
+// waitUncached waits for the page listing to be dropped from the cache.
+func waitUncached(t *testing.T, change string) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if !pagesCached() {
+			return
+		}
+	}
+	t.Errorf("page listing still cached after %s", change)
+}
+
+func TestWatchDirectory(t *testing.T) {
+	dir := newTestWiki(t, map[string]string{"a.md": "a\n", "docs/b.md": "b\n"})
+	watching(t, dir)
+
+	changes := []struct {
+		name   string
+		change func()
+	}{
+		{"writing a page", func() { writeTestFile(t, filepath.Join(dir, "c.md"), "c\n") }},
+		{"writing a nested page", func() { writeTestFile(t, filepath.Join(dir, "docs/b.md"), "changed\n") }},
+		{"creating a directory", func() { writeTestFile(t, filepath.Join(dir, "new/d.md"), "d\n") }},
+		{"writing in the new directory", func() { writeTestFile(t, filepath.Join(dir, "new/e.md"), "e\n") }},
+		{"committing outside of the wiki", func() {
+			cmd := exec.Command("git", "add", "-A")
+			cmd.Dir = dir
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("git add: %v: %s", err, out)
+			}
+		}},
+	}
+	for _, change := range changes {
+		// Until the caches were dropped for the previous change
+		time.Sleep(4 * watchDelay)
+		listPages("")
+		if !pagesCached() {
+			t.Fatal("page listing is not cached")
+		}
+		change.change()
+		waitUncached(t, change.name)
+	}
+}
@@ -2,29 +2,67 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"html/template"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/yuin/goldmark"
+	emoji "github.com/yuin/goldmark-emoji"
 	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
 )
 
-var md = goldmark.New(goldmark.WithExtensions(extension.Linkify, extension.GFM))
+var md = newMarkdown()
 
-var baseTemplate = template.New("wiki")
+// newMarkdown creates the markdown renderer for the configured extensions.
+func newMarkdown() goldmark.Markdown {
+	extensions := []goldmark.Extender{extension.Linkify, extension.GFM, headingAnchors{}, taskCheckBoxes{}, scrollingTables{}, imageAttributes{}, admonitions{}}
+	if useEmoji {
+		extensions = append(extensions, emoji.Emoji)
+	}
+	if smartypants {
+		extensions = append(extensions, extension.Typographer)
+	}
+	if useCodeCopy {
+		extensions = append(extensions, codeCopy{})
+	}
+	if inlineHTML != nil {
+		extensions = append(extensions, allowedHTML{policy: inlineHTML})
+	}
+	if stripComments {
+		extensions = append(extensions, htmlComments{})
+	}
+	if len(autolinkRules) > 0 {
+		extensions = append(extensions, autolinks{rules: autolinkRules})
+	}
+	return goldmark.New(goldmark.WithExtensions(extensions...))
+}
+
+var baseTemplate = template.New("wiki").Funcs(template.FuncMap{"T": T, "asset": asset, "themeURL": themeURL})
 
 func init() {
 	// Load base templates for reusing
 	_, err := baseTemplate.ParseFiles("templates/header.tpl", "templates/footer.tpl",
 		"templates/edit.tpl", "templates/revisions.tpl",
-		"templates/revision.tpl", "templates/node.tpl")
+		"templates/revision.tpl", "templates/node.tpl",
+		"templates/book.tpl", "templates/settings.tpl",
+		"templates/maintenance.tpl", "templates/backlinks.tpl",
+		"templates/authors.tpl", "templates/changes.tpl",
+		"templates/error.tpl", "templates/admin.tpl",
+		"templates/data.tpl", "templates/index.tpl",
+		"templates/slugs.tpl", "templates/search.tpl", "templates/prune.tpl")
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -43,27 +81,99 @@ type Node struct {
 	Dirs     []*Directory
 	Log      []*Log
 	Markdown template.HTML
+	Meta     map[string]string // Front matter
+
+	Recent    []*Directory // Pages the reader viewed before
+	Backlinks []*Directory // Pages linking to this one
+	Authors   []*Author    // Committers of the wiki
+	Changes   []*Log       // Latest changes of the wiki
+	ChangesBy string       // Author the changes are filtered by
+
+	Stats       *WikiStats    // Overview of the wiki on the dashboard
+	DataHeader  []string      // First record of a data file, see -data-tables
+	DataRows    [][]string    // Further records of a data file
+	Since       string        // Tag, commit or date of the page changes
+	PageChanges []*PageChange // Pages changed since then
+	Pages       []*Directory  // Pages of a directory without an index page
+	Subdirs     []*Directory  // Subdirectories of that directory
+
+	Query     string // Words searched for
+	Truncated bool   // The search stopped before scanning every page
+
+	CSRF      string // Form token of the administrator, see csrfToken
+	PruneKeep int    // Revisions kept by pruning, see -max-revisions
+
+	Lang        string // Language of the user interface
+	Description string // Summary of the page for search engines and previews
+	NoIndex     bool   // Search engines are asked not to index the page
+	Theme       string // Colour theme, empty to follow the browser preference
+	RawQuery    string // Query of the request, kept when switching the theme
+	ExtraHead   template.HTML
+	ExtraFooter template.HTML
+	Styles      []string // Stylesheets of the wiki and the page's directory
 
 	Edit      bool // Edit mode
 	Revisions bool // Show revisions
 	AskDelete bool // Delete mode
+	Fragment  bool // Only render the node content
+	Draft     bool // Editing an unpublished draft
+	ReadOnly  bool // Changes are rejected
+	System    bool // Not a wiki page, so without page actions
 	Author    string
 	Changelog string
+	EditURL   string // Page in the hosted content repository, if any
+	Settings  Settings
+
+	EditableTasks bool // Task list items can be toggled
+	RevertPreview bool // Showing the page as a revert to Revision leaves it
+	CodeCopy      bool // Code blocks have a copy button
+
+	InlineHistory []*Log // Latest entries of Log shown below the page, see -inline-history
+
+	MaxBytes int // Page size limit, 0 without limit
+	Size     int // Page size in bytes
+
+	Split        bool  // Large pages are split, see -section-bytes
+	Section      int   // Section of a split page to render
+	LazySections []int // Sections loaded as the reader scrolls down
+
+	Status    int    // Status of an error page
+	Message   string // Error shown on an error page
+	RequestID string // Request quoted when reporting an error
+
+	Shortcuts    map[string]string // Keys and their actions, see -shortcuts
+	ShortcutURLs map[string]string // URLs of the shortcut actions on this page
+
+	LockToken   string // Edit lock held by the editor, see -edit-lock
+	LockedBy    string // Author of another editor holding the lock
+	LockedSince int    // Minutes since the other editor took the lock
+	LockRefresh int    // Milliseconds between refreshing the lock
+
+	ctx     context.Context // Request traced with -tracing
+	gzipped []byte          // Markdown gzipped by the -disk-cache-dir cache
 }
 
+// revisionHash matches the abbreviated or full hash of a revision.
+var revisionHash = regexp.MustCompile(`^[0-9a-f]{4,40}$`)
+
 // Directory lists nodes.
 type Directory struct {
 	Path   string
 	Name   string
 	Active bool
+
+	Heading string // Title of a listed page, see -index-summaries
+	Summary string // First paragraph of a listed page
 }
 
 // Log is an event in the past.
 type Log struct {
-	Hash    string
-	Message string
-	Time    string
-	Link    bool
+	Hash    string `json:"hash"`
+	Author  string `json:"author"`
+	Message string `json:"message"`
+	Time    string `json:"time"`
+	Page    string `json:"page,omitempty"` // Page changed, in logs of the whole wiki
+	Link    bool   `json:"-"`
 }
 
 func (node *Node) isHead() bool {
@@ -72,115 +182,609 @@ func (node *Node) isHead() bool {
 
 // ToMarkdown processes the node contents.
 func (node *Node) ToMarkdown() {
-	var source = node.Bytes
+	defer node.span("Markdown")()
+	var source []byte
+	node.Meta, source = parseFrontMatter(node.Bytes)
+	node.Meta = mergeSidecar(node.Meta, node.File)
 	var buf bytes.Buffer
-	if err := md.Convert(source, &buf); err != nil {
-		panic(err)
+	switch path.Ext(node.File) {
+	case ".txt":
+		// Plain text is shown as is
+		buf.WriteString("<pre>")
+		template.HTMLEscape(&buf, source)
+		buf.WriteString("</pre>")
+	case ".html":
+		// Hand written HTML is trusted as is, only administrators change it
+		buf.Write(source)
+	default:
+		source = node.expandTokens(source)
+		offset := headingOffset
+		if value, err := strconv.Atoi(node.Meta["heading-offset"]); err == nil {
+			offset = value
+		}
+		if node.Split && len(source) > sectionBytes {
+			// Render a single section of a large page
+			sections := splitSections(source)
+			if node.Section < 0 || node.Section >= len(sections) {
+				node.Markdown = ""
+				return
+			}
+			source = sections[node.Section]
+			if node.Section == 0 {
+				for i := 1; i < len(sections); i++ {
+					node.LazySections = append(node.LazySections, i)
+				}
+			}
+		} else if node.Section != 0 {
+			node.Markdown = ""
+			return
+		}
+		if diskCacheDir != "" {
+			var html []byte
+			html, node.gzipped = renderCached(source, offset)
+			buf.Write(html)
+		} else if err := md.Convert(source, &buf, parser.WithContext(newParserContext(offset))); err != nil {
+			panic(err)
+		}
 	}
 
 	node.Markdown = template.HTML(buf.String())
 }
 
 func wikiHandler(w http.ResponseWriter, r *http.Request) {
-	if r.URL.Path == "/favicon.ico" {
+	// Redirect filesystem style links such as /foo.md to /foo
+	if page := trimPageSuffix(r.URL.Path); page != r.URL.Path {
+		location := strings.TrimSuffix(basepath, "/") + page
+		if r.URL.RawQuery != "" {
+			location += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, location, http.StatusMovedPermanently)
+		return
+	}
+
+	// Other files such as images are served as they are
+	if serveAttachment(w, r) {
+		return
+	}
+	if serveIndex(w, r) {
 		return
 	}
+
+	// Changes are only accepted by POST, so that following a link never
+	// changes a page
+	if r.Method != http.MethodPost {
+		query := r.URL.Query()
+		for _, param := range []string{"content", "revert", "delete", "task", "publish"} {
+			if query.Get(param) != "" {
+				w.Header().Set("Allow", "POST")
+				http.Error(w, "Changes must be submitted with POST", http.StatusMethodNotAllowed)
+				return
+			}
+		}
+	}
+
 	// Params
-	content := r.FormValue("content")
-	changelog := r.FormValue("msg")
-	author := r.FormValue("author")
-	reset := r.FormValue("revert")
+	content := r.PostFormValue("content")
+	changelog := withCoauthors(r.PostFormValue("msg"), r.PostFormValue("coauthors"))
+	author := commitAuthor(r)
+	reset := r.PostFormValue("revert")
 	revision := r.FormValue("revision")
+	preview := r.FormValue("revert-preview")
+	task := r.PostFormValue("task")
+	draft := parseBool(r.PostFormValue("draft"))
+	publish := parseBool(r.PostFormValue("publish"))
+	s := currentSettings()
 
 	// Default to index page on trailing slash
 	if r.URL.Path[len(r.URL.Path)-1] == '/' {
-		r.URL.Path += "index"
+		r.URL.Path = indexPage(r.URL.Path)
+	}
+	file, rewritten := rewriteFile(r.URL.Path)
+	if !rewritten {
+		file = resolveFile(r.URL.Path[1:])
+	} else if file == "" {
+		http.NotFound(w, r)
+		return
 	}
-	filePath := fmt.Sprintf("%s%s.md", directory, r.URL.Path)
 	node := &Node{
-		File:     r.URL.Path[1:] + ".md",
+		File:     file,
 		Path:     r.URL.Path,
-		Title:    title,
+		Title:    s.Title,
 		Basepath: strings.TrimSuffix(basepath, "/"), // we do not want basepath to end with a /
+		ReadOnly: s.ReadOnly,
+		ctx:      r.Context(),
+
+		ExtraHead:   extraHead,
+		ExtraFooter: extraFooter,
+		Styles:      pageStyles(r.URL.Path[1:]),
+		CodeCopy:    useCodeCopy,
+		MaxBytes:    maxPageBytes,
 	}
 	node.Revisions = parseBool(r.FormValue("revisions"))
 	node.Edit = parseBool(r.FormValue("edit"))
 	node.AskDelete = parseBool(r.FormValue("askdelete"))
+	node.Fragment = parseBool(r.FormValue("fragment"))
 
-	if cookie, err := r.Cookie("author"); err == nil {
-		node.Author = cookie.Value
-	}
-	if node.Author == "" {
-		node.Author = "Unknown"
-	}
+	node.readTheme(w, r)
+
+	node.Author = author
 
 	// Delete if needed
-	deleteNow := parseBool(r.FormValue("delete"))
+	deleteNow := parseBool(r.PostFormValue("delete"))
+	changes := deleteNow || content != "" || reset != "" || task != "" || publish
+	if node.ReadOnly && changes {
+		http.Error(w, "The wiki is read only", http.StatusForbidden)
+		return
+	}
+	if (changes || node.Edit) && isReserved(node.Path) {
+		http.Error(w, "This path is reserved", http.StatusBadRequest)
+		return
+	}
+	if !node.ReadOnly && isProtected(node.Path, node.File) {
+		if isAdmin(r) {
+			// Browsers send the credentials along with requests of other
+			// sites too, the forms carry the token of the administrator
+			node.CSRF = csrfToken(r)
+			if changes && !checkCSRF(w, r) {
+				return
+			}
+		} else if changes || node.Edit {
+			if !adminEnabled() {
+				http.Error(w, "This page is protected", http.StatusForbidden)
+			} else {
+				requireAdmin(w, r)
+			}
+			return
+		} else {
+			node.ReadOnly = true
+		}
+	}
+	if submodule := submoduleOf(node.File); submodule != "" && !node.ReadOnly {
+		if changes || node.Edit {
+			http.Error(w, fmt.Sprintf("This page belongs to the submodule %q, change it there", submodule), http.StatusForbidden)
+			return
+		}
+		node.ReadOnly = true
+	}
+	node.Edit = node.Edit && !node.ReadOnly
+	if changes && author == "" {
+		http.Error(w, "Changes need an author", http.StatusBadRequest)
+		return
+	}
+	if maxPageBytes > 0 && len(content) > maxPageBytes {
+		http.Error(w, fmt.Sprintf("Pages are limited to %d bytes", maxPageBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if content != "" {
+		var err error
+		if content, err = normalizeContent(content); err != nil {
+			http.Error(w, "Pages must be valid UTF-8", http.StatusBadRequest)
+			return
+		}
+		// The submitter is not told which pattern matched
+		if line := blockedLine(content); line > 0 {
+			log.Printf("Rejected change of %q by %q, matching line %d of the blocklist", node.File, author, line)
+			http.Error(w, "This change is not allowed", http.StatusForbidden)
+			return
+		}
+	}
 	if deleteNow {
 		// Delete file
 		file := r.URL.Path
 		changelog := fmt.Sprintf("Delete %s", node.File)
-		node.GitRemove().GitCommit(changelog, author)
-		// Move node path one level up and redirect
-		var location string
-		if file[len(file)-1] == '/' {
-			location = strings.TrimRight(file, "/")
-		} else {
-			file = file[:strings.LastIndexAny(file, "/")+1]
+		if err := node.remove(author, changelog); err != nil {
+			log.Printf("Cant delete %q, error: %v", node.File, err)
+			http.Error(w, "Could not commit the change", http.StatusInternalServerError)
+			return
 		}
-		http.Redirect(w, r, location, http.StatusTemporaryRedirect)
+		rememberAuthor(w, r)
+		// Move node path one level up and redirect, as a GET
+		location := file[:strings.LastIndex(file, "/")+1]
+		http.Redirect(w, r, location, http.StatusSeeOther)
 		return
 	}
 
 	node.Dirs = listDirectories(r.URL.Path)
 
 	// We have content, update
-	if content != "" && changelog != "" && author != "" {
-		node.Author = author
+	if content != "" && changelog != "" && draft {
+		if err := node.saveDraft([]byte(content), changelog, author); err != nil {
+			log.Printf("Cant save draft of %q, error: %v", node.File, err)
+			http.Error(w, "Could not save the draft", http.StatusInternalServerError)
+			return
+		}
+		unlockPage(node.File, r.PostFormValue("lock"))
+		rememberAuthor(w, r)
+		http.Redirect(w, r, node.Basepath+node.Path+"?edit=1", http.StatusSeeOther)
+		return
+	} else if content != "" && changelog != "" {
 		bytes := []byte(content)
-		err := writeFile(bytes, filePath)
-		if err != nil {
-			log.Printf("Cant write to file %q, error: %v", filePath, err)
-		} else {
-			// Wrote file, commit
-			node.Bytes = bytes
-			node.GitAdd().GitCommit(changelog, author).GitLog()
-			node.ToMarkdown()
+		// Save together with dropping any draft
+		var drop []string
+		if _, ok := node.readDraft(); ok {
+			drop = append(drop, node.draftNode().File)
+		}
+		if err := node.write(bytes, author, changelog, drop...); err != nil {
+			log.Printf("Cant save %q, error: %v", node.File, err)
+			http.Error(w, "Could not save the change", http.StatusInternalServerError)
+			return
+		}
+		unlockPage(node.File, r.PostFormValue("lock"))
+		rememberAuthor(w, r)
+		node.Bytes = bytes
+		node.History()
+		node.ToMarkdown()
+	} else if publish {
+		// Replace the page by its draft
+		if err := node.publishDraft(author); err != nil {
+			log.Printf("Cant publish draft of %q, error: %v", node.File, err)
+			http.Error(w, "Could not publish the draft", http.StatusInternalServerError)
+			return
+		}
+		rememberAuthor(w, r)
+		http.Redirect(w, r, node.Basepath+node.Path, http.StatusSeeOther)
+		return
+	} else if task != "" {
+		// Toggle a single task list item of the current revision
+		node.Show().History()
+		n, err := strconv.Atoi(task)
+		section, _ := strconv.Atoi(r.PostFormValue("section"))
+		if !editableTasks || err != nil {
+			http.Error(w, "Invalid task", http.StatusBadRequest)
+			return
+		}
+		if node.Revision != revision {
+			http.Error(w, "The page has changed, please reload it", http.StatusConflict)
+			return
+		}
+		n, ok := node.sectionTask(section, n)
+		if !ok {
+			http.Error(w, "Invalid task", http.StatusBadRequest)
+			return
 		}
+		bytes, ok := toggleTask(node.Bytes, n)
+		if !ok {
+			http.Error(w, "Invalid task", http.StatusBadRequest)
+			return
+		}
+		changelog := fmt.Sprintf("Toggle task in %s", node.File)
+		if err := node.write(bytes, author, changelog); err != nil {
+			log.Printf("Cant save %q, error: %v", node.File, err)
+			http.Error(w, "Could not save the change", http.StatusInternalServerError)
+			return
+		}
+		rememberAuthor(w, r)
+		http.Redirect(w, r, node.Basepath+node.Path, http.StatusSeeOther)
+		return
 	} else if reset != "" {
 		// Reset to revision
 		node.Revision = reset
-		node.GitRevert().GitCommit("Reverted to: "+node.Revision, author)
+		if isUnpublished(node.File, node.Show().Bytes) && !isAdmin(r) {
+			// Only administrators can see revisions before their publish date
+			http.NotFound(w, r)
+			return
+		}
+		if err := node.Revert(author); err != nil {
+			log.Printf("Cant revert %q, error: %v", node.File, err)
+			http.Error(w, "Could not commit the change", http.StatusInternalServerError)
+			return
+		}
+		rememberAuthor(w, r)
 		node.Revision = ""
-		node.GitShow().GitLog()
+		node.Show().History()
+		node.ToMarkdown()
+	} else if preview != "" {
+		// Show the page as reverting to a revision would leave it
+		if node.ReadOnly {
+			http.Error(w, "This page can not be changed", http.StatusForbidden)
+			return
+		}
+		node.Revision = preview
+		if !revisionHash.MatchString(preview) || len(node.Show().Bytes) == 0 {
+			http.Error(w, fmt.Sprintf("There is no revision %q of this page", preview), http.StatusNotFound)
+			return
+		}
+		if isUnpublished(node.File, node.Bytes) && !isAdmin(r) {
+			// Only administrators can see revisions before their publish date
+			http.NotFound(w, r)
+			return
+		}
+		node.History()
+		node.RevertPreview = true
 		node.ToMarkdown()
 	} else {
 		// Show specific revision
 		node.Revision = revision
-		node.GitShow().GitLog()
+		node.Show().History()
 
 		createNew := len(node.Bytes) == 0
+		if createNew && revision == "" && !node.Edit {
+			// Aliases of a page only lead to it
+			if target, ok := cachedAliases()[node.Path]; ok {
+				if r.URL.RawQuery != "" {
+					target += "?" + r.URL.RawQuery
+				}
+				http.Redirect(w, r, target, http.StatusMovedPermanently)
+				return
+			}
+			// So do different spellings of it
+			if slugRedirects && serveSlugMatch(w, r, node) {
+				return
+			}
+		}
+		if createNew && node.ReadOnly {
+			http.NotFound(w, r)
+			return
+		}
+		if !createNew && isUnpublished(node.File, node.Bytes) && !isAdmin(r) {
+			// Only administrators can preview pages before their publish date
+			http.NotFound(w, r)
+			return
+		}
 		node.Edit = node.Edit || createNew
+		if repoURL != "" && !createNew {
+			node.EditURL = fmt.Sprintf("%s/edit/%s/%s", repoURL, repoBranch, node.File)
+		}
 
 		changelogPageName := strings.TrimLeft(node.Path, "/")
 		if changelogPageName == "" {
 			changelogPageName = "index page"
 		}
-		node.Changelog = fmt.Sprintf("Edit %s", changelogPageName)
+		node.Changelog = strings.ReplaceAll(msgEdit, "{page}", changelogPageName)
 		if createNew {
-			node.Changelog = fmt.Sprintf("Create %s", changelogPageName)
+			node.Changelog = strings.ReplaceAll(msgCreate, "{page}", changelogPageName)
+		}
+
+		w.Header().Add("Vary", "Accept")
+		if format := negotiateFormat(r); format != formatHTML && (createNew || !node.Edit) {
+			if createNew {
+				http.NotFound(w, r)
+				return
+			}
+			if revision == "" {
+				setCacheControl(w, node)
+			}
+			writePage(w, node, format)
+			return
+		}
+
+		if node.Fragment {
+			// Fragments are for embedding existing pages, never the editor
+			if createNew {
+				http.NotFound(w, r)
+				return
+			}
+			node.Edit = false
 		}
 
 		if node.Edit {
 			node.Content = string(node.Bytes)
+			if draft, ok := node.readDraft(); ok {
+				node.Content = string(draft)
+				node.Draft = true
+			} else if createNew {
+				node.Content = newPageContent(strings.TrimPrefix(node.Path, "/"))
+			}
+			node.Size = len(node.Content)
 			node.Template = "edit.tpl"
+			if editLockTTL > 0 {
+				lockNode(node, "")
+			}
+		} else if isStandalone(node) {
+			if revision == "" {
+				setCacheControl(w, node)
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write(node.Bytes)
+			return
 		} else {
+			node.EditableTasks = editableTasks && !node.ReadOnly
+			node.Split = sectionBytes > 0 && !node.Fragment
+			if r.FormValue("section") != "" {
+				// A later section of a large page, see -section-bytes
+				node.Split = sectionBytes > 0
+				node.Section = -1
+				if n, err := strconv.Atoi(r.FormValue("section")); err == nil && n > 0 {
+					node.Section = n
+				}
+				node.ToMarkdown()
+				if node.Markdown == "" {
+					http.NotFound(w, r)
+					return
+				}
+				if revision == "" {
+					setCacheControl(w, node)
+				}
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				if len(node.gzipped) > 0 {
+					// Cached sections are sent as they are stored
+					w.Header().Add("Vary", "Accept-Encoding")
+					if acceptsGzip(r) {
+						w.Header().Set("Content-Encoding", "gzip")
+						w.Write(node.gzipped)
+						return
+					}
+				}
+				w.Write([]byte(node.Markdown))
+				return
+			}
 			node.ToMarkdown()
+			node.Description = node.description()
+			node.NoIndex = isNoIndex(node.Meta)
+			if inlineHistory > 0 && !node.Revisions && !node.Fragment {
+				node.InlineHistory = node.Log
+				if len(node.InlineHistory) > inlineHistory {
+					node.InlineHistory = node.InlineHistory[:inlineHistory]
+				}
+			}
+			if revision == "" && !node.Revisions && !node.Fragment {
+				trackRecent(w, r, node)
+			}
+			if revision == "" && !node.Revisions {
+				setCacheControl(w, node)
+			}
 		}
 	}
 	renderTemplate(w, node)
 }
 
+// setCacheControl lets clients cache a page view for the cache value of its
+// front matter in seconds, or -default-cache.
+func setCacheControl(w http.ResponseWriter, node *Node) {
+	maxAge := defaultCache
+	if value, err := strconv.Atoi(node.Meta["cache"]); err == nil && value >= 0 {
+		maxAge = value
+	}
+	if maxAge > 0 {
+		w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", maxAge))
+	}
+}
+
+// isProtected reports whether a page may only be changed by administrators,
+// with their form token, either because of the -protected list or its front
+// matter. Hand written
+// HTML pages are always protected, as they are served without sanitizing.
+func isProtected(page, file string) bool {
+	if path.Ext(file) == ".html" {
+		return true
+	}
+	for _, protected := range protectedPages {
+		if page == protected || (strings.HasSuffix(protected, "/") && strings.HasPrefix(page, protected)) {
+			return true
+		}
+	}
+	bytes, _ := ioutil.ReadFile(path.Join(directory, file))
+	meta, _ := parseFrontMatter(bytes)
+	return parseBool(mergeSidecar(meta, file)["protected"])
+}
+
+// isStandalone reports whether a node is a hand written HTML page, which is
+// shown as is rather than inside the wiki layout.
+func isStandalone(node *Node) bool {
+	return path.Ext(node.File) == ".html" && !node.Revisions && !node.Fragment
+}
+
+// readTheme sets the colour theme of a request, remembering a newly chosen
+// one in a cookie.
+func (node *Node) readTheme(w http.ResponseWriter, r *http.Request) {
+	node.RawQuery = r.URL.RawQuery
+	node.Theme = parseTheme(r.FormValue("theme"))
+	if node.Theme != "" {
+		setCookie(w, "theme", node.Theme)
+	} else if cookie, err := r.Cookie("theme"); err == nil {
+		node.Theme = parseTheme(cookie.Value)
+	}
+}
+
+// themeURL returns the link switching to a colour theme, keeping the rest of
+// the query such as the revision shown.
+func themeURL(rawQuery, theme string) string {
+	query, _ := url.ParseQuery(rawQuery)
+	query.Set("theme", theme)
+	return "?" + query.Encode()
+}
+
+// parseTheme returns a known colour theme, or an empty string.
+func parseTheme(theme string) string {
+	if theme == "dark" || theme == "light" {
+		return theme
+	}
+	return ""
+}
+
+// trimPageSuffix strips a trailing page extension or .html from a path.
+func trimPageSuffix(page string) string {
+	for _, ext := range pageSuffixes {
+		if trimmed := strings.TrimSuffix(page, ext); trimmed != page && !strings.HasSuffix(trimmed, "/") {
+			return trimmed
+		}
+	}
+	return page
+}
+
+// resolveFile returns the file for a page by trying each of the recognised
+// extensions in order, falling back to the first one for new pages.
+func resolveFile(page string) string {
+	for _, ext := range extensions {
+		if _, err := os.Stat(fmt.Sprintf("%s/%s%s", directory, page, ext)); err == nil {
+			return page + ext
+		}
+	}
+	return page + extensions[0]
+}
+
+// indexPage returns the page of a directory path ending with a slash, the
+// first of -index-names that exists, or else the first one.
+func indexPage(dir string) string {
+	for _, name := range indexNames {
+		page := dir + name
+		if _, err := os.Stat(path.Join(directory, resolveFile(strings.TrimPrefix(page, "/")))); err == nil {
+			return page
+		}
+	}
+	return dir + indexNames[0]
+}
+
+// listPages walks a directory below the wiki data directory and returns the
+// files with a recognised page extension, relative to the data directory.
+// Hidden directories, files ignored by git and files starting with an
+// underscore are left out. Directories nested deeper than -max-depth below
+// dir are not walked but returned as more, relative to the data directory.
+func listPages(dir string) (pages []string, more []string) {
+	if listing, ok := cachedPages(dir); ok {
+		return listing.pages, listing.more
+	}
+	known := cachedGitFiles()
+	root := path.Join(directory, dir)
+	filepath.Walk(root, func(entry string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			if entry == root {
+				return nil
+			}
+			if strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			sub, _ := filepath.Rel(root, entry)
+			if maxDepth > 0 && strings.Count(filepath.ToSlash(sub), "/") >= maxDepth {
+				rel, _ := filepath.Rel(directory, entry)
+				more = append(more, filepath.ToSlash(rel))
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// Files such as _template.md support the wiki rather than being pages
+		if strings.HasPrefix(info.Name(), "_") {
+			return nil
+		}
+		rel, _ := filepath.Rel(directory, entry)
+		rel = filepath.ToSlash(rel)
+		if known != nil && !known[rel] {
+			return nil
+		}
+		for _, ext := range extensions {
+			if path.Ext(entry) == ext {
+				pages = append(pages, rel)
+				break
+			}
+		}
+		return nil
+	})
+	cachePages(dir, pageListing{pages: pages, more: more})
+	return pages, more
+}
+
+// pageURL returns the path of a page file, including the base path.
+func pageURL(file string) string {
+	page := strings.TrimSuffix(file, path.Ext(file))
+	if dir := strings.TrimSuffix(page, path.Base(page)); indexPage("/"+dir) == "/"+page {
+		page = dir
+	}
+	return strings.TrimSuffix(basepath, "/") + "/" + page
+}
+
 func writeFile(bytes []byte, entry string) error {
 	err := os.MkdirAll(path.Dir(entry), 0777)
 	if err == nil {
@@ -191,13 +795,16 @@ func writeFile(bytes []byte, entry string) error {
 
 func setCookie(w http.ResponseWriter, name, value string) {
 	expiration := time.Now().AddDate(1, 0, 0)
-	cookie := http.Cookie{Name: name, Value: value, Expires: expiration}
+	cookie := http.Cookie{Name: name, Value: value, Path: "/", Expires: expiration}
 	http.SetCookie(w, &cookie)
 }
 
 func renderTemplate(w http.ResponseWriter, node *Node) {
-	// Set cookies
-	setCookie(w, "author", node.Author)
+	node.Lang = language
+	defer node.span("Template")()
+	if shortcuts != nil {
+		node.Shortcuts, node.ShortcutURLs = shortcuts, shortcutURLs(node)
+	}
 
 	// Clone base template
 	t, err := baseTemplate.Clone()
@@ -206,7 +813,12 @@ func renderTemplate(w http.ResponseWriter, node *Node) {
 	}
 
 	// Build content template
-	if node.Markdown != "" {
+	if node.Fragment && node.Markdown != "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err = executeLayout(w, t, node, func(t *template.Template, w io.Writer) error {
+			return t.ExecuteTemplate(w, "node", node)
+		})
+	} else if node.Markdown != "" && node.Template == "" {
 		tpl := "{{ template \"header\" . }}"
 
 		// Show revisions
@@ -214,7 +826,9 @@ func renderTemplate(w http.ResponseWriter, node *Node) {
 			tpl += "{{ template \"revisions\" . }}"
 		}
 
-		if !node.isHead() && node.Revision != "" {
+		if node.RevertPreview {
+			tpl += "{{ template \"revertpreview\" . }}"
+		} else if !node.isHead() && node.Revision != "" {
 			tpl += "{{ template \"revision\" . }}"
 		}
 		// Add node
@@ -226,7 +840,9 @@ func renderTemplate(w http.ResponseWriter, node *Node) {
 			log.Fatalf("Couldn't parse template %q: %v", tpl, err)
 		}
 		// Execute
-		err = t.Execute(w, node)
+		err = executeLayout(w, t, node, func(t *template.Template, w io.Writer) error {
+			return t.Execute(w, node)
+		})
 	} else if node.Template != "" {
 		err = t.ExecuteTemplate(w, node.Template, node)
 	}
@@ -0,0 +1,289 @@
+/*
+GNU GPLv3 - see LICENSE
+*/
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestWiki serves the wiki from a new git repository holding files, by
+// their path relative to it, until the end of the test.
+func newTestWiki(t testing.TB, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	git("init", "-q")
+	git("config", "user.name", "tester")
+	git("config", "user.email", "tester@example.com")
+	git("config", "commit.gpgsign", "false")
+	for file, content := range files {
+		writeTestFile(t, filepath.Join(dir, file), content)
+	}
+	if len(files) > 0 {
+		git("add", "-A")
+		git("commit", "-q", "-m", "Initial commit")
+	}
+
+	oldDirectory, oldStore := directory, store
+	directory, store = dir, gitStore{}
+	invalidateCaches()
+	t.Cleanup(func() {
+		directory, store = oldDirectory, oldStore
+		invalidateCaches()
+	})
+	return dir
+}
+
+// writeTestFile writes a file, creating its directories.
+func writeTestFile(t testing.TB, file, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTrimPageSuffix(t *testing.T) {
+	defer func(old []string) { pageSuffixes = old }(pageSuffixes)
+	pageSuffixes = []string{".md", ".markdown", ".html"}
+
+	tests := []struct {
+		path, want string
+	}{
+		{"/foo.md", "/foo"},
+		{"/foo.markdown", "/foo"},
+		{"/foo.html", "/foo"},
+		{"/dir/foo.md", "/dir/foo"},
+		{"/foo", "/foo"},
+		{"/dir/", "/dir/"},
+		{"/dir/.md", "/dir/.md"},
+		{"/foo.txt", "/foo.txt"},
+	}
+	for _, test := range tests {
+		if got := trimPageSuffix(test.path); got != test.want {
+			t.Errorf("trimPageSuffix(%q) = %q, want %q", test.path, got, test.want)
+		}
+	}
+}
+
+func TestSuffixRedirect(t *testing.T) {
+	newTestWiki(t, map[string]string{"foo.md": "# Foo\n"})
+
+	tests := []struct {
+		target, location string
+	}{
+		{"/foo.md", "/foo"},
+		{"/foo.html?revisions=1", "/foo?revisions=1"},
+		{"/foo", ""},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		wikiHandler(w, httptest.NewRequest("GET", test.target, nil))
+		if test.location == "" {
+			if w.Code != http.StatusOK {
+				t.Errorf("GET %s: status %d, want %d", test.target, w.Code, http.StatusOK)
+			}
+			continue
+		}
+		if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != test.location {
+			t.Errorf("GET %s: %d to %q, want %d to %q", test.target,
+				w.Code, w.Header().Get("Location"), http.StatusMovedPermanently, test.location)
+		}
+	}
+}
+
+func TestThemeLinksKeepQuery(t *testing.T) {
+	newTestWiki(t, map[string]string{"foo.md": "# Foo\n"})
+
+	tests := []struct {
+		target, link string
+	}{
+		{"/foo", `href="?theme=dark"`},
+		{"/foo?revisions=1", `href="?revisions=1&amp;theme=dark"`},
+		{"/foo?revisions=1&theme=dark", `href="?revisions=1&amp;theme=light"`},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		wikiHandler(w, httptest.NewRequest("GET", test.target, nil))
+		if !strings.Contains(w.Body.String(), test.link) {
+			t.Errorf("GET %s has no theme link %s", test.target, test.link)
+		}
+	}
+}
+
+// postPage submits new content of a page, as the editor form does.
+func postPage(t testing.TB, r func(*http.Request) *http.Request, page, content string) *httptest.ResponseRecorder {
+	t.Helper()
+	return postForm(t, r, page, url.Values{"content": {content}, "author": {"tester"}, "msg": {"Update"}})
+}
+
+// postForm submits a form to a page.
+func postForm(t testing.TB, r func(*http.Request) *http.Request, page string, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("POST", page, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if r != nil {
+		req = r(req)
+	}
+	w := httptest.NewRecorder()
+	wikiHandler(w, req)
+	return w
+}
+
+func TestHTMLPagesAreProtected(t *testing.T) {
+	dir := newTestWiki(t, map[string]string{"page.html": "<p>Hello</p>\n"})
+	defer func(old []string) { extensions = old }(extensions)
+
+	tests := []struct {
+		extensions []string
+		page       string
+	}{
+		{[]string{".md", ".html"}, "/page"},
+		{[]string{".html"}, "/new"},
+	}
+	for _, test := range tests {
+		extensions = test.extensions
+		if w := postPage(t, nil, test.page, "<script>alert(1)</script>"); w.Code != http.StatusForbidden {
+			t.Errorf("POST %s without administration: status %d, want %d", test.page, w.Code, http.StatusForbidden)
+		}
+	}
+
+	authorize := asAdmin(t)
+	extensions = []string{".md", ".html"}
+	if w := postPage(t, nil, "/page", "<script>alert(1)</script>"); w.Code != http.StatusUnauthorized {
+		t.Errorf("POST /page as anyone: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	// Browsers send the credentials along with forms of other sites
+	if w := postPage(t, authorize, "/page", "<script>alert(1)</script>"); w.Code != http.StatusForbidden {
+		t.Errorf("POST /page as administrator without the form token: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if bytes, _ := os.ReadFile(dir + "/page.html"); string(bytes) != "<p>Hello</p>\n" {
+		t.Errorf("page.html changed to %q", bytes)
+	}
+	form := url.Values{"content": {"<p>Changed</p>"}, "author": {"tester"}, "msg": {"Update"}, "csrf": {editToken(t, authorize, "/page")}}
+	if w := postForm(t, authorize, "/page", form); w.Code != http.StatusOK {
+		t.Errorf("POST /page as administrator: status %d", w.Code)
+	}
+	if bytes, _ := os.ReadFile(dir + "/page.html"); !strings.Contains(string(bytes), "Changed") {
+		t.Errorf("page.html not changed by the administrator: %q", bytes)
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	files := map[string]string{"top.md": "top\n"}
+	dir := ""
+	for i := 1; i <= 8; i++ {
+		dir += "d" + string(rune('0'+i)) + "/"
+		files[dir+"page.md"] = "page\n"
+	}
+	newTestWiki(t, files)
+	defer func(old int) { maxDepth = old; invalidateCaches() }(maxDepth)
+
+	maxDepth = 0
+	if pages, more := listPages(""); len(pages) != 9 || len(more) != 0 {
+		t.Errorf("listPages without -max-depth = %v, more %v, want all 9 pages", pages, more)
+	}
+
+	maxDepth = 3
+	invalidateCaches()
+	pages, more := listPages("")
+	want := []string{"d1/d2/d3/page.md", "d1/d2/page.md", "d1/page.md", "top.md"}
+	if strings.Join(pages, " ") != strings.Join(want, " ") {
+		t.Errorf("listPages with -max-depth 3 = %v, want %v", pages, want)
+	}
+	if len(more) != 1 || more[0] != "d1/d2/d3/d4" {
+		t.Errorf("listPages with -max-depth 3 has more %v, want d1/d2/d3/d4", more)
+	}
+	// Deeper listings are again limited relative to their own directory
+	if pages, more := listPages("d1/d2/d3/d4"); len(pages) != 4 || len(more) != 1 || more[0] != "d1/d2/d3/d4/d5/d6/d7/d8" {
+		t.Errorf("listPages(d4) with -max-depth 3 = %v, more %v", pages, more)
+	}
+
+	dirs := listDirectories("/d1/d2/d3/d4/d5/d6/d7/d8/page")
+	var names []string
+	for _, d := range dirs {
+		names = append(names, d.Name)
+	}
+	if got := strings.Join(names, " "); got != homeLabel+" … d7 d8 page" {
+		t.Errorf("listDirectories with -max-depth 3 = %q", got)
+	}
+	if dirs[1].Path != "/d1/d2/d3/d4/d5/d6" {
+		t.Errorf("the collapsed directories link to %q, want the innermost one", dirs[1].Path)
+	}
+	if !dirs[len(dirs)-1].Active {
+		t.Error("the current page is not the active directory")
+	}
+	if dirs := listDirectories("/d1/d2/page"); len(dirs) != 4 {
+		t.Errorf("listDirectories collapsed a path within -max-depth: %d entries", len(dirs))
+	}
+}
+
+func TestPageSizeLimit(t *testing.T) {
+	dir := newTestWiki(t, map[string]string{"a.md": "old\n"})
+	defer func(old int) { maxPageBytes = old }(maxPageBytes)
+	maxPageBytes = 100
+
+	if w := postPage(t, nil, "/a", strings.Repeat("x", 101)); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("saving a page over -max-page-bytes answered %d, want 413", w.Code)
+	}
+	if bytes, _ := os.ReadFile(filepath.Join(dir, "a.md")); string(bytes) != "old\n" {
+		t.Errorf("a.md is %q after saving too much", bytes)
+	}
+	if w := postPage(t, nil, "/a", strings.Repeat("x", 100)); w.Code == http.StatusRequestEntityTooLarge {
+		t.Error("saving a page of -max-page-bytes answered 413")
+	}
+}
+
+func TestUnpublishedRevisions(t *testing.T) {
+	newTestWiki(t, map[string]string{"a.md": "---\npublish: 2999-01-01\n---\nembargoed\n"})
+	if err := store.Write("a.md", []byte("public\n"), "tester", "Update"); err != nil {
+		t.Fatal(err)
+	}
+	history := store.History("a.md", 2)
+	if len(history) != 2 {
+		t.Fatalf("History(a.md) = %+v, want 2 commits", history)
+	}
+	embargoed := history[1].Hash
+	admin := asAdmin(t)
+
+	w := httptest.NewRecorder()
+	wikiHandler(w, httptest.NewRequest("GET", "/a?revert-preview="+embargoed, nil))
+	if w.Code != http.StatusNotFound || strings.Contains(w.Body.String(), "embargoed") {
+		t.Errorf("anonymous revert preview of an unpublished revision answered %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	wikiHandler(w, admin(httptest.NewRequest("GET", "/a?revert-preview="+embargoed, nil)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "embargoed") {
+		t.Errorf("administrator revert preview of an unpublished revision answered %d", w.Code)
+	}
+
+	form := url.Values{"revert": {embargoed}, "author": {"tester"}}
+	r := httptest.NewRequest("POST", "/a", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	wikiHandler(w, r)
+	if w.Code != http.StatusNotFound || strings.Contains(w.Body.String(), "embargoed") {
+		t.Errorf("anonymous revert to an unpublished revision answered %d", w.Code)
+	}
+	if got := string(store.Read("a.md", "HEAD")); got != "public\n" {
+		t.Errorf("anonymous revert to an unpublished revision committed %q", got)
+	}
+}